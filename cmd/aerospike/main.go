@@ -33,7 +33,7 @@ func main() {
 	a := kingpin.New(filepath.Base(os.Args[0]), "Aerospike blackbox probe").UsageWriter(os.Stdout)
 	common.AddFlags(a, &commonCfg)
 	aerospike.AddFlags(a, &aerospikeCfg)
-	_, err := a.Parse(os.Args[1:])
+	command, err := a.Parse(os.Args[1:])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errors.Wrapf(err, "Error parsing commandline arguments"))
 		a.Usage(os.Args[1:])
@@ -58,6 +58,15 @@ func main() {
 		os.Exit(2)
 	}
 
+	if command == aerospike.DurabilityResetCommand {
+		if err := durabilityReset(logger, &config, &aerospikeCfg); err != nil {
+			level.Error(logger).Log("msg", "Fatal: durability reset failed", "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "Durability reset done")
+		return
+	}
+
 	// Metrics/pprof server
 	commonCfg.StartHttpServer()
 
@@ -105,6 +114,73 @@ func main() {
 			Interval:   config.AerospikeChecksConfigs.AuthCheckConfig.Interval,
 		})
 	}
+	if config.AerospikeChecksConfigs.ClusterHealthCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "cluster_health_check",
+			PrepareFn:  scheduler.Noop,
+			CheckFn:    aerospike.ClusterHealthCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.AerospikeChecksConfigs.ClusterHealthCheckConfig.Interval,
+		})
+	}
+	if config.AerospikeChecksConfigs.ScanQueryCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "scan_query_check",
+			PrepareFn:  aerospike.ScanQueryPrepare,
+			CheckFn:    aerospike.ScanQueryCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.AerospikeChecksConfigs.ScanQueryCheckConfig.Interval,
+		})
+	}
+	if config.AerospikeChecksConfigs.OperateCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "operate_check",
+			PrepareFn:  aerospike.OperatePrepare,
+			CheckFn:    aerospike.OperateCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.AerospikeChecksConfigs.OperateCheckConfig.Interval,
+		})
+	}
+	if config.AerospikeChecksConfigs.ExpirationCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "expiration_check",
+			PrepareFn:  scheduler.Noop,
+			CheckFn:    aerospike.ExpirationCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.AerospikeChecksConfigs.ExpirationCheckConfig.Interval,
+		})
+	}
+	if config.AerospikeChecksConfigs.PermissionCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "permission_check",
+			PrepareFn:  scheduler.Noop,
+			CheckFn:    aerospike.PermissionCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.AerospikeChecksConfigs.PermissionCheckConfig.Interval,
+		})
+	}
 
 	p.Start()
 }
+
+// durabilityReset discovers the cluster once and rewrites its missing or corrupted durability
+// items.
+func durabilityReset(logger log.Logger, config *aerospike.AerospikeProbeConfig, cfg *aerospike.AerospikeProbeCommandLine) error {
+	topo := make(chan topology.ClusterMap, 1)
+	discoverer, err := discovery.NewConsulDiscoverer(log.With(logger), config.DiscoveryConfig.ConsulConfig, topo, config.BuildTopology)
+	if err != nil {
+		return errors.Wrapf(err, "error during init of service discovery")
+	}
+	if err := discoverer.UpdateTopology(); err != nil {
+		return errors.Wrapf(err, "error during service discovery")
+	}
+	endpoint, err := aerospike.FindClusterEndpoint(<-topo, cfg.DurabilityResetCluster)
+	if err != nil {
+		return err
+	}
+	if err := endpoint.Connect(); err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", endpoint.GetName())
+	}
+	defer endpoint.Close()
+	return aerospike.DurabilityReset(endpoint, cfg.DurabilityResetNamespaces)
+}
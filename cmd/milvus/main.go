@@ -78,6 +78,70 @@ func main() {
 			Interval:   config.MilvusChecksConfigs.DurabilityCheckConfig.Interval,
 		})
 	}
+	if config.MilvusChecksConfigs.RecallCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "recall_check",
+			PrepareFn:  milvus.RecallPrepare,
+			CheckFn:    milvus.RecallCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.MilvusChecksConfigs.RecallCheckConfig.Interval,
+		})
+	}
+	if config.MilvusChecksConfigs.ConsistencyCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "consistency_check",
+			PrepareFn:  milvus.ConsistencyPrepare,
+			CheckFn:    milvus.ConsistencyCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.MilvusChecksConfigs.ConsistencyCheckConfig.Interval,
+		})
+	}
+	if config.MilvusChecksConfigs.SearchCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "search_check",
+			PrepareFn:  milvus.SearchPrepare,
+			CheckFn:    milvus.SearchCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.MilvusChecksConfigs.SearchCheckConfig.Interval,
+		})
+	}
+	if config.MilvusChecksConfigs.LifecycleCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "lifecycle_check",
+			PrepareFn:  milvus.LifecyclePrepare,
+			CheckFn:    milvus.LifecycleCheck,
+			TeardownFn: milvus.LifecycleTeardown,
+			Interval:   config.MilvusChecksConfigs.LifecycleCheckConfig.Interval,
+		})
+	}
+	if config.MilvusChecksConfigs.AuthCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "auth_check",
+			PrepareFn:  scheduler.Noop,
+			CheckFn:    milvus.AuthCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.MilvusChecksConfigs.AuthCheckConfig.Interval,
+		})
+	}
+	if config.MilvusChecksConfigs.JanitorCheckConfig.Enable {
+		p.RegisterNewClusterCheck(scheduler.Check{
+			Name:       "janitor_check",
+			PrepareFn:  scheduler.Noop,
+			CheckFn:    milvus.JanitorCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.MilvusChecksConfigs.JanitorCheckConfig.Interval,
+		})
+	}
+	if config.MilvusChecksConfigs.ProxyLatencyCheckConfig.Enable {
+		// Collections are created and initialized by the cluster latency check
+		p.RegisterNewNodeCheck(scheduler.Check{
+			Name:       "proxy_latency_check",
+			PrepareFn:  scheduler.Noop,
+			CheckFn:    milvus.ProxyLatencyCheck,
+			TeardownFn: scheduler.Noop,
+			Interval:   config.MilvusChecksConfigs.ProxyLatencyCheckConfig.Interval,
+		})
+	}
 
 	p.Start()
 }
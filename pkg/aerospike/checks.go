@@ -109,6 +109,16 @@ func getWriteNode(c *as.Client, policy *as.WritePolicy, key *as.Key) (*as.Node,
 	return node, nil
 }
 
+// nodeOpLabels returns the op_latency labels of an operation made against node. The node
+// fqdn and pod name associated to the aerospike endpoint are looked up from discovery.
+func nodeOpLabels(e *AerospikeEndpoint, operation string, namespace string, node *as.Node) []string {
+	nodeInfo := &common.ClusterNodeInfo{NodeName: node.GetHost().Name, NodeFqdn: "unknown", PodName: "unknown"}
+	if ni, found := e.ClusterConfig.nodeInfoCache[node.GetHost().Name]; found {
+		nodeInfo = ni
+	}
+	return []string{operation, node.GetHost().Name, namespace, nodeInfo.NodeFqdn, nodeInfo.PodName, e.ClusterConfig.clusterName, node.GetName()}
+}
+
 func ObserveOpLatency(op func() error, labels []string) error {
 	start := time.Now()
 	err := op()
@@ -144,8 +154,6 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 }
 
 func latencyCheckNamespace(e *AerospikeEndpoint, namespace string) error {
-	keyPrefix := e.ClusterConfig.genericConfig.LatencyKeyPrefix
-
 	policy := as.NewWritePolicy(0, 3600)                             // Expire after one hour if the delete didn't work
 	policy.MaxRetries = 0                                            // Ensure we never retry (0 is default Client value in v7)
 	policy.ReplicaPolicy = as.MASTER                                 // Read are always done on master (SEQUENCE is default Client value in v7)
@@ -153,12 +161,14 @@ func latencyCheckNamespace(e *AerospikeEndpoint, namespace string) error {
 	// Do not wait until timeout if connections cannot be open
 	policy.ExitFastOnExhaustedConnectionPool = e.ClusterConfig.genericConfig.ExitFastOnExhaustedConnectionPool
 
-	// FIXME: despite code intent we have no guarantee to hit all nodes of the cluster in a single iteration
-	// Instead we should generate one key per partition (number of partitions is known and constant with aerospike => 4096 partitions)
-	// These keys could be generated once in probe lifetime (partition id is the first 12 bits of the digest of the key) and then reused
-	// at each latency check.
+	// Keys are taken from the partition key ring: it holds one key per partition, so every node
+	// (master of some partitions) is hit within a full rotation of the ring.
 	for range e.Client.Cluster().GetNodes() { // scale the number of latency checks to the number of nodes
-		key, as_err := as.NewKey(namespace, e.ClusterConfig.genericConfig.MonitoringSet, fmt.Sprintf("%s%s", keyPrefix, utils.RandomHex(20)))
+		keyName, err := e.nextRingKey(namespace)
+		if err != nil {
+			return errors.Wrap(err, "failed to build the partition key ring")
+		}
+		key, as_err := as.NewKey(namespace, e.ClusterConfig.genericConfig.MonitoringSet, keyName)
 		if as_err != nil {
 			return as_err
 		}
@@ -170,15 +180,10 @@ func latencyCheckNamespace(e *AerospikeEndpoint, namespace string) error {
 		if err != nil {
 			return errors.Wrapf(err, "error when trying to find node for: %s", keyAsStr(key))
 		}
-
-		// lookup node fqdn and pod name associated to aerospike endpoint
-		nodeInfo := &common.ClusterNodeInfo{NodeName: node.GetHost().Name, NodeFqdn: "unknown", PodName: "unknown"}
-		if ni, found := e.ClusterConfig.nodeInfoCache[node.GetHost().Name]; found {
-			nodeInfo = ni
-		}
+		e.markRingNode(namespace, node.GetName())
 
 		// PUT OPERATION
-		labels := []string{"put", node.GetHost().Name, namespace, nodeInfo.NodeFqdn, nodeInfo.PodName, e.ClusterConfig.clusterName, node.GetName()}
+		labels := nodeOpLabels(e, "put", namespace, node)
 
 		// PUT OPERATION
 		opPut := func() error {
@@ -213,6 +218,9 @@ func latencyCheckNamespace(e *AerospikeEndpoint, namespace string) error {
 		}
 		level.Debug(e.Logger).Log("msg", fmt.Sprintf("record get: %s", keyAsStr(key)))
 
+		// RACK GET OPERATIONS (the delete is still done if a rack fails)
+		rackErr := rackReadNamespace(e, namespace, key, val)
+
 		// DELETE OPERATION
 		labels[0] = "delete"
 		opDelete := func() error {
@@ -232,6 +240,9 @@ func latencyCheckNamespace(e *AerospikeEndpoint, namespace string) error {
 			return errors.Wrapf(err, "record delete failed for: %s", keyAsStr(key))
 		}
 		level.Debug(e.Logger).Log("msg", fmt.Sprintf("record delete: %s", keyAsStr(key)))
+		if rackErr != nil {
+			return rackErr
+		}
 	}
 	return nil
 }
@@ -246,64 +257,37 @@ func DurabilityPrepare(p topology.ProbeableEndpoint) error {
 	})
 }
 
+// durabilityPrepareNamespace pushes all the durability items unless the flag item says it has
+// already been done. Items of a v1 flag are upgraded: only the valid ones are rewritten with the
+// current format, so that missing and corrupted items are still reported by the check.
 func durabilityPrepareNamespace(e *AerospikeEndpoint, namespace string) error {
-	policy := as.NewWritePolicy(0, as.TTLDontExpire)                 // No expiration
-	policy.MaxRetries = 2                                            // We can retry for durability (0 is default Client value in v7)
-	policy.TotalTimeout = e.ClusterConfig.genericConfig.TotalTimeout // 0 is default Client value in v7
-	// Do not wait until timeout if connections cannot be open
-	policy.ExitFastOnExhaustedConnectionPool = e.ClusterConfig.genericConfig.ExitFastOnExhaustedConnectionPool
-	keyRange := e.ClusterConfig.genericConfig.DurabilityKeyTotal
-	keyPrefix := e.ClusterConfig.genericConfig.DurabilityKeyPrefix
-	// allPushedFlag indicate if a probe have pushed all data once
-	// The value contains information about the data pushed (scheme:key_range)
-	// scheme: the format of the data (v1=shasum of the key)
-	// key_range: the number of keys
-	// If the probe find a missmatch it will repush the keys
-	expectedAllPushedFlagVal := fmt.Sprintf("%s:%d", "v1", keyRange) // v1 represents the format of the data stored.
-
-	// allPushedFlag indicate if a probe have pushed all data once
-	allPushedFlag, err := as.NewKey(namespace, e.ClusterConfig.genericConfig.MonitoringSet, fmt.Sprintf("%s%s", keyPrefix, "all_pushed_flag"))
+	conf := e.ClusterConfig.genericConfig
+	flag, err := readDurabilityFlag(e, namespace)
 	if err != nil {
 		return err
 	}
-
-	recVal, err := e.Client.Get(&policy.BasePolicy, allPushedFlag)
-
-	if err != nil && !err.Matches(as.ErrKeyNotFound.ResultCode) {
-		return err
-	}
 	// If the flag was found we skip the init as it has already been done
-	if recVal != nil && recVal.Bins["val"] == expectedAllPushedFlagVal {
+	if flag != nil && flag.val == durabilityFlagValue(durabilityPayloadVersion, conf.DurabilityKeyTotal) {
+		if flag.resetTs > 0 {
+			durabilityResetTimestamp.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(float64(flag.resetTs))
+		}
 		return nil
 	}
-
-	for i := 0; i < keyRange; i++ {
-		keyName := fmt.Sprintf("%s%d", keyPrefix, i)
-		key, err := as.NewKey(namespace, e.ClusterConfig.genericConfig.MonitoringSet, keyName)
+	if flag != nil && flag.val == durabilityFlagValue(1, conf.DurabilityKeyTotal) {
+		sweep, err := sweepDurabilityItems(e, namespace, flag)
 		if err != nil {
 			return err
 		}
-
-		val := as.BinMap{
-			"val": hash(keyName),
-		}
-
-		err = e.Client.Put(policy, key, val)
-		if err != nil {
-			return errors.Wrapf(err, "record put failed for: %s", keyAsStr(key))
-		}
-		level.Debug(e.Logger).Log("msg", fmt.Sprintf("record durability put: %s (%s)", keyAsStr(key), val["val"]))
+		level.Info(e.Logger).Log("msg", fmt.Sprintf("Upgrading %d durability items to v%d on namespace %s (%d missing or corrupted items left as is)",
+			len(sweep.legacy), durabilityPayloadVersion, namespace, len(sweep.damaged)))
+		return rewriteDurabilityItems(e, namespace, sweep.legacy, flag)
 	}
 
-	allPushedFlagVal := as.BinMap{
-		"val": expectedAllPushedFlagVal,
-	}
-	err = e.Client.Put(policy, allPushedFlag, allPushedFlagVal)
-	if err != nil {
-		return errors.Wrapf(err, "Push flag put failed for: %s", keyAsStr(allPushedFlag))
+	keyNames := make([]string, 0, conf.DurabilityKeyTotal)
+	for i := 0; i < conf.DurabilityKeyTotal; i++ {
+		keyNames = append(keyNames, durabilityKeyName(conf, i))
 	}
-
-	return nil
+	return rewriteDurabilityItems(e, namespace, keyNames, flag)
 }
 
 func DurabilityCheck(p topology.ProbeableEndpoint) error {
@@ -319,44 +303,29 @@ func DurabilityCheck(p topology.ProbeableEndpoint) error {
 // durabilityCheckNamespace completes a sweep and publishes durability gauges. Missing records,
 // corrupted values, and read failures are represented by durability_found_items and
 // durability_corrupted_items; they do not fail the scheduler check unless the sweep itself cannot
-// execute far enough to publish those gauges.
+// execute far enough to publish those gauges. In heal mode, missing and corrupted items are then
+// rewritten, so the gauges only report a loss for a single sweep.
 func durabilityCheckNamespace(e *AerospikeEndpoint, namespace string) error {
-	policy := as.NewPolicy()
-	policy.MaxRetries = 2                                            // 2 is default Client value in v7
-	policy.ReplicaPolicy = as.SEQUENCE                               // SEQUENCE is default Client value (alternate across master/replica in case of errors)
-	policy.TotalTimeout = e.ClusterConfig.genericConfig.TotalTimeout // 0 is default Client value in v7
-	// Do not wait until timeout if connections cannot be open
-	policy.ExitFastOnExhaustedConnectionPool = e.ClusterConfig.genericConfig.ExitFastOnExhaustedConnectionPool
-	keyRange := e.ClusterConfig.genericConfig.DurabilityKeyTotal
-	keyPrefix := e.ClusterConfig.genericConfig.DurabilityKeyPrefix
-
-	total_found_items := 0.0
-	total_corrupted_items := 0.0
-	for i := 0; i < keyRange; i++ {
-		keyName := fmt.Sprintf("%s%d", keyPrefix, i)
-		key, err := as.NewKey(namespace, e.ClusterConfig.genericConfig.MonitoringSet, keyName)
-		if err != nil {
-			return err
-		}
+	flag, err := readDurabilityFlag(e, namespace)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read durability flag on namespace %s", namespace)
+	}
+	sweep, err := sweepDurabilityItems(e, namespace, flag)
+	if err != nil {
+		return err
+	}
+	durabilityExpectedItems.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(float64(e.ClusterConfig.genericConfig.DurabilityKeyTotal))
+	durabilityFoundItems.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(sweep.found)
+	durabilityCorruptedItems.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(sweep.corrupted)
 
-		recVal, err := e.Client.Get(policy, key)
-		if err != nil {
-			level.Error(e.Logger).Log("msg", fmt.Sprintf("Error while fetching record: %s", keyAsStr(key)), "err", err)
-			continue
-		}
-		if recVal.Bins["val"] != hash(keyName) {
-			level.Warn(e.Logger).Log("msg",
-				fmt.Sprintf("Get successful but the data didn't match what was expected got: '%s', expected: '%s' (for %s)",
-					recVal.Bins["val"], hash(keyName), keyAsStr(key)))
-			total_corrupted_items += 1
-		} else {
-			total_found_items += 1
-		}
-		level.Debug(e.Logger).Log("msg", fmt.Sprintf("durability record validated: %s (%s)", keyAsStr(key), recVal.Bins["val"]))
+	if flag != nil && flag.resetTs > 0 {
+		durabilityResetTimestamp.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(float64(flag.resetTs))
+	}
+
+	if e.ClusterConfig.genericConfig.DurabilityMode == durabilityModeHeal && len(sweep.damaged) > 0 {
+		level.Warn(e.Logger).Log("msg", fmt.Sprintf("Healing %d missing or corrupted durability items on namespace %s (%d legacy items rewritten too)", len(sweep.damaged), namespace, len(sweep.legacy)))
+		return rewriteDurabilityItems(e, namespace, sweep.rewritable(), flag)
 	}
-	durabilityExpectedItems.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(float64(keyRange))
-	durabilityFoundItems.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(total_found_items)
-	durabilityCorruptedItems.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(total_corrupted_items)
 	return nil
 }
 
@@ -351,3 +351,166 @@ func TestAuthCheckHonorsParallelism(t *testing.T) {
 		t.Fatalf("expected at most %d active auth checks, got %d", maxAuthCheckParallelism, got)
 	}
 }
+
+// opLatencyNodes returns the ids of the nodes with op_latency series for the given cluster.
+func opLatencyNodes(t *testing.T, cluster string) map[string]struct{} {
+	t.Helper()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		opLatency.Collect(ch)
+		close(ch)
+	}()
+	nodes := map[string]struct{}{}
+	for m := range ch {
+		var dm dto.Metric
+		if err := m.Write(&dm); err != nil {
+			continue
+		}
+		labels := map[string]string{}
+		for _, lp := range dm.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		if labels["cluster"] == cluster {
+			nodes[labels["node_id"]] = struct{}{}
+		}
+	}
+	return nodes
+}
+
+func TestLatencyCheckStandin(t *testing.T) {
+	standin := newStandinCluster(t, 3, "ns1", "ns2")
+	e := standin.standinEndpoint(t, "", "", nil)
+
+	if err := LatencyCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	// The first keys of the ring are in consecutive partitions, whose masters are all the nodes
+	if got := len(opLatencyNodes(t, e.ClusterConfig.clusterName)); got != 3 {
+		t.Errorf("expected op_latency series for 3 nodes, got %d", got)
+	}
+	for _, namespace := range []string{"ns1", "ns2"} {
+		if got := standin.recordCount(namespace); got != 0 {
+			t.Errorf("expected latency records to be deleted on %s, got %d records", namespace, got)
+		}
+	}
+}
+
+// TestLatencyCheckNodeDrop writes durability items, drops a node, then checks that the client
+// moved to the surviving nodes and that the items written before the drop are still readable.
+func TestLatencyCheckNodeDrop(t *testing.T) {
+	standin := newStandinCluster(t, 3, "ns1")
+	e := standin.standinEndpoint(t, "", "", nil)
+	if err := DurabilityPrepare(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	standin.stopNode(0)
+	waitForNodes(t, e, 2)
+
+	for i := 0; i < 10; i++ {
+		if err := LatencyCheck(e); err != nil {
+			t.Fatalf("expected nil error after the node drop, got %v", err)
+		}
+	}
+	nodes := opLatencyNodes(t, e.ClusterConfig.clusterName)
+	if _, found := nodes[standin.nodes[0].name]; found || len(nodes) != 2 {
+		t.Errorf("expected op_latency series for the 2 surviving nodes only, got %v", nodes)
+	}
+
+	if err := DurabilityCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got := testutil.ToFloat64(durabilityFoundItems.WithLabelValues("ns1", e.ClusterConfig.clusterName, e.GetName())); got != 20 {
+		t.Errorf("expected 20 durability items found after the node drop, got %v", got)
+	}
+}
+
+func TestDurabilityCheckStandin(t *testing.T) {
+	standin := newStandinCluster(t, 2, "ns1")
+	e := standin.standinEndpoint(t, "", "", nil)
+	conf := e.ClusterConfig.genericConfig
+	found := func() float64 {
+		return testutil.ToFloat64(durabilityFoundItems.WithLabelValues("ns1", e.ClusterConfig.clusterName, e.GetName()))
+	}
+	corrupted := func() float64 {
+		return testutil.ToFloat64(durabilityCorruptedItems.WithLabelValues("ns1", e.ClusterConfig.clusterName, e.GetName()))
+	}
+
+	if err := DurabilityPrepare(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err := DurabilityCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if found() != 20 || corrupted() != 0 {
+		t.Fatalf("expected 20 found and 0 corrupted items, got %v and %v", found(), corrupted())
+	}
+
+	standin.setStringBin("ns1", conf.MonitoringSet, durabilityKeyName(conf, 3), "val", "garbage")
+	standin.dropRecord("ns1", conf.MonitoringSet, durabilityKeyName(conf, 5))
+	if err := DurabilityCheck(e); err != nil {
+		t.Fatalf("missing or corrupted items must not fail the check, got %v", err)
+	}
+	if found() != 18 || corrupted() != 1 {
+		t.Fatalf("expected 18 found and 1 corrupted items, got %v and %v", found(), corrupted())
+	}
+
+	// A second prepare (probe restart) does not rewrite the items
+	if err := DurabilityPrepare(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err := DurabilityCheck(e); err != nil || found() != 18 {
+		t.Fatalf("expected items to be left untouched by prepare, got %v found (err: %v)", found(), err)
+	}
+
+	// Heal mode reports the loss once, then rewrites the items with a new generation
+	conf.DurabilityMode = durabilityModeHeal
+	if err := DurabilityCheck(e); err != nil || found() != 18 {
+		t.Fatalf("expected the heal sweep to report 18 found items, got %v (err: %v)", found(), err)
+	}
+	if err := DurabilityCheck(e); err != nil || found() != 20 || corrupted() != 0 {
+		t.Fatalf("expected all items healed, got %v found and %v corrupted (err: %v)", found(), corrupted(), err)
+	}
+	flag, err := readDurabilityFlag(e, "ns1")
+	if err != nil || flag == nil || flag.generation != 2 {
+		t.Fatalf("expected the flag to record the second generation, got %+v (err: %v)", flag, err)
+	}
+}
+
+func TestAuthCheckStandin(t *testing.T) {
+	standin := newStandinCluster(t, 2, "ns1")
+	standin.setUser("probe", "secret")
+	// No tend after the initial one: the stopped node stays an auth target
+	e := standin.standinEndpoint(t, "probe", "secret", func(conf *AerospikeEndpointConfig) {
+		conf.AuthExternal = false
+		conf.TendInterval = time.Hour
+	})
+	authTotal := func(node *standinNode, status string) float64 {
+		return testutil.ToFloat64(authCheckTotal.WithLabelValues(e.ClusterConfig.clusterName, "127.0.0.1", node.name, status))
+	}
+
+	if err := AuthCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for _, node := range standin.nodes {
+		if got := authTotal(node, authStatusSuccess); got != 1 {
+			t.Errorf("node %s: expected 1 success, got %v", node.name, got)
+		}
+	}
+
+	// Credentials revoked: the pooled connections keep working, only a fresh login notices
+	standin.setUser("probe", "rotated")
+	if err := LatencyCheck(e); err != nil {
+		t.Fatalf("expected the authenticated client to keep working, got %v", err)
+	}
+	standin.stopNode(0)
+	if err := AuthCheck(e); err == nil {
+		t.Fatal("expected AuthCheck to fail when the password is rejected")
+	}
+	if got := authTotal(standin.nodes[0], authStatusConnError); got != 1 {
+		t.Errorf("stopped node: expected 1 connection_error, got %v", got)
+	}
+	if got := authTotal(standin.nodes[1], authStatusAuthFail); got != 1 {
+		t.Errorf("live node: expected 1 auth_failure, got %v", got)
+	}
+}
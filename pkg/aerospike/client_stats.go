@@ -0,0 +1,173 @@
+package aerospike
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// clientAggregatedStatsKey is the entry of the client stats holding the sum of all nodes stats.
+const clientAggregatedStatsKey = "cluster-aggregated-stats"
+
+var clusterStats = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_aerospike_client_cluster_stats",
+	Help: "Cluster aggregated metrics from the go aerospike client",
+}, []string{"cluster", "probe_endpoint", "name"})
+
+var clientNodeStats = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_aerospike_client_node_stats",
+	Help: "Per node metrics from the go aerospike client",
+}, []string{"cluster", "probe_endpoint", "endpoint", "name"})
+
+var clientConnectionPoolUsage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_aerospike_client_connection_pool_usage",
+	Help: "Ratio of open connections to the connection pool size (ConnectionQueueSize) of each node",
+}, []string{"cluster", "probe_endpoint", "endpoint"})
+
+var clientPartitionMapAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_aerospike_client_partition_map_age_seconds",
+	Help: "Time since the go aerospike client last updated its partition map",
+}, []string{"cluster", "probe_endpoint"})
+
+// clientStats are the counters of the go aerospike client for a node (or aggregated over all
+// nodes). Latency histograms are not exported: they are only filled when client metrics are
+// enabled, and op_latency already covers the probe operations.
+type clientStats struct {
+	ConnectionsAttempts      float64 `json:"connections-attempts"`
+	ConnectionsSuccessful    float64 `json:"connections-successful"`
+	ConnectionsFailed        float64 `json:"connections-failed"`
+	ConnectionsTimeoutErrors float64 `json:"connections-error-timeout"`
+	ConnectionsOtherErrors   float64 `json:"connections-error-other"`
+	CircuitBreakerHits       float64 `json:"circuit-breaker-hits"`
+	ConnectionsPoolEmpty     float64 `json:"connections-pool-empty"`
+	ConnectionsPoolOverflow  float64 `json:"connections-pool-overflow"`
+	ConnectionsIdleDropped   float64 `json:"connections-idle-dropped"`
+	ConnectionsOpen          float64 `json:"open-connections"`
+	ConnectionsClosed        float64 `json:"closed-connections"`
+	ConnectionsRecovered     float64 `json:"connections-recovered"`
+	TendsTotal               float64 `json:"tends-total"`
+	TendsSuccessful          float64 `json:"tends-successful"`
+	TendsFailed              float64 `json:"tends-failed"`
+	PartitionMapUpdates      float64 `json:"partition-map-updates"`
+	NodeAdded                float64 `json:"node-added-count"`
+	NodeRemoved              float64 `json:"node-removed-count"`
+	RetryCount               float64 `json:"transaction-retry-count"`
+	ErrorCount               float64 `json:"transaction-error-count"`
+	// Only reported in the aggregated stats
+	ExceededMaxRetries   float64 `json:"exceeded-max-retries"`
+	ExceededTotalTimeout float64 `json:"exceeded-total-timeout"`
+}
+
+// values returns the stats by their name in the client (used as the `name` label).
+func (s *clientStats) values() map[string]float64 {
+	return map[string]float64{
+		"connections-attempts":      s.ConnectionsAttempts,
+		"connections-successful":    s.ConnectionsSuccessful,
+		"connections-failed":        s.ConnectionsFailed,
+		"connections-error-timeout": s.ConnectionsTimeoutErrors,
+		"connections-error-other":   s.ConnectionsOtherErrors,
+		"circuit-breaker-hits":      s.CircuitBreakerHits,
+		"connections-pool-empty":    s.ConnectionsPoolEmpty,
+		"connections-pool-overflow": s.ConnectionsPoolOverflow,
+		"connections-idle-dropped":  s.ConnectionsIdleDropped,
+		"open-connections":          s.ConnectionsOpen,
+		"closed-connections":        s.ConnectionsClosed,
+		"connections-recovered":     s.ConnectionsRecovered,
+		"tends-total":               s.TendsTotal,
+		"tends-successful":          s.TendsSuccessful,
+		"tends-failed":              s.TendsFailed,
+		"partition-map-updates":     s.PartitionMapUpdates,
+		"node-added-count":          s.NodeAdded,
+		"node-removed-count":        s.NodeRemoved,
+		"transaction-retry-count":   s.RetryCount,
+		"transaction-error-count":   s.ErrorCount,
+	}
+}
+
+// parseClientStats converts the untyped output of Client.Stats() into the aggregated stats and
+// the stats of each node (by node address). Entries which are not node stats are ignored.
+func parseClientStats(stats map[string]interface{}) (*clientStats, map[string]*clientStats, error) {
+	var aggregated *clientStats
+	nodes := make(map[string]*clientStats)
+	for key, val := range stats {
+		if _, ok := val.(map[string]interface{}); !ok {
+			continue
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to encode client stats %s", key)
+		}
+		parsed := &clientStats{}
+		if err := json.Unmarshal(b, parsed); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to decode client stats %s", key)
+		}
+		if key == clientAggregatedStatsKey {
+			aggregated = parsed
+		} else {
+			nodes[key] = parsed
+		}
+	}
+	if aggregated == nil {
+		return nil, nil, errors.Errorf("no %s in client stats", clientAggregatedStatsKey)
+	}
+	return aggregated, nodes, nil
+}
+
+func (e *AerospikeEndpoint) refreshMetrics() {
+	stats, err := e.Client.Stats()
+	if err != nil {
+		level.Error(e.Logger).Log("msg", "Failed to pull metrics from aerospike client", "err", err)
+		return
+	}
+	policy := e.Client.Cluster().ClientPolicy()
+	if err := e.exportClientStats(stats, policy.ConnectionQueueSize, time.Now()); err != nil {
+		level.Error(e.Logger).Log("msg", "Failed to parse metrics from aerospike client", "err", err)
+	}
+}
+
+// exportClientStats exports the aggregated and per node client stats. Per node series are
+// replaced, so nodes the client forgot about do not keep exporting their last known state.
+func (e *AerospikeEndpoint) exportClientStats(stats map[string]interface{}, poolSize int, now time.Time) error {
+	aggregated, nodes, err := parseClientStats(stats)
+	if err != nil {
+		return err
+	}
+
+	clusterName := e.ClusterConfig.clusterName
+	for name, value := range aggregated.values() {
+		clusterStats.WithLabelValues(clusterName, e.GetName(), name).Set(value)
+	}
+	clusterStats.WithLabelValues(clusterName, e.GetName(), "exceeded-max-retries").Set(aggregated.ExceededMaxRetries)
+	clusterStats.WithLabelValues(clusterName, e.GetName(), "exceeded-total-timeout").Set(aggregated.ExceededTotalTimeout)
+
+	endpointLabels := prometheus.Labels{"cluster": clusterName, "probe_endpoint": e.GetName()}
+	clientNodeStats.DeletePartialMatch(endpointLabels)
+	clientConnectionPoolUsage.DeletePartialMatch(endpointLabels)
+	for address, node := range nodes {
+		// Nodes are identified by their address (host:port), exported by IP like other metrics
+		endpoint, _, err := net.SplitHostPort(address)
+		if err != nil {
+			endpoint = address
+		}
+		for name, value := range node.values() {
+			clientNodeStats.WithLabelValues(clusterName, e.GetName(), endpoint, name).Set(value)
+		}
+		if poolSize > 0 {
+			clientConnectionPoolUsage.WithLabelValues(clusterName, e.GetName(), endpoint).Set(node.ConnectionsOpen / float64(poolSize))
+		}
+	}
+
+	// The client does not expose when its partition map was updated: it is derived from the
+	// partition-map-updates counter at each refresh.
+	if e.partitionMapUpdatedAt.IsZero() || aggregated.PartitionMapUpdates != e.partitionMapUpdates {
+		e.partitionMapUpdates = aggregated.PartitionMapUpdates
+		e.partitionMapUpdatedAt = now
+	}
+	clientPartitionMapAge.WithLabelValues(clusterName, e.GetName()).Set(now.Sub(e.partitionMapUpdatedAt).Seconds())
+	return nil
+}
@@ -0,0 +1,85 @@
+package aerospike
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// clientStatsFixture mimics the output of Client.Stats() (decoded from JSON).
+func clientStatsFixture(partitionMapUpdates float64) map[string]interface{} {
+	return map[string]interface{}{
+		"10.0.0.1:3000": map[string]interface{}{
+			"open-connections":     float64(10),
+			"circuit-breaker-hits": float64(2),
+			"get-metrics":          map[string]interface{}{"buckets": []interface{}{}},
+		},
+		clientAggregatedStatsKey: map[string]interface{}{
+			"open-connections":       float64(10),
+			"circuit-breaker-hits":   float64(2),
+			"partition-map-updates":  partitionMapUpdates,
+			"exceeded-total-timeout": float64(4),
+		},
+		"open-connections": 10,
+		"total-nodes":      1,
+	}
+}
+
+func TestParseClientStats(t *testing.T) {
+	aggregated, nodes, err := parseClientStats(clientStatsFixture(1))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if aggregated.ConnectionsOpen != 10 || aggregated.ExceededTotalTimeout != 4 || aggregated.PartitionMapUpdates != 1 {
+		t.Fatalf("unexpected aggregated stats %+v", aggregated)
+	}
+	if len(nodes) != 1 || nodes["10.0.0.1:3000"].CircuitBreakerHits != 2 {
+		t.Fatalf("unexpected node stats %+v", nodes)
+	}
+
+	if _, _, err := parseClientStats(map[string]interface{}{"total-nodes": 0}); err == nil {
+		t.Fatalf("expected an error without aggregated stats")
+	}
+}
+
+func TestExportClientStats(t *testing.T) {
+	cluster := authTestCluster(t)
+	e := &AerospikeEndpoint{Name: "probe", ClusterConfig: &AerospikeClientConfig{clusterName: cluster}}
+
+	// A stale series from a node the client forgot about; the export must clean it up.
+	clientNodeStats.WithLabelValues(cluster, "probe", "10.9.9.9", "open-connections").Set(3)
+
+	now := time.Now()
+	if err := e.exportClientStats(clientStatsFixture(1), 100, now); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got := testutil.ToFloat64(clusterStats.WithLabelValues(cluster, "probe", "exceeded-total-timeout")); got != 4 {
+		t.Fatalf("expected 4 total timeouts, got %v", got)
+	}
+	if got := testutil.ToFloat64(clientNodeStats.WithLabelValues(cluster, "probe", "10.0.0.1", "circuit-breaker-hits")); got != 2 {
+		t.Fatalf("expected 2 circuit breaker hits, got %v", got)
+	}
+	if got := testutil.ToFloat64(clientConnectionPoolUsage.WithLabelValues(cluster, "probe", "10.0.0.1")); got != 0.1 {
+		t.Fatalf("expected a pool usage of 0.1, got %v", got)
+	}
+	// Other tests export the stats of their own clusters
+	if got := clientNodeStats.DeletePartialMatch(prometheus.Labels{"cluster": cluster}); got != len((&clientStats{}).values()) {
+		t.Fatalf("expected only the series of the live node, got %d", got)
+	}
+
+	// The partition map age grows until the partition map is updated
+	if err := e.exportClientStats(clientStatsFixture(1), 100, now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got := testutil.ToFloat64(clientPartitionMapAge.WithLabelValues(cluster, "probe")); got != 60 {
+		t.Fatalf("expected a partition map age of 60s, got %v", got)
+	}
+	if err := e.exportClientStats(clientStatsFixture(2), 100, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got := testutil.ToFloat64(clientPartitionMapAge.WithLabelValues(cluster, "probe")); got != 0 {
+		t.Fatalf("expected the partition map age to be reset, got %v", got)
+	}
+}
@@ -1,6 +1,7 @@
 package aerospike
 
 import (
+	"regexp"
 	"time"
 
 	as "github.com/aerospike/aerospike-client-go/v8"
@@ -48,16 +49,41 @@ type AerospikeEndpointConfig struct {
 	// Metadata key to get the Hostname to use for TLS auth (only used if tlsTag is set)
 	TLSHostnameMetaKey string `yaml:"tls_hostname_meta_key,omitempty"`
 	// Probe configuration
-	NamespaceMetaKey                  string        `yaml:"namespace_meta_key,omitempty"`
-	NamespaceMetaKeyPrefix            string        `yaml:"namespace_meta_key_prefix,omitempty"`
-	MonitoringSet                     string        `yaml:"monitoring_set,omitempty"`
-	LatencyKeyPrefix                  string        `yaml:"latency_key_prefix,omitempty"`
-	DurabilityKeyPrefix               string        `yaml:"durability_key_prefix,omitempty"`
-	DurabilityKeyTotal                int           `yaml:"durability_key_total,omitempty"`
+	NamespaceMetaKey       string `yaml:"namespace_meta_key,omitempty"`
+	NamespaceMetaKeyPrefix string `yaml:"namespace_meta_key_prefix,omitempty"`
+	// If enabled, namespaces are also listed from the cluster (`namespaces` info command) and
+	// filtered with the include/exclude regexes (full match, exclude takes precedence)
+	NamespaceAutoDiscovery bool   `yaml:"namespace_auto_discovery,omitempty"`
+	NamespaceIncludeRegex  string `yaml:"namespace_include_regex,omitempty"`
+	NamespaceExcludeRegex  string `yaml:"namespace_exclude_regex,omitempty"`
+	MonitoringSet          string `yaml:"monitoring_set,omitempty"`
+	LatencyKeyPrefix       string `yaml:"latency_key_prefix,omitempty"`
+	DurabilityKeyPrefix    string `yaml:"durability_key_prefix,omitempty"`
+	DurabilityKeyTotal     int    `yaml:"durability_key_total,omitempty"`
+	// check: only report missing/corrupted durability items, heal: also rewrite them
+	DurabilityMode   string `yaml:"durability_mode,omitempty"`
+	QueryKeyPrefix   string `yaml:"query_key_prefix,omitempty"`
+	QueryKeyTotal    int    `yaml:"query_key_total,omitempty"`
+	QueryIndexBin    string `yaml:"query_index_bin,omitempty"`
+	OperateKeyPrefix string `yaml:"operate_key_prefix,omitempty"`
+	// Records of the expiration check are written with ExpirationTTL, and must be gone at most
+	// ExpirationGracePeriod after it
+	ExpirationKeyPrefix   string        `yaml:"expiration_key_prefix,omitempty"`
+	ExpirationTTL         time.Duration `yaml:"expiration_ttl,omitempty"`
+	ExpirationGracePeriod time.Duration `yaml:"expiration_grace_period,omitempty"`
+	// Roles the probe user must hold (permission check), not compared if empty. External users
+	// are not in the user table of the cluster, so roles cannot be compared with AuthExternal
+	ExpectedRoles       []string `yaml:"expected_roles,omitempty"`
+	PermissionKeyPrefix string   `yaml:"permission_key_prefix,omitempty"`
+	// Name of the probe UDF module registered on the cluster (without the .lua extension)
+	UDFModule                         string        `yaml:"udf_module,omitempty"`
 	TendInterval                      time.Duration `yaml:"tend_interval,omitempty"`
 	TotalTimeout                      time.Duration `yaml:"total_timeout,omitempty"`
 	ConnectionTimeout                 time.Duration `yaml:"connection_timeout,omitempty"`
 	ExitFastOnExhaustedConnectionPool bool          `yaml:"exit_fast_on_exhausted_connection_pool,omitempty"`
+	// If enabled, the latency check also reads each key from every rack of the namespace
+	// (one rack-aware client per rack, racks fetched with the `racks` info command)
+	RackAwareLatency bool `yaml:"rack_aware_latency,omitempty"`
 }
 
 var (
@@ -73,6 +99,16 @@ var (
 		LatencyKeyPrefix:                  "monitoring_latency_",
 		DurabilityKeyPrefix:               "monitoring_durability_",
 		DurabilityKeyTotal:                10000,
+		DurabilityMode:                    durabilityModeCheck,
+		QueryKeyPrefix:                    "monitoring_query_",
+		QueryKeyTotal:                     100,
+		QueryIndexBin:                     "query_idx",
+		OperateKeyPrefix:                  "monitoring_operate_",
+		UDFModule:                         "blackbox_probe",
+		ExpirationKeyPrefix:               "monitoring_expiration_",
+		ExpirationTTL:                     time.Minute,
+		ExpirationGracePeriod:             time.Minute,
+		PermissionKeyPrefix:               "monitoring_permission_",
 		TendInterval:                      time.Second,
 		TotalTimeout:                      30 * time.Second,
 		ConnectionTimeout:                 5 * time.Second,
@@ -88,13 +124,78 @@ func (c *AerospikeEndpointConfig) UnmarshalYAML(unmarshal func(interface{}) erro
 	if err != nil {
 		return err
 	}
+	if c.DurabilityMode != durabilityModeCheck && c.DurabilityMode != durabilityModeHeal {
+		return errors.Errorf("durability_mode must be %q or %q, got %q", durabilityModeCheck, durabilityModeHeal, c.DurabilityMode)
+	}
+	if c.ExpirationTTL < time.Second {
+		return errors.Errorf("expiration_ttl must be at least 1s, got %s", c.ExpirationTTL)
+	}
+	if c.ExpirationGracePeriod < 0 {
+		return errors.Errorf("expiration_grace_period must not be negative, got %s", c.ExpirationGracePeriod)
+	}
+	if c.AuthExternal && len(c.ExpectedRoles) > 0 {
+		return errors.Errorf("expected_roles cannot be checked with auth_external: external users cannot be queried")
+	}
+	if c.QueryKeyTotal < 1 {
+		return errors.Errorf("query_key_total must be positive, got %d", c.QueryKeyTotal)
+	}
+	if _, _, err := c.namespaceRegexes(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// namespaceRegexes compiles the include/exclude regexes of the namespace auto-discovery. A nil
+// regex means no filtering.
+func (c *AerospikeEndpointConfig) namespaceRegexes() (include *regexp.Regexp, exclude *regexp.Regexp, err error) {
+	if c.NamespaceIncludeRegex != "" {
+		include, err = regexp.Compile("^(?:" + c.NamespaceIncludeRegex + ")$")
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid namespace_include_regex %q", c.NamespaceIncludeRegex)
+		}
+	}
+	if c.NamespaceExcludeRegex != "" {
+		exclude, err = regexp.Compile("^(?:" + c.NamespaceExcludeRegex + ")$")
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid namespace_exclude_regex %q", c.NamespaceExcludeRegex)
+		}
+	}
+	return include, exclude, nil
+}
+
+// filterNamespaces returns the auto-discovered namespaces matching the include regex and not
+// matching the exclude regex.
+func (c *AerospikeEndpointConfig) filterNamespaces(namespaces []string) ([]string, error) {
+	include, exclude, err := c.namespaceRegexes()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		if include != nil && !include.MatchString(namespace) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(namespace) {
+			continue
+		}
+		res = append(res, namespace)
+	}
+	return res, nil
+}
+
+// DurabilityResetCommand is the command rewriting the missing/corrupted durability items of a
+// cluster after an incident, instead of running the probe.
+const DurabilityResetCommand = "durability-reset"
+
 func AddFlags(a *kingpin.Application, cfg *AerospikeProbeCommandLine) {
 	a.HelpFlag.Short('h')
 	a.Flag("aerospike.log.level", "Only log messages with the given severity or above. One of: [debug, info, warn, error, off]").
 		Default("off").StringVar(&cfg.AerospikeLogLevel)
+
+	a.Command("probe", "Run the probe").Default()
+	reset := a.Command(DurabilityResetCommand, "Rewrite the missing or corrupted durability items of a cluster and record the reset")
+	reset.Flag("cluster", "Name of the cluster to reset").Required().StringVar(&cfg.DurabilityResetCluster)
+	reset.Flag("namespace", "Namespace to reset (repeatable), defaults to all monitored namespaces").StringsVar(&cfg.DurabilityResetNamespaces)
 }
 
 func GetLevel(s string) (asl.LogPriority, error) {
@@ -116,6 +217,9 @@ func GetLevel(s string) (asl.LogPriority, error) {
 
 type AerospikeProbeCommandLine struct {
 	AerospikeLogLevel string `yaml:"aerospike_log_level,omitempty"`
+	// durability-reset command
+	DurabilityResetCluster    string   `yaml:"durability_reset_cluster,omitempty"`
+	DurabilityResetNamespaces []string `yaml:"durability_reset_namespaces,omitempty"`
 }
 
 type AerospikeProbeConfig struct {
@@ -128,7 +232,12 @@ type AerospikeProbeConfig struct {
 }
 
 type AerospikeChecksConfigs struct {
-	LatencyCheckConfig    scheduler.CheckConfig `yaml:"latency_check,omitempty"`
-	DurabilityCheckConfig scheduler.CheckConfig `yaml:"durability_check,omitempty"`
-	AuthCheckConfig       scheduler.CheckConfig `yaml:"auth_check,omitempty"`
+	LatencyCheckConfig       scheduler.CheckConfig `yaml:"latency_check,omitempty"`
+	DurabilityCheckConfig    scheduler.CheckConfig `yaml:"durability_check,omitempty"`
+	AuthCheckConfig          scheduler.CheckConfig `yaml:"auth_check,omitempty"`
+	ClusterHealthCheckConfig scheduler.CheckConfig `yaml:"cluster_health_check,omitempty"`
+	ScanQueryCheckConfig     scheduler.CheckConfig `yaml:"scan_query_check,omitempty"`
+	OperateCheckConfig       scheduler.CheckConfig `yaml:"operate_check,omitempty"`
+	ExpirationCheckConfig    scheduler.CheckConfig `yaml:"expiration_check,omitempty"`
+	PermissionCheckConfig    scheduler.CheckConfig `yaml:"permission_check,omitempty"`
 }
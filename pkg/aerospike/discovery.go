@@ -6,6 +6,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	as "github.com/aerospike/aerospike-client-go/v8"
 	"github.com/criteo/blackbox-prober/pkg/common"
@@ -17,6 +19,86 @@ import (
 	"github.com/go-kit/log/level"
 )
 
+// discoveredNamespaces caches, per cluster name, the namespaces found by the namespace
+// auto-discovery: bootstrapped by BuildTopology, then kept up to date by endpoint refreshes.
+// Endpoints built by BuildTopology include them, so a change in the discovered set changes the
+// endpoint hash and the scheduler restarts the worker with the new namespaces (and runs the
+// prepare of the new ones) at the next topology update. The time of the last bootstrap of each
+// cluster is kept as well, so clusters without any namespace (unreachable, or all filtered out)
+// are not bootstrapped again at every topology update.
+var discoveredNamespaces = struct {
+	sync.RWMutex
+	byCluster      map[string][]string
+	bootstrappedAt map[string]time.Time
+}{byCluster: map[string][]string{}, bootstrappedAt: map[string]time.Time{}}
+
+// namespaceBootstrapBackoff is the minimum time between two bootstraps of the namespaces of a
+// cluster without running endpoint.
+var namespaceBootstrapBackoff = 5 * time.Minute
+
+func getDiscoveredNamespaces(clusterName string) []string {
+	discoveredNamespaces.RLock()
+	defer discoveredNamespaces.RUnlock()
+	return discoveredNamespaces.byCluster[clusterName]
+}
+
+// evictDiscoveredNamespaces drops the discovered namespaces of the clusters which are not in the
+// given set anymore.
+func evictDiscoveredNamespaces(clusters map[string]struct{}) {
+	discoveredNamespaces.Lock()
+	defer discoveredNamespaces.Unlock()
+	for clusterName := range discoveredNamespaces.byCluster {
+		if _, ok := clusters[clusterName]; !ok {
+			delete(discoveredNamespaces.byCluster, clusterName)
+		}
+	}
+	for clusterName := range discoveredNamespaces.bootstrappedAt {
+		if _, ok := clusters[clusterName]; !ok {
+			delete(discoveredNamespaces.bootstrappedAt, clusterName)
+		}
+	}
+}
+
+// namespaceBootstrapDue tells whether the namespaces of a cluster without any discovered
+// namespace should be bootstrapped, and records the attempt if so.
+func namespaceBootstrapDue(clusterName string, now time.Time) bool {
+	discoveredNamespaces.Lock()
+	defer discoveredNamespaces.Unlock()
+	if last, ok := discoveredNamespaces.bootstrappedAt[clusterName]; ok && now.Sub(last) < namespaceBootstrapBackoff {
+		return false
+	}
+	discoveredNamespaces.bootstrappedAt[clusterName] = now
+	return true
+}
+
+// bootstrapNamespaces is indirected through a package variable so unit tests can mock it without
+// a live cluster. It discovers the namespaces of a cluster with a temporary client, for clusters
+// without a running endpoint to refresh them.
+var bootstrapNamespaces = func(logger log.Logger, clusterConfig *AerospikeClientConfig) error {
+	e := &AerospikeEndpoint{
+		Name:          clusterConfig.clusterName,
+		ClusterConfig: clusterConfig,
+		Logger:        logger,
+	}
+	client, err := as.NewClientWithPolicyAndHost(e.clientPolicy(), clusterConfig.hosts...)
+	if err != nil {
+		return err
+	}
+	e.Client = client
+	defer e.Close()
+	return e.refreshNamespaces()
+}
+
+// setDiscoveredNamespaces stores the discovered namespaces of a cluster and returns true if
+// they changed.
+func setDiscoveredNamespaces(clusterName string, namespaces []string) bool {
+	discoveredNamespaces.Lock()
+	defer discoveredNamespaces.Unlock()
+	previous, ok := discoveredNamespaces.byCluster[clusterName]
+	discoveredNamespaces.byCluster[clusterName] = namespaces
+	return !ok || strings.Join(previous, ",") != strings.Join(namespaces, ",")
+}
+
 func (conf *AerospikeProbeConfig) buildClusterClientConfig(logger log.Logger, entries []discovery.ServiceEntry) (*AerospikeClientConfig, error) {
 	authEnabled := conf.AerospikeEndpointConfig.AuthEnabled
 	var (
@@ -110,6 +192,11 @@ func (conf AerospikeProbeConfig) getNamespacesFromEntry(logger log.Logger, entry
 // TODO: we should use a consul dns seed
 func (conf *AerospikeProbeConfig) generateEndpointFromEntry(logger log.Logger, entry discovery.ServiceEntry, clusterConfig *AerospikeClientConfig) *AerospikeEndpoint {
 	namespaceSet := conf.getNamespacesFromEntry(logger, entry)
+	if conf.AerospikeEndpointConfig.NamespaceAutoDiscovery {
+		for _, namespace := range getDiscoveredNamespaces(clusterConfig.clusterName) {
+			namespaceSet[namespace] = struct{}{}
+		}
+	}
 	namespaces := make([]string, 0, len(namespaceSet))
 	for namespace := range namespaceSet {
 		namespaces = append(namespaces, namespace)
@@ -130,11 +217,22 @@ func (conf *AerospikeProbeConfig) BuildTopology(logger log.Logger, entries []dis
 	clusterMap := topology.NewClusterMap()
 
 	clusterEntries := conf.DiscoveryConfig.GroupNodesByCluster(logger, entries)
+	clusters := make(map[string]struct{}, len(clusterEntries))
 	for _, clusterGroup := range clusterEntries {
 		clusterConfig, err := conf.buildClusterClientConfig(logger, clusterGroup)
 		if err != nil {
 			return clusterMap, err
 		}
+		clusters[clusterConfig.clusterName] = struct{}{}
+
+		// Running endpoints refresh the discovered namespaces, the others are discovered here (at
+		// most once per namespaceBootstrapBackoff)
+		if conf.AerospikeEndpointConfig.NamespaceAutoDiscovery && len(getDiscoveredNamespaces(clusterConfig.clusterName)) == 0 &&
+			namespaceBootstrapDue(clusterConfig.clusterName, time.Now()) {
+			if err := bootstrapNamespaces(logger, clusterConfig); err != nil {
+				level.Warn(logger).Log("msg", fmt.Sprintf("Failed to discover namespaces of %s", clusterConfig.clusterName), "err", err)
+			}
+		}
 
 		endpoint := conf.generateEndpointFromEntry(logger, clusterGroup[0], clusterConfig)
 		if len(endpoint.Namespaces) == 0 {
@@ -144,5 +242,16 @@ func (conf *AerospikeProbeConfig) BuildTopology(logger log.Logger, entries []dis
 		cluster := topology.NewCluster(endpoint)
 		clusterMap.AppendCluster(cluster)
 	}
+	evictDiscoveredNamespaces(clusters)
 	return clusterMap, nil
 }
+
+// FindClusterEndpoint returns the endpoint of the given cluster in the topology.
+func FindClusterEndpoint(clusterMap topology.ClusterMap, clusterName string) (*AerospikeEndpoint, error) {
+	for _, cluster := range clusterMap.Clusters {
+		if e, ok := cluster.ClusterEndpoint.(*AerospikeEndpoint); ok && e.ClusterConfig.clusterName == clusterName {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %s not found in service discovery", clusterName)
+}
@@ -1,8 +1,10 @@
 package aerospike
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/criteo/blackbox-prober/pkg/discovery"
 	"github.com/criteo/blackbox-prober/pkg/topology"
@@ -139,3 +141,158 @@ func TestBuildTopologyCreatesSingleEndpointWithSortedNamespaces(t *testing.T) {
 		t.Fatalf("expected sorted namespaces %v, got %v", expectedNamespaces, aerospikeEndpoint.Namespaces)
 	}
 }
+
+func TestFilterNamespaces(t *testing.T) {
+	conf := AerospikeEndpointConfig{
+		NamespaceIncludeRegex: "prod_.*|test",
+		NamespaceExcludeRegex: ".*_tmp",
+	}
+	got, err := conf.filterNamespaces([]string{"prod_a", "prod_b_tmp", "test", "testing", "other"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	expected := []string{"prod_a", "test"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	conf = AerospikeEndpointConfig{NamespaceExcludeRegex: "("}
+	if _, err := conf.filterNamespaces([]string{"foo"}); err == nil {
+		t.Fatal("expected an error for an invalid regex")
+	}
+}
+
+func TestRefreshNamespaces(t *testing.T) {
+	cluster := authTestCluster(t)
+	e := &AerospikeEndpoint{
+		ClusterConfig: &AerospikeClientConfig{
+			clusterName: cluster,
+			genericConfig: &AerospikeEndpointConfig{
+				NamespaceAutoDiscovery: true,
+				NamespaceExcludeRegex:  "bar",
+			},
+		},
+		Logger: log.NewNopLogger(),
+	}
+
+	origTargets := infoTargets
+	defer func() { infoTargets = origTargets }()
+
+	infoTargets = func(_ *AerospikeEndpoint) []infoTarget {
+		return []infoTarget{
+			fakeInfoTarget("A", "10.0.0.1", map[string]string{"namespaces": "foo;bar"}, nil),
+			fakeInfoTarget("B", "10.0.0.2", map[string]string{"namespaces": "baz;foo"}, nil),
+			fakeInfoTarget("C", "10.0.0.3", nil, errors.New("connection refused")),
+		}
+	}
+	if err := e.refreshNamespaces(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	expected := []string{"baz", "foo"}
+	if got := getDiscoveredNamespaces(cluster); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected discovered namespaces %v, got %v", expected, got)
+	}
+
+	// An unreachable cluster must not wipe the previously discovered namespaces.
+	infoTargets = func(_ *AerospikeEndpoint) []infoTarget {
+		return []infoTarget{fakeInfoTarget("A", "10.0.0.1", nil, errors.New("connection refused"))}
+	}
+	if err := e.refreshNamespaces(); err == nil {
+		t.Fatal("expected an error when no node answers")
+	}
+	if got := getDiscoveredNamespaces(cluster); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected discovered namespaces to be kept, got %v", got)
+	}
+}
+
+func TestBuildTopologyWithNamespaceAutoDiscovery(t *testing.T) {
+	config := testProbeConfig()
+	config.AerospikeEndpointConfig.NamespaceAutoDiscovery = true
+	cluster := authTestCluster(t)
+	entries := []discovery.ServiceEntry{
+		{
+			Address: "10.0.0.1",
+			Port:    3000,
+			Meta: map[string]string{
+				"CLUSTER": cluster,
+			},
+		},
+	}
+
+	origBootstrap := bootstrapNamespaces
+	defer func() { bootstrapNamespaces = origBootstrap }()
+
+	// Nothing discovered: the endpoint is not started
+	bootstraps := 0
+	bootstrapNamespaces = func(_ log.Logger, _ *AerospikeClientConfig) error {
+		bootstraps++
+		return errors.New("connection refused")
+	}
+	clusterMap, err := config.BuildTopology(log.NewNopLogger(), entries)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(clusterMap.Clusters) != 0 || bootstraps != 1 {
+		t.Fatalf("expected no endpoint after a failed bootstrap, got %d endpoints and %d bootstraps", len(clusterMap.Clusters), bootstraps)
+	}
+
+	// Not bootstrapped again before the backoff
+	if _, err := config.BuildTopology(log.NewNopLogger(), entries); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if bootstraps != 1 {
+		t.Fatalf("expected no bootstrap before the backoff, got %d bootstraps", bootstraps)
+	}
+	discoveredNamespaces.Lock()
+	discoveredNamespaces.bootstrappedAt[cluster] = time.Now().Add(-namespaceBootstrapBackoff)
+	discoveredNamespaces.Unlock()
+
+	// Namespaces bootstrapped when building the topology, after the backoff
+	bootstrapNamespaces = func(_ log.Logger, clusterConfig *AerospikeClientConfig) error {
+		bootstraps++
+		setDiscoveredNamespaces(clusterConfig.clusterName, []string{"baz"})
+		return nil
+	}
+	clusterMap, err = config.BuildTopology(log.NewNopLogger(), entries)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(clusterMap.Clusters) != 1 {
+		t.Fatalf("expected one cluster endpoint, got %d", len(clusterMap.Clusters))
+	}
+	var previousHash string
+	for hash := range clusterMap.Clusters {
+		previousHash = hash
+	}
+
+	// Refreshed by the running endpoint, no new bootstrap
+	setDiscoveredNamespaces(cluster, []string{"foo"})
+	entries[0].Meta["aerospike-monitoring-bar"] = "true"
+	clusterMap, err = config.BuildTopology(log.NewNopLogger(), entries)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for hash, c := range clusterMap.Clusters {
+		if hash == previousHash {
+			t.Fatal("expected the endpoint hash to change with the discovered namespaces")
+		}
+		expected := []string{"bar", "foo"}
+		if got := c.ClusterEndpoint.(*AerospikeEndpoint).Namespaces; !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected namespaces %v, got %v", expected, got)
+		}
+	}
+	if bootstraps != 2 {
+		t.Fatalf("expected no bootstrap once namespaces are discovered, got %d bootstraps", bootstraps)
+	}
+
+	// Clusters removed from the service discovery are evicted
+	if _, err := config.BuildTopology(log.NewNopLogger(), nil); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got := getDiscoveredNamespaces(cluster); got != nil {
+		t.Fatalf("expected the discovered namespaces to be evicted, got %v", got)
+	}
+	if !namespaceBootstrapDue(cluster, time.Now()) {
+		t.Fatal("expected the bootstrap time to be evicted")
+	}
+}
@@ -0,0 +1,269 @@
+package aerospike
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// durabilityPayloadVersion is the format of the durability items. v1 items only hold the hash
+	// of their key name ("val"); v2 items also hold the format version, the generation of the items,
+	// the write timestamp and the id of the probe which wrote them.
+	durabilityPayloadVersion = 2
+
+	// durabilityModeCheck only reports missing and corrupted items, durabilityModeHeal also
+	// rewrites them after each sweep.
+	durabilityModeCheck = "check"
+	durabilityModeHeal  = "heal"
+)
+
+var durabilityResetTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_durability_reset_timestamp_seconds",
+	Help: "Time of the last (re)write of durability items: initial push, heal or manual reset",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+// durabilityProbeId identifies the probe instance in the items it writes, to investigate
+// unexpected rewrites.
+var durabilityProbeId = func() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
+}()
+
+func durabilityKeyName(conf *AerospikeEndpointConfig, i int) string {
+	return fmt.Sprintf("%s%d", conf.DurabilityKeyPrefix, i)
+}
+
+// durabilityItem is the payload of a durability item.
+func durabilityItem(keyName string, generation int, now time.Time) as.BinMap {
+	return as.BinMap{
+		"val":   hash(keyName),
+		"ver":   durabilityPayloadVersion,
+		"gen":   generation,
+		"ts":    now.Unix(),
+		"probe": durabilityProbeId,
+	}
+}
+
+// durabilityFlagValue is the value of the flag once all items have been pushed (format:key_range).
+// If the probe finds a missmatch it will repush the items.
+func durabilityFlagValue(version int, keyRange int) string {
+	return fmt.Sprintf("v%d:%d", version, keyRange)
+}
+
+// durabilityFlag is the flag item indicating that a probe has pushed all items once.
+type durabilityFlag struct {
+	val        string // v<format>:<key_range>
+	version    int    // format of the items, parsed from val (0 if val is invalid)
+	generation int    // incremented at each (re)write of items
+	resetTs    int64  // unix time of the last (re)write of items
+}
+
+// validateDurabilityItem checks the payload of a durability item against the flag. Items of a v2
+// flag hold the current format version, and were written by one of the (re)writes recorded in the
+// flag: their generation is at most the one of the flag, and they are not more recent than the
+// last (re)write. Items of a v1 flag (or without flag) may predate the metadata, only their value
+// is checked.
+func validateDurabilityItem(keyName string, bins as.BinMap, flag *durabilityFlag) error {
+	if bins["val"] != hash(keyName) {
+		return errors.Errorf("got value '%v', expected '%s'", bins["val"], hash(keyName))
+	}
+	if flag == nil || flag.version < durabilityPayloadVersion {
+		return nil
+	}
+	if bins["ver"] != durabilityPayloadVersion {
+		return errors.Errorf("got format version %v, expected %d", bins["ver"], durabilityPayloadVersion)
+	}
+	if gen, ok := bins["gen"].(int); !ok || gen < 1 || gen > flag.generation {
+		return errors.Errorf("got generation %v, expected 1 to %d", bins["gen"], flag.generation)
+	}
+	if ts, ok := bins["ts"].(int); !ok || ts <= 0 || int64(ts) > flag.resetTs {
+		return errors.Errorf("got write timestamp %v, expected at most the last reset %d", bins["ts"], flag.resetTs)
+	}
+	return nil
+}
+
+func durabilityFlagKey(e *AerospikeEndpoint, namespace string) (*as.Key, error) {
+	conf := e.ClusterConfig.genericConfig
+	return as.NewKey(namespace, conf.MonitoringSet, fmt.Sprintf("%s%s", conf.DurabilityKeyPrefix, "all_pushed_flag"))
+}
+
+// readDurabilityFlag returns a nil flag if items were never pushed.
+func readDurabilityFlag(e *AerospikeEndpoint, namespace string) (*durabilityFlag, error) {
+	key, err := durabilityFlagKey(e, namespace)
+	if err != nil {
+		return nil, err
+	}
+	recVal, as_err := e.Client.Get(durabilityReadPolicy(e), key)
+	if as_err != nil {
+		if as_err.Matches(as.ErrKeyNotFound.ResultCode) {
+			return nil, nil
+		}
+		return nil, as_err
+	}
+	flag := &durabilityFlag{}
+	flag.val, _ = recVal.Bins["val"].(string)
+	if _, err := fmt.Sscanf(flag.val, "v%d:", &flag.version); err != nil {
+		flag.version = 0
+	}
+	flag.generation, _ = recVal.Bins["gen"].(int)
+	if resetTs, ok := recVal.Bins["reset_ts"].(int); ok {
+		flag.resetTs = int64(resetTs)
+	}
+	return flag, nil
+}
+
+func durabilityReadPolicy(e *AerospikeEndpoint) *as.BasePolicy {
+	policy := as.NewPolicy()
+	policy.MaxRetries = 2                                            // 2 is default Client value in v7
+	policy.ReplicaPolicy = as.SEQUENCE                               // SEQUENCE is default Client value (alternate across master/replica in case of errors)
+	policy.TotalTimeout = e.ClusterConfig.genericConfig.TotalTimeout // 0 is default Client value in v7
+	// Do not wait until timeout if connections cannot be open
+	policy.ExitFastOnExhaustedConnectionPool = e.ClusterConfig.genericConfig.ExitFastOnExhaustedConnectionPool
+	return policy
+}
+
+func durabilityWritePolicy(e *AerospikeEndpoint) *as.WritePolicy {
+	policy := as.NewWritePolicy(0, as.TTLDontExpire)                 // No expiration
+	policy.MaxRetries = 2                                            // We can retry for durability (0 is default Client value in v7)
+	policy.TotalTimeout = e.ClusterConfig.genericConfig.TotalTimeout // 0 is default Client value in v7
+	// Do not wait until timeout if connections cannot be open
+	policy.ExitFastOnExhaustedConnectionPool = e.ClusterConfig.genericConfig.ExitFastOnExhaustedConnectionPool
+	return policy
+}
+
+// rewriteDurabilityItems writes the given items with a new generation, then records the reset in
+// the flag. It is used by the initial push, the heal mode and the manual reset.
+func rewriteDurabilityItems(e *AerospikeEndpoint, namespace string, keyNames []string, previous *durabilityFlag) error {
+	policy := durabilityWritePolicy(e)
+	now := time.Now()
+	generation := 1
+	if previous != nil {
+		generation = previous.generation + 1
+	}
+
+	for _, keyName := range keyNames {
+		key, err := as.NewKey(namespace, e.ClusterConfig.genericConfig.MonitoringSet, keyName)
+		if err != nil {
+			return err
+		}
+		val := durabilityItem(keyName, generation, now)
+		if err := e.Client.Put(policy, key, val); err != nil {
+			return errors.Wrapf(err, "record put failed for: %s", keyAsStr(key))
+		}
+		level.Debug(e.Logger).Log("msg", fmt.Sprintf("record durability put: %s (%s)", keyAsStr(key), val["val"]))
+	}
+
+	flagKey, err := durabilityFlagKey(e, namespace)
+	if err != nil {
+		return err
+	}
+	flagVal := as.BinMap{
+		"val":      durabilityFlagValue(durabilityPayloadVersion, e.ClusterConfig.genericConfig.DurabilityKeyTotal),
+		"gen":      generation,
+		"reset_ts": now.Unix(),
+	}
+	if err := e.Client.Put(policy, flagKey, flagVal); err != nil {
+		return errors.Wrapf(err, "Push flag put failed for: %s", keyAsStr(flagKey))
+	}
+	durabilityResetTimestamp.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(float64(now.Unix()))
+	return nil
+}
+
+// durabilitySweep is the result of reading all durability items of a namespace.
+type durabilitySweep struct {
+	found     float64
+	corrupted float64
+	// damaged holds the names of the missing and corrupted items. Items which could not be read
+	// for another reason are not part of it, as their state is unknown.
+	damaged []string
+	// legacy holds the names of the valid items of an older format, to upgrade.
+	legacy []string
+}
+
+// rewritable returns the names of the items to rewrite to heal the namespace: the damaged items,
+// and the legacy ones so that all items match the format of the new flag.
+func (s *durabilitySweep) rewritable() []string {
+	return append(append([]string{}, s.damaged...), s.legacy...)
+}
+
+// sweepDurabilityItems reads all durability items of the namespace and validates them against
+// the flag.
+func sweepDurabilityItems(e *AerospikeEndpoint, namespace string, flag *durabilityFlag) (*durabilitySweep, error) {
+	policy := durabilityReadPolicy(e)
+	sweep := &durabilitySweep{}
+	for i := 0; i < e.ClusterConfig.genericConfig.DurabilityKeyTotal; i++ {
+		keyName := durabilityKeyName(e.ClusterConfig.genericConfig, i)
+		key, err := as.NewKey(namespace, e.ClusterConfig.genericConfig.MonitoringSet, keyName)
+		if err != nil {
+			return nil, err
+		}
+
+		recVal, err := e.Client.Get(policy, key)
+		if err != nil {
+			level.Error(e.Logger).Log("msg", fmt.Sprintf("Error while fetching record: %s", keyAsStr(key)), "err", err)
+			if err.Matches(as.ErrKeyNotFound.ResultCode) {
+				sweep.damaged = append(sweep.damaged, keyName)
+			}
+			continue
+		}
+		if err := validateDurabilityItem(keyName, recVal.Bins, flag); err != nil {
+			level.Warn(e.Logger).Log("msg",
+				fmt.Sprintf("Get successful but the data didn't match what was expected for %s (written by %v at %v)",
+					keyAsStr(key), recVal.Bins["probe"], recVal.Bins["ts"]), "err", err)
+			sweep.corrupted += 1
+			sweep.damaged = append(sweep.damaged, keyName)
+		} else {
+			sweep.found += 1
+			if recVal.Bins["ver"] != durabilityPayloadVersion {
+				sweep.legacy = append(sweep.legacy, keyName)
+			}
+		}
+		level.Debug(e.Logger).Log("msg", fmt.Sprintf("durability record validated: %s (%s)", keyAsStr(key), recVal.Bins["val"]))
+	}
+	return sweep, nil
+}
+
+// DurabilityReset rewrites the missing and corrupted durability items of the given namespaces
+// (all monitored namespaces if empty) after an incident, and records the reset in the flag item
+// (exported as durability_reset_timestamp_seconds). Items still valid are kept.
+func DurabilityReset(p topology.ProbeableEndpoint, namespaces []string) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+	if len(namespaces) == 0 {
+		namespaces = e.Namespaces
+	}
+	if len(namespaces) == 0 {
+		return errors.Errorf("no namespace to reset on %s", e.GetName())
+	}
+
+	for _, namespace := range namespaces {
+		flag, err := readDurabilityFlag(e, namespace)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read durability flag on namespace %s", namespace)
+		}
+		sweep, err := sweepDurabilityItems(e, namespace, flag)
+		if err != nil {
+			return err
+		}
+		rewritable := sweep.rewritable()
+		if err := rewriteDurabilityItems(e, namespace, rewritable, flag); err != nil {
+			return err
+		}
+		level.Info(e.Logger).Log("msg", fmt.Sprintf("Durability reset on namespace %s: %d items rewritten (%d damaged including %d corrupted, %d legacy)",
+			namespace, len(rewritable), len(sweep.damaged), int(sweep.corrupted), len(sweep.legacy)))
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package aerospike
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestDurabilityItem(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	item := durabilityItem("monitoring_durability_1", 3, now)
+	if item["val"] != hash("monitoring_durability_1") {
+		t.Fatalf("expected val to be the hash of the key name, got %v", item["val"])
+	}
+	if item["ver"] != durabilityPayloadVersion || item["gen"] != 3 || item["ts"] != int64(1700000000) || item["probe"] != durabilityProbeId {
+		t.Fatalf("unexpected item metadata %v", item)
+	}
+	if got := durabilityFlagValue(durabilityPayloadVersion, 10000); got != "v2:10000" {
+		t.Fatalf("expected flag v2:10000, got %s", got)
+	}
+}
+
+func TestValidateDurabilityItem(t *testing.T) {
+	keyName := "monitoring_durability_1"
+	v2Flag := &durabilityFlag{val: "v2:10", version: 2, generation: 2, resetTs: 1700000100}
+	v1Flag := &durabilityFlag{val: "v1:10", version: 1}
+	// Bins as read from the server, integers are returned as int
+	item := func(update func(as.BinMap)) as.BinMap {
+		bins := as.BinMap{"val": hash(keyName), "ver": 2, "gen": 1, "ts": 1700000000, "probe": "probe-1"}
+		if update != nil {
+			update(bins)
+		}
+		return bins
+	}
+	for name, tc := range map[string]struct {
+		bins as.BinMap
+		flag *durabilityFlag
+		err  string
+	}{
+		"valid":                 {item(nil), v2Flag, ""},
+		"last generation":       {item(func(b as.BinMap) { b["gen"], b["ts"] = 2, 1700000100 }), v2Flag, ""},
+		"wrong value":           {item(func(b as.BinMap) { b["val"] = "garbage" }), v2Flag, "got value 'garbage'"},
+		"v1 item":               {as.BinMap{"val": hash(keyName)}, v2Flag, "got format version <nil>"},
+		"generation after flag": {item(func(b as.BinMap) { b["gen"] = 3 }), v2Flag, "got generation 3, expected 1 to 2"},
+		"invalid generation":    {item(func(b as.BinMap) { b["gen"] = 0 }), v2Flag, "got generation 0"},
+		"written after reset":   {item(func(b as.BinMap) { b["ts"] = 1700000101 }), v2Flag, "got write timestamp 1700000101"},
+		"missing timestamp":     {item(func(b as.BinMap) { delete(b, "ts") }), v2Flag, "got write timestamp <nil>"},
+		"v1 item of v1 flag":    {as.BinMap{"val": hash(keyName)}, v1Flag, ""},
+		"wrong value v1 flag":   {as.BinMap{"val": "garbage"}, v1Flag, "got value 'garbage'"},
+		"v1 item without flag":  {as.BinMap{"val": hash(keyName)}, nil, ""},
+	} {
+		err := validateDurabilityItem(keyName, tc.bins, tc.flag)
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: expected nil error, got %v", name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: expected error %q, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestDurabilityPrepareUpgradesV1Standin(t *testing.T) {
+	standin := newStandinCluster(t, 1, "ns1")
+	e := standin.standinEndpoint(t, "", "", nil)
+	conf := e.ClusterConfig.genericConfig
+	found := func() float64 {
+		return testutil.ToFloat64(durabilityFoundItems.WithLabelValues("ns1", e.ClusterConfig.clusterName, e.GetName()))
+	}
+	corrupted := func() float64 {
+		return testutil.ToFloat64(durabilityCorruptedItems.WithLabelValues("ns1", e.ClusterConfig.clusterName, e.GetName()))
+	}
+
+	// Items pushed by a v1 probe, one of them lost and one corrupted since
+	putKey := func(key *as.Key, bins as.BinMap) {
+		if err := e.Client.Put(durabilityWritePolicy(e), key, bins); err != nil {
+			t.Fatalf("failed to put %s: %v", keyAsStr(key), err)
+		}
+	}
+	put := func(keyName string, bins as.BinMap) {
+		key, _ := as.NewKey("ns1", conf.MonitoringSet, keyName)
+		putKey(key, bins)
+	}
+	for i := 0; i < conf.DurabilityKeyTotal; i++ {
+		keyName := durabilityKeyName(conf, i)
+		switch i {
+		case 4:
+		case 7:
+			put(keyName, as.BinMap{"val": "garbage"})
+		default:
+			put(keyName, as.BinMap{"val": hash(keyName)})
+		}
+	}
+	flagKey, _ := durabilityFlagKey(e, "ns1")
+	putKey(flagKey, as.BinMap{"val": durabilityFlagValue(1, conf.DurabilityKeyTotal)})
+
+	if err := DurabilityCheck(e); err != nil || found() != 18 || corrupted() != 1 {
+		t.Fatalf("expected 18 found and 1 corrupted v1 items, got %v and %v (err: %v)", found(), corrupted(), err)
+	}
+
+	// The upgrade rewrites the valid items only: the loss is still reported
+	if err := DurabilityPrepare(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	flag, err := readDurabilityFlag(e, "ns1")
+	if err != nil || flag == nil || flag.version != durabilityPayloadVersion || flag.generation != 1 {
+		t.Fatalf("expected a v2 flag of generation 1, got %+v (err: %v)", flag, err)
+	}
+	if got := standin.recordCount("ns1"); got != conf.DurabilityKeyTotal {
+		t.Fatalf("expected the missing item not to be pushed, got %d records", got)
+	}
+	if err := DurabilityCheck(e); err != nil || found() != 18 || corrupted() != 1 {
+		t.Fatalf("expected 18 found and 1 corrupted items after the upgrade, got %v and %v (err: %v)", found(), corrupted(), err)
+	}
+
+	// The metadata of the upgraded items is now validated
+	standin.dropRecord("ns1", conf.MonitoringSet, durabilityKeyName(conf, 2))
+	put(durabilityKeyName(conf, 2), as.BinMap{"val": hash(durabilityKeyName(conf, 2))})
+	put(durabilityKeyName(conf, 3), durabilityItem(durabilityKeyName(conf, 3), 5, time.Now()))
+	if err := DurabilityCheck(e); err != nil || found() != 16 || corrupted() != 3 {
+		t.Fatalf("expected 16 found and 3 corrupted items, got %v and %v (err: %v)", found(), corrupted(), err)
+	}
+}
+
+func TestDurabilityModeConfig(t *testing.T) {
+	config := AerospikeEndpointConfig{}
+	if err := yaml.Unmarshal([]byte("monitoring_set: foo"), &config); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if config.DurabilityMode != durabilityModeCheck {
+		t.Fatalf("expected default durability mode %s, got %s", durabilityModeCheck, config.DurabilityMode)
+	}
+	if err := yaml.Unmarshal([]byte("durability_mode: heal"), &config); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err := yaml.Unmarshal([]byte("durability_mode: fix"), &config); err == nil {
+		t.Fatalf("expected an error for an unknown durability mode")
+	}
+}
+
+func TestFindClusterEndpoint(t *testing.T) {
+	clusterMap := topology.NewClusterMap()
+	for _, name := range []string{"foo", "bar"} {
+		clusterMap.AppendCluster(topology.NewCluster(&AerospikeEndpoint{Name: name, ClusterConfig: &AerospikeClientConfig{clusterName: name}}))
+	}
+
+	e, err := FindClusterEndpoint(clusterMap, "bar")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if e.GetName() != "bar" {
+		t.Fatalf("expected endpoint bar, got %s", e.GetName())
+	}
+	if _, err := FindClusterEndpoint(clusterMap, "unknown"); err == nil {
+		t.Fatalf("expected an error for an unknown cluster")
+	}
+}
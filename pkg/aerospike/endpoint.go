@@ -3,21 +3,18 @@ package aerospike
 import (
 	"crypto/tls"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/pkg/errors"
 
 	as "github.com/aerospike/aerospike-client-go/v8"
 )
 
-var clusterStats = promauto.NewGaugeVec(prometheus.GaugeOpts{
-	Name: ASSuffix + "_aerospike_client_cluster_stats",
-	Help: "Cluster aggregated metrics from the go aerospike client",
-}, []string{"cluster", "probe_endpoint", "name"})
-
 type AerospikeEndpoint struct {
 	Name          string
 	ClusterLevel  bool
@@ -26,6 +23,23 @@ type AerospikeEndpoint struct {
 	ClusterConfig *AerospikeClientConfig
 	Logger        log.Logger
 	Namespaces    []string // Namespaces monitored on this cluster
+
+	// Rack-aware latency: one client per rack, and the racks of each namespace
+	rackLock    sync.RWMutex
+	rackClients map[int]*sharedRackClient
+	racks       map[string][]int
+
+	// Latency check position in the partition key ring of each namespace
+	ringLock    sync.Mutex
+	ringCursors map[string]*ringCursor
+
+	// Records of the expiration check of each namespace, waiting for their expiration
+	expirationLock    sync.Mutex
+	expirationRecords map[string][]expirationRecord
+
+	// Last partition map update seen in the client stats (only used by Refresh)
+	partitionMapUpdates   float64
+	partitionMapUpdatedAt time.Time
 }
 
 func (e *AerospikeEndpoint) GetHash() string {
@@ -42,42 +56,9 @@ func (e *AerospikeEndpoint) IsCluster() bool {
 	return e.ClusterLevel
 }
 
-func (e *AerospikeEndpoint) setMetricFromASStats(stats map[string]interface{}, key string) {
-	val, ok := stats[key]
-	if !ok {
-		return
-	}
-
-	value, ok := val.(float64)
-	if !ok {
-		return
-	}
-
-	clusterStats.WithLabelValues(e.ClusterConfig.clusterName, e.GetName(), key).Set(value)
-}
-
-func (e *AerospikeEndpoint) refreshMetrics() {
-	stats, err := e.Client.Stats()
-	cluster_stats := stats["cluster-aggregated-stats"].(map[string]interface{})
-	if err != nil {
-		level.Error(e.Logger).Log("msg", "Failed to pull metrics from aerospike client", "err", err)
-		return
-	}
-	e.setMetricFromASStats(cluster_stats, "open-connections")
-	e.setMetricFromASStats(cluster_stats, "closed-connections")
-	e.setMetricFromASStats(cluster_stats, "connections-attempts")
-	e.setMetricFromASStats(cluster_stats, "connections-successful")
-	e.setMetricFromASStats(cluster_stats, "connections-failed")
-	e.setMetricFromASStats(cluster_stats, "connections-pool-empty")
-	e.setMetricFromASStats(cluster_stats, "node-added-count")
-	e.setMetricFromASStats(cluster_stats, "node-removed-count")
-	e.setMetricFromASStats(cluster_stats, "partition-map-updates")
-	e.setMetricFromASStats(cluster_stats, "tends-total")
-	e.setMetricFromASStats(cluster_stats, "tends-successful")
-	e.setMetricFromASStats(cluster_stats, "tends-failed")
-}
-
-func (e *AerospikeEndpoint) Connect() error {
+// clientPolicy builds the policy used by the clients of the endpoint (auth, TLS, timeouts,
+// connection pool sized for the probe concurrency).
+func (e *AerospikeEndpoint) clientPolicy() *as.ClientPolicy {
 	clientPolicy := as.NewClientPolicy()
 
 	// Dynamically adjust the pool from the expected probe concurrency. Latency uses CPU-aware
@@ -116,8 +97,11 @@ func (e *AerospikeEndpoint) Connect() error {
 		clientPolicy.User = e.ClusterConfig.username
 		clientPolicy.Password = e.ClusterConfig.password
 	}
+	return clientPolicy
+}
 
-	client, err := as.NewClientWithPolicyAndHost(clientPolicy, e.ClusterConfig.hosts...)
+func (e *AerospikeEndpoint) Connect() error {
+	client, err := as.NewClientWithPolicyAndHost(e.clientPolicy(), e.ClusterConfig.hosts...)
 	if err != nil {
 		return err
 	}
@@ -126,12 +110,78 @@ func (e *AerospikeEndpoint) Connect() error {
 	return nil
 }
 
+// Refresh exports the client metrics, then refreshes the racks and the discovered namespaces when
+// enabled. A failed refresh does not prevent the next ones: their errors are combined.
 func (e *AerospikeEndpoint) Refresh() error {
 	e.refreshMetrics()
+
+	type refresh struct {
+		name    string
+		refresh func() error
+	}
+	refreshes := []refresh{}
+	if e.ClusterConfig.genericConfig.RackAwareLatency {
+		refreshes = append(refreshes, refresh{"racks", e.refreshRacks})
+	}
+	if e.ClusterConfig.genericConfig.NamespaceAutoDiscovery {
+		refreshes = append(refreshes, refresh{"namespaces", e.refreshNamespaces})
+	}
+
+	errs := []string{}
+	for _, r := range refreshes {
+		if err := r.refresh(); err != nil {
+			level.Error(e.Logger).Log("msg", "Failed to refresh "+r.name, "err", err)
+			errs = append(errs, fmt.Sprintf("refresh %s: %v", r.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// refreshNamespaces lists the namespaces of every live node and records the filtered set for
+// the next topology update. The endpoint itself is not modified: its hash identifies the running
+// worker, so a new namespace set is picked up by replacing the endpoint (and worker) instead.
+func (e *AerospikeEndpoint) refreshNamespaces() error {
+	namespaceSet := make(map[string]struct{})
+	answered := 0
+	for _, target := range infoTargets(e) {
+		res, err := target.info("namespaces")
+		if err != nil {
+			level.Warn(e.Logger).Log("msg", fmt.Sprintf("Failed to list namespaces on %s (%s)", target.nodeId, target.ip), "err", err)
+			continue
+		}
+		answered++
+		for _, namespace := range parseInfoList(res["namespaces"]) {
+			namespaceSet[namespace] = struct{}{}
+		}
+	}
+	// Keep the previous set rather than dropping every namespace if the cluster is unreachable
+	if answered == 0 {
+		return errors.Errorf("namespace discovery failed: no node answered")
+	}
+
+	namespaces := make([]string, 0, len(namespaceSet))
+	for namespace := range namespaceSet {
+		namespaces = append(namespaces, namespace)
+	}
+	namespaces, err := e.ClusterConfig.genericConfig.filterNamespaces(namespaces)
+	if err != nil {
+		return err
+	}
+	sort.Strings(namespaces)
+
+	if setDiscoveredNamespaces(e.ClusterConfig.clusterName, namespaces) {
+		level.Info(e.Logger).Log("msg", fmt.Sprintf("Discovered namespaces changed, probing will restart at next topology update: %s", strings.Join(namespaces, ",")))
+	}
 	return nil
 }
 
 func (e *AerospikeEndpoint) Close() error {
+	if e != nil {
+		e.closeRackClients()
+	}
 	if e != nil && e.Client != nil {
 		e.Client.Close()
 	}
@@ -0,0 +1,155 @@
+package aerospike
+
+import (
+	"fmt"
+	"time"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// expirationTolerance absorbs the second granularity of record void times.
+const expirationTolerance = time.Second
+
+var expirationEarlyTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: ASSuffix + "_expiration_early_total",
+	Help: "Total number of records gone before their TTL expired",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+var expirationLateTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: ASSuffix + "_expiration_late_total",
+	Help: "Total number of records still readable after their TTL expired plus the grace period (clock skew between the probe and the server)",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+// expirationRecord is a record written with a known TTL, checked at each interval until it
+// expires.
+type expirationRecord struct {
+	key *as.Key
+	// Written before the put: the server void time cannot be earlier
+	expiresAt time.Time
+}
+
+type expirationOutcome int
+
+const (
+	expirationPending expirationOutcome = iota // not expired yet (or within the grace period)
+	expirationEarly                            // gone before its expiration
+	expirationExpired                          // gone after its expiration
+	expirationLate                             // still readable after the grace period
+)
+
+// classifyExpiration returns the state of a record given whether it still exists.
+//
+// The server hides the records whose void time has passed on read, whether or not nsup has
+// evicted them yet. So a record readable after its expiration means the server clock is behind
+// the probe clock (or the void time was not set), not a late eviction, and the time at which an
+// expired record is seen gone only depends on the check interval: it is not measured.
+func classifyExpiration(rec expirationRecord, exists bool, now time.Time, grace time.Duration) expirationOutcome {
+	if !exists {
+		if now.Before(rec.expiresAt.Add(-expirationTolerance)) {
+			return expirationEarly
+		}
+		return expirationExpired
+	}
+	if now.After(rec.expiresAt.Add(grace)) {
+		return expirationLate
+	}
+	return expirationPending
+}
+
+func (e *AerospikeEndpoint) getExpirationRecords(namespace string) []expirationRecord {
+	e.expirationLock.Lock()
+	defer e.expirationLock.Unlock()
+	return e.expirationRecords[namespace]
+}
+
+func (e *AerospikeEndpoint) setExpirationRecords(namespace string, records []expirationRecord) {
+	e.expirationLock.Lock()
+	defer e.expirationLock.Unlock()
+	if e.expirationRecords == nil {
+		e.expirationRecords = make(map[string][]expirationRecord)
+	}
+	e.expirationRecords[namespace] = records
+}
+
+// ExpirationCheck writes a record with a short known TTL at each interval on every monitored
+// namespace, and checks the records written by previous runs: they must be readable until their
+// expiration and gone at most expiration_grace_period after it. As expired records are hidden on
+// read, this catches records lost before their expiration and clock skew between the probe and
+// the server, not the eviction lag of nsup (see classifyExpiration).
+func ExpirationCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+	return forEachNamespace(e, namespaceCheckParallelism(len(e.Namespaces)), func(namespace string) error {
+		return expirationCheckNamespace(e, namespace)
+	})
+}
+
+func expirationCheckNamespace(e *AerospikeEndpoint, namespace string) error {
+	conf := e.ClusterConfig.genericConfig
+	labels := []string{namespace, e.ClusterConfig.clusterName, e.GetName()}
+	// Force creation of metrics
+	expirationEarlyTotal.WithLabelValues(labels...).Add(0)
+	expirationLateTotal.WithLabelValues(labels...).Add(0)
+
+	policy := as.NewWritePolicy(0, uint32(conf.ExpirationTTL.Seconds()))
+	policy.MaxRetries = 0                   // Ensure we never retry (0 is default Client value in v7)
+	policy.TotalTimeout = conf.TotalTimeout // 0 is default Client value in v7
+	// Do not wait until timeout if connections cannot be open
+	policy.ExitFastOnExhaustedConnectionPool = conf.ExitFastOnExhaustedConnectionPool
+
+	// Records written by previous runs (a record failing to be read is checked again next time)
+	var firstErr error
+	pending := []expirationRecord{}
+	for _, rec := range e.getExpirationRecords(namespace) {
+		exists, err := e.Client.Exists(&policy.BasePolicy, rec.key)
+		if err != nil {
+			pending = append(pending, rec)
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "record exists failed for: %s", keyAsStr(rec.key))
+			}
+			continue
+		}
+		switch classifyExpiration(rec, exists, time.Now(), conf.ExpirationGracePeriod) {
+		case expirationPending:
+			pending = append(pending, rec)
+		case expirationEarly:
+			level.Warn(e.Logger).Log("msg", fmt.Sprintf("Record gone %s before its expiration: %s", time.Until(rec.expiresAt).Round(time.Second), keyAsStr(rec.key)))
+			expirationEarlyTotal.WithLabelValues(labels...).Inc()
+		case expirationExpired:
+			level.Debug(e.Logger).Log("msg", fmt.Sprintf("record expired: %s", keyAsStr(rec.key)))
+		case expirationLate:
+			level.Warn(e.Logger).Log("msg", fmt.Sprintf("Record still readable %s after its expiration: %s", time.Since(rec.expiresAt).Round(time.Second), keyAsStr(rec.key)))
+			expirationLateTotal.WithLabelValues(labels...).Inc()
+			// Best effort, so the record does not stay forever
+			if _, err := e.Client.Delete(policy, rec.key); err != nil {
+				level.Error(e.Logger).Log("msg", fmt.Sprintf("Failed to delete late record: %s", keyAsStr(rec.key)), "err", err)
+			}
+		}
+	}
+
+	// New record
+	key, as_err := as.NewKey(namespace, conf.MonitoringSet, fmt.Sprintf("%s%s", conf.ExpirationKeyPrefix, utils.RandomHex(20)))
+	if as_err != nil {
+		e.setExpirationRecords(namespace, pending)
+		return as_err
+	}
+	expiresAt := time.Now().Add(conf.ExpirationTTL)
+	if err := e.Client.Put(policy, key, as.BinMap{"val": hash(key.Value().String())}); err != nil {
+		if firstErr == nil {
+			firstErr = errors.Wrapf(err, "record put failed for: %s", keyAsStr(key))
+		}
+	} else {
+		pending = append(pending, expirationRecord{key: key, expiresAt: expiresAt})
+		level.Debug(e.Logger).Log("msg", fmt.Sprintf("record put with ttl %s: %s", conf.ExpirationTTL, keyAsStr(key)))
+	}
+	e.setExpirationRecords(namespace, pending)
+	return firstErr
+}
@@ -0,0 +1,63 @@
+package aerospike
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestClassifyExpiration(t *testing.T) {
+	expiresAt := time.Unix(1700000060, 0)
+	rec := expirationRecord{expiresAt: expiresAt}
+	grace := time.Minute
+
+	tests := []struct {
+		name     string
+		exists   bool
+		now      time.Time
+		expected expirationOutcome
+	}{
+		{"readable before expiration", true, expiresAt.Add(-30 * time.Second), expirationPending},
+		{"readable within grace period", true, expiresAt.Add(30 * time.Second), expirationPending},
+		{"readable after grace period", true, expiresAt.Add(61 * time.Second), expirationLate},
+		{"gone before expiration", false, expiresAt.Add(-30 * time.Second), expirationEarly},
+		{"gone within void time granularity", false, expiresAt.Add(-500 * time.Millisecond), expirationExpired},
+		{"gone after expiration", false, expiresAt.Add(12 * time.Second), expirationExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if outcome := classifyExpiration(rec, tt.exists, tt.now, grace); outcome != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, outcome)
+			}
+		})
+	}
+}
+
+func TestExpirationRecords(t *testing.T) {
+	e := &AerospikeEndpoint{}
+	if got := e.getExpirationRecords("foo"); len(got) != 0 {
+		t.Fatalf("expected no record, got %v", got)
+	}
+	records := []expirationRecord{{expiresAt: time.Now()}}
+	e.setExpirationRecords("foo", records)
+	if got := e.getExpirationRecords("foo"); len(got) != 1 {
+		t.Fatalf("expected 1 record, got %v", got)
+	}
+	if got := e.getExpirationRecords("bar"); len(got) != 0 {
+		t.Fatalf("expected namespaces to be independent, got %v", got)
+	}
+}
+
+func TestExpirationConfig(t *testing.T) {
+	config := AerospikeEndpointConfig{}
+	if err := yaml.Unmarshal([]byte("expiration_grace_period: 0s"), &config); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err := yaml.Unmarshal([]byte("expiration_grace_period: -1s"), &config); err == nil {
+		t.Fatalf("expected an error for a negative grace period")
+	}
+	if err := yaml.Unmarshal([]byte("expiration_ttl: 500ms"), &config); err == nil {
+		t.Fatalf("expected an error for a TTL below 1s")
+	}
+}
@@ -0,0 +1,165 @@
+package aerospike
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// Membership is checked independently of migrations (exported separately).
+	infoClusterStable = "cluster-stable:ignore-migrations=true"
+	infoStatistics    = "statistics"
+)
+
+var clusterSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_cluster_size",
+	Help: "Cluster size as reported by each node",
+}, []string{"cluster", "endpoint", "node_id"})
+
+var clusterStable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_cluster_stable",
+	Help: "1 if the node reports a stable cluster membership (cluster-stable), 0 otherwise",
+}, []string{"cluster", "endpoint", "node_id"})
+
+var clusterSizeDisagreement = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_cluster_size_disagreement",
+	Help: "1 if the nodes of the cluster disagree on the cluster size or cluster key, 0 otherwise",
+}, []string{"cluster"})
+
+var migratePartitionsRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_migrate_partitions_remaining",
+	Help: "Number of partitions remaining to migrate as reported by each node",
+}, []string{"cluster", "endpoint", "node_id"})
+
+var namespaceStopWrites = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_namespace_stop_writes",
+	Help: "1 if the namespace is in stop-writes on the node, 0 otherwise",
+}, []string{"cluster", "namespace", "endpoint", "node_id"})
+
+var namespaceHWMBreached = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_namespace_hwm_breached",
+	Help: "1 if the namespace breached its high water mark (evictions) on the node, 0 otherwise",
+}, []string{"cluster", "namespace", "endpoint", "node_id"})
+
+// nodeHealth is the cluster health as seen by a single node.
+type nodeHealth struct {
+	target     infoTarget
+	stable     bool
+	clusterKey string
+	size       float64
+	migrations float64
+	stopWrites map[string]float64 // per namespace
+	hwm        map[string]float64 // per namespace
+}
+
+func fetchNodeHealth(target infoTarget, namespaces []string) (*nodeHealth, error) {
+	commands := []string{infoClusterStable, infoStatistics}
+	for _, namespace := range namespaces {
+		commands = append(commands, "namespace/"+namespace)
+	}
+	res, err := target.info(commands...)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &nodeHealth{
+		target:     target,
+		stopWrites: make(map[string]float64, len(namespaces)),
+		hwm:        make(map[string]float64, len(namespaces)),
+	}
+
+	if key, ok := res[infoClusterStable]; ok && !isInfoError(key) {
+		health.stable = true
+		health.clusterKey = key
+	}
+
+	stats := parseInfoKV(res[infoStatistics])
+	size, err := strconv.ParseFloat(stats["cluster_size"], 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cluster_size in statistics")
+	}
+	health.size = size
+	// Absent from statistics when the server does not track it, reported as 0 in that case
+	if migrations, err := strconv.ParseFloat(stats["migrate_partitions_remaining"], 64); err == nil {
+		health.migrations = migrations
+	}
+
+	for _, namespace := range namespaces {
+		nsStats := parseInfoKV(res["namespace/"+namespace])
+		health.stopWrites[namespace] = infoBool(nsStats["stop_writes"])
+		health.hwm[namespace] = infoBool(nsStats["hwm_breached"])
+	}
+	return health, nil
+}
+
+// ClusterHealthCheck runs info commands on every live node and exports the cluster state as seen
+// by each node: cluster size and stability, partitions remaining to migrate, and stop-writes /
+// HWM-breach flags for each monitored namespace. Nodes disagreeing on the cluster size or key
+// (e.g. split brain) are reported through cluster_size_disagreement.
+func ClusterHealthCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+
+	var firstErr error
+	healths := []*nodeHealth{}
+	for _, target := range infoTargets(e) {
+		health, err := fetchNodeHealth(target, e.Namespaces)
+		if err != nil {
+			level.Error(e.Logger).Log("msg", fmt.Sprintf("Failed to fetch cluster health from %s (%s)", target.nodeId, target.ip), "err", err)
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "cluster health info failed on %s (%s)", target.nodeId, target.ip)
+			}
+			continue
+		}
+		healths = append(healths, health)
+	}
+
+	e.exportClusterHealth(healths)
+	return firstErr
+}
+
+// exportClusterHealth replaces the per-node health series of the cluster, so nodes that left the
+// cluster (or did not answer) do not keep exporting their last known state.
+func (e *AerospikeEndpoint) exportClusterHealth(healths []*nodeHealth) {
+	clusterName := e.ClusterConfig.clusterName
+	for _, vec := range []*prometheus.GaugeVec{clusterSize, clusterStable, migratePartitionsRemaining, namespaceStopWrites, namespaceHWMBreached} {
+		vec.DeletePartialMatch(prometheus.Labels{"cluster": clusterName})
+	}
+
+	sizes := make(map[float64]struct{})
+	keys := make(map[string]struct{})
+	for _, health := range healths {
+		nodeLabels := []string{clusterName, health.target.ip, health.target.nodeId}
+		clusterSize.WithLabelValues(nodeLabels...).Set(health.size)
+		migratePartitionsRemaining.WithLabelValues(nodeLabels...).Set(health.migrations)
+		if health.stable {
+			clusterStable.WithLabelValues(nodeLabels...).Set(1)
+			keys[health.clusterKey] = struct{}{}
+		} else {
+			clusterStable.WithLabelValues(nodeLabels...).Set(0)
+		}
+		sizes[health.size] = struct{}{}
+
+		for namespace, stopWrites := range health.stopWrites {
+			namespaceStopWrites.WithLabelValues(clusterName, namespace, health.target.ip, health.target.nodeId).Set(stopWrites)
+		}
+		for namespace, hwm := range health.hwm {
+			namespaceHWMBreached.WithLabelValues(clusterName, namespace, health.target.ip, health.target.nodeId).Set(hwm)
+		}
+	}
+
+	if len(sizes) > 1 || len(keys) > 1 {
+		level.Warn(e.Logger).Log("msg", fmt.Sprintf("Nodes disagree on the cluster membership (%d distinct sizes, %d distinct keys)", len(sizes), len(keys)))
+		clusterSizeDisagreement.WithLabelValues(clusterName).Set(1)
+	} else {
+		clusterSizeDisagreement.WithLabelValues(clusterName).Set(0)
+	}
+}
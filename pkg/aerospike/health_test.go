@@ -0,0 +1,133 @@
+package aerospike
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseInfoKV(t *testing.T) {
+	got := parseInfoKV("cluster_size=3;migrate_partitions_remaining=12;;invalid;empty=")
+	expected := map[string]string{
+		"cluster_size":                 "3",
+		"migrate_partitions_remaining": "12",
+		"empty":                        "",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+// fakeInfoTarget returns an infoTarget answering every command from responses.
+func fakeInfoTarget(nodeId, ip string, responses map[string]string, err error) infoTarget {
+	return infoTarget{
+		nodeId: nodeId,
+		ip:     ip,
+		info: func(commands ...string) (map[string]string, error) {
+			if err != nil {
+				return nil, err
+			}
+			res := make(map[string]string, len(commands))
+			for _, command := range commands {
+				res[command] = responses[command]
+			}
+			return res, nil
+		},
+	}
+}
+
+func TestClusterHealthCheck(t *testing.T) {
+	cluster := authTestCluster(t)
+	e := &AerospikeEndpoint{
+		ClusterConfig: &AerospikeClientConfig{clusterName: cluster, genericConfig: &AerospikeEndpointConfig{}},
+		Logger:        log.NewNopLogger(),
+		Namespaces:    []string{"foo"},
+	}
+
+	// A stale series from a node that left the cluster; the check must clean it up.
+	clusterSize.WithLabelValues(cluster, "10.9.9.9", "Z").Set(3)
+
+	origTargets := infoTargets
+	defer func() { infoTargets = origTargets }()
+
+	infoTargets = func(_ *AerospikeEndpoint) []infoTarget {
+		return []infoTarget{
+			fakeInfoTarget("A", "10.0.0.1", map[string]string{
+				infoClusterStable: "ABCDEF",
+				infoStatistics:    "cluster_size=2;migrate_partitions_remaining=0",
+				"namespace/foo":   "stop_writes=false;hwm_breached=false",
+			}, nil),
+			fakeInfoTarget("B", "10.0.0.2", map[string]string{
+				infoClusterStable: "ERROR::unstable-cluster",
+				infoStatistics:    "cluster_size=1;migrate_partitions_remaining=42",
+				"namespace/foo":   "stop_writes=true;hwm_breached=true",
+			}, nil),
+		}
+	}
+
+	if err := ClusterHealthCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if got := testutil.ToFloat64(clusterSizeDisagreement.WithLabelValues(cluster)); got != 1 {
+		t.Errorf("expected a cluster size disagreement, got %v", got)
+	}
+	if got := testutil.ToFloat64(clusterStable.WithLabelValues(cluster, "10.0.0.1", "A")); got != 1 {
+		t.Errorf("node A: expected stable cluster, got %v", got)
+	}
+	if got := testutil.ToFloat64(clusterStable.WithLabelValues(cluster, "10.0.0.2", "B")); got != 0 {
+		t.Errorf("node B: expected unstable cluster, got %v", got)
+	}
+	if got := testutil.ToFloat64(migratePartitionsRemaining.WithLabelValues(cluster, "10.0.0.2", "B")); got != 42 {
+		t.Errorf("node B: expected 42 partitions remaining, got %v", got)
+	}
+	if got := testutil.ToFloat64(namespaceStopWrites.WithLabelValues(cluster, "foo", "10.0.0.2", "B")); got != 1 {
+		t.Errorf("node B: expected stop-writes, got %v", got)
+	}
+	if got := testutil.ToFloat64(namespaceHWMBreached.WithLabelValues(cluster, "foo", "10.0.0.1", "A")); got != 0 {
+		t.Errorf("node A: expected no HWM breach, got %v", got)
+	}
+	// Deleting reports whether the series existed: live nodes are exported, the stale one is gone.
+	for _, node := range []string{"10.0.0.1", "10.0.0.2", "10.9.9.9"} {
+		found := clusterSize.DeletePartialMatch(map[string]string{"cluster": cluster, "endpoint": node}) > 0
+		if expected := node != "10.9.9.9"; found != expected {
+			t.Errorf("node %s: expected series present=%v, got %v", node, expected, found)
+		}
+	}
+}
+
+// TestClusterHealthCheckNodeFailure verifies that a node failing to answer fails the check
+// without preventing the other nodes from being reported.
+func TestClusterHealthCheckNodeFailure(t *testing.T) {
+	cluster := authTestCluster(t)
+	e := &AerospikeEndpoint{
+		ClusterConfig: &AerospikeClientConfig{clusterName: cluster, genericConfig: &AerospikeEndpointConfig{}},
+		Logger:        log.NewNopLogger(),
+	}
+
+	origTargets := infoTargets
+	defer func() { infoTargets = origTargets }()
+
+	infoTargets = func(_ *AerospikeEndpoint) []infoTarget {
+		return []infoTarget{
+			fakeInfoTarget("A", "10.1.0.1", nil, errors.New("connection refused")),
+			fakeInfoTarget("B", "10.1.0.2", map[string]string{
+				infoClusterStable: "ABCDEF",
+				infoStatistics:    "cluster_size=2",
+			}, nil),
+		}
+	}
+
+	if err := ClusterHealthCheck(e); err == nil {
+		t.Fatal("expected an error when a node does not answer")
+	}
+	if got := testutil.ToFloat64(clusterSize.WithLabelValues(cluster, "10.1.0.2", "B")); got != 2 {
+		t.Errorf("node B: expected cluster size 2, got %v", got)
+	}
+	if got := testutil.ToFloat64(clusterSizeDisagreement.WithLabelValues(cluster)); got != 0 {
+		t.Errorf("expected no disagreement, got %v", got)
+	}
+}
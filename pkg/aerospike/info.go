@@ -0,0 +1,85 @@
+package aerospike
+
+import (
+	"strconv"
+	"strings"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+)
+
+// infoTarget is a single live node on which info commands can be run.
+type infoTarget struct {
+	nodeId string
+	ip     string
+	// info runs the given info commands on the node and returns the raw responses keyed by
+	// command name.
+	info func(commands ...string) (map[string]string, error)
+}
+
+// infoTargets is indirected through a package variable so unit tests can mock the info
+// responses without a live cluster.
+var infoTargets = func(e *AerospikeEndpoint) []infoTarget {
+	policy := as.NewInfoPolicy()
+	if e.ClusterConfig.genericConfig.TotalTimeout > 0 {
+		policy.Timeout = e.ClusterConfig.genericConfig.TotalTimeout
+	}
+
+	nodes := e.Client.Cluster().GetNodes()
+	targets := make([]infoTarget, 0, len(nodes))
+	for _, node := range nodes {
+		node := node
+		targets = append(targets, infoTarget{
+			nodeId: node.GetName(),
+			ip:     node.GetHost().Name,
+			info: func(commands ...string) (map[string]string, error) {
+				res, err := node.RequestInfo(policy, commands...)
+				if err != nil {
+					return nil, err
+				}
+				return res, nil
+			},
+		})
+	}
+	return targets
+}
+
+// parseInfoKV parses an info response made of `key=value` pairs separated by `;`
+// (e.g. the output of `statistics` or `namespace/<ns>`).
+func parseInfoKV(response string) map[string]string {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(response, ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res
+}
+
+// parseInfoList parses an info response made of values separated by `;` (e.g. the output of
+// `namespaces`), dropping empty entries.
+func parseInfoList(response string) []string {
+	res := []string{}
+	for _, value := range strings.Split(response, ";") {
+		if value = strings.TrimSpace(value); value != "" {
+			res = append(res, value)
+		}
+	}
+	return res
+}
+
+// isInfoError returns true if the info response is an error reported by the server
+// (e.g. `ERROR::unstable-cluster`).
+func isInfoError(response string) bool {
+	return strings.HasPrefix(strings.ToUpper(response), "ERROR")
+}
+
+// infoBool converts an info boolean value into a gauge value.
+func infoBool(value string) float64 {
+	b, err := strconv.ParseBool(value)
+	if err != nil || !b {
+		return 0
+	}
+	return 1
+}
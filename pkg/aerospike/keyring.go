@@ -0,0 +1,114 @@
+package aerospike
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// partitionCount is the number of partitions of an aerospike namespace (constant for all clusters).
+const partitionCount = 4096
+
+var latencyRingNodesCovered = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_latency_ring_nodes_covered",
+	Help: "Number of distinct nodes hit by the latency check during the last full rotation of the partition key ring",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+// ringSalt is a random token of the probe process in the latency key names. Two probe instances,
+// or a restarted probe whose previous check was interrupted, never write the same latency keys, so
+// they cannot overwrite or delete each other's records.
+var ringSalt = utils.RandomHex(8)
+
+// partitionKeyRings caches the key ring of each (set, key prefix). The digest of a key only
+// depends on its set and name, so a ring is valid for every namespace and is computed once in
+// the probe lifetime.
+var partitionKeyRings = struct {
+	sync.Mutex
+	byPrefix map[string][]string
+}{byPrefix: make(map[string][]string)}
+
+// buildPartitionKeyRing returns one key name per partition: ring[i] is a key stored in partition
+// i (the partition id is derived from the first bits of the digest of the key). Key names are the
+// prefix followed by a counter.
+func buildPartitionKeyRing(set, keyPrefix string) ([]string, error) {
+	ring := make([]string, partitionCount)
+	missing := partitionCount
+	for i := 0; missing > 0; i++ {
+		keyName := keyPrefix + strconv.Itoa(i)
+		// The namespace is not part of the digest
+		key, err := as.NewKey("", set, keyName)
+		if err != nil {
+			return nil, err
+		}
+		if partitionId := key.PartitionId(); ring[partitionId] == "" {
+			ring[partitionId] = keyName
+			missing--
+		}
+	}
+	return ring, nil
+}
+
+func partitionKeyRing(set, keyPrefix string) ([]string, error) {
+	cacheKey := fmt.Sprintf("%s/%s", set, keyPrefix)
+	partitionKeyRings.Lock()
+	defer partitionKeyRings.Unlock()
+	if ring, ok := partitionKeyRings.byPrefix[cacheKey]; ok {
+		return ring, nil
+	}
+	ring, err := buildPartitionKeyRing(set, keyPrefix+ringSalt+"_")
+	if err != nil {
+		return nil, err
+	}
+	partitionKeyRings.byPrefix[cacheKey] = ring
+	return ring, nil
+}
+
+// ringCursor is the position of the latency check in the key ring of a namespace, and the nodes
+// hit since the start of the current rotation.
+type ringCursor struct {
+	pos   int
+	nodes map[string]struct{}
+}
+
+// nextRingKey returns the name of the next latency key of the namespace. Once the whole ring has
+// been used, the number of nodes hit during that rotation is exported and a new rotation starts.
+// As every node is master of some partitions, every node is hit in a bounded number of intervals.
+func (e *AerospikeEndpoint) nextRingKey(namespace string) (string, error) {
+	ring, err := partitionKeyRing(e.ClusterConfig.genericConfig.MonitoringSet, e.ClusterConfig.genericConfig.LatencyKeyPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	e.ringLock.Lock()
+	defer e.ringLock.Unlock()
+	if e.ringCursors == nil {
+		e.ringCursors = make(map[string]*ringCursor)
+	}
+	cursor, ok := e.ringCursors[namespace]
+	if !ok {
+		cursor = &ringCursor{nodes: make(map[string]struct{})}
+		e.ringCursors[namespace] = cursor
+	}
+	if cursor.pos == len(ring) {
+		latencyRingNodesCovered.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName()).Set(float64(len(cursor.nodes)))
+		cursor.pos = 0
+		cursor.nodes = make(map[string]struct{})
+	}
+	keyName := ring[cursor.pos]
+	cursor.pos++
+	return keyName, nil
+}
+
+// markRingNode records that the node was hit during the current rotation of the namespace ring.
+func (e *AerospikeEndpoint) markRingNode(namespace string, nodeId string) {
+	e.ringLock.Lock()
+	defer e.ringLock.Unlock()
+	if cursor, ok := e.ringCursors[namespace]; ok {
+		cursor.nodes[nodeId] = struct{}{}
+	}
+}
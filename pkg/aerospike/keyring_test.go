@@ -0,0 +1,96 @@
+package aerospike
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPartitionKeyRing(t *testing.T) {
+	ring, err := partitionKeyRing("monitoring", "test_ring_")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(ring) != partitionCount {
+		t.Fatalf("expected %d keys, got %d", partitionCount, len(ring))
+	}
+	for partitionId, keyName := range ring {
+		if !strings.HasPrefix(keyName, "test_ring_"+ringSalt+"_") {
+			t.Fatalf("expected %s to be salted with the probe token %s", keyName, ringSalt)
+		}
+		key, err := as.NewKey("foo", "monitoring", keyName)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if key.PartitionId() != partitionId {
+			t.Fatalf("expected %s to be in partition %d, got %d", keyName, partitionId, key.PartitionId())
+		}
+	}
+
+	// The ring is computed once
+	again, _ := partitionKeyRing("monitoring", "test_ring_")
+	if &again[0] != &ring[0] {
+		t.Fatalf("expected the cached ring to be returned")
+	}
+}
+
+func TestBuildPartitionKeyRingSalt(t *testing.T) {
+	// Rings of two probe processes share no key
+	keys := map[string]struct{}{}
+	for _, salt := range []string{"0a1b2c3d", "4e5f6a7b"} {
+		ring, err := buildPartitionKeyRing("monitoring", "test_ring_"+salt+"_")
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		for _, keyName := range ring {
+			if _, found := keys[keyName]; found {
+				t.Fatalf("expected distinct keys across salts, got %s twice", keyName)
+			}
+			keys[keyName] = struct{}{}
+		}
+	}
+}
+
+func TestNextRingKey(t *testing.T) {
+	cluster := authTestCluster(t)
+	e := &AerospikeEndpoint{
+		Name: "probe",
+		ClusterConfig: &AerospikeClientConfig{
+			clusterName:   cluster,
+			genericConfig: &AerospikeEndpointConfig{MonitoringSet: "monitoring", LatencyKeyPrefix: "test_ring_"},
+		},
+	}
+	ring, _ := partitionKeyRing("monitoring", "test_ring_")
+
+	// A full rotation hitting 3 nodes
+	for i := 0; i < partitionCount; i++ {
+		keyName, err := e.nextRingKey("foo")
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if keyName != ring[i] {
+			t.Fatalf("expected key %d of the ring %s, got %s", i, ring[i], keyName)
+		}
+		e.markRingNode("foo", "node"+strconv.Itoa(i%3))
+	}
+	if got := testutil.ToFloat64(latencyRingNodesCovered.WithLabelValues("foo", cluster, "probe")); got != 0 {
+		t.Fatalf("expected no coverage before the end of the rotation, got %v", got)
+	}
+
+	// The next key starts a new rotation and exports the coverage of the previous one
+	keyName, _ := e.nextRingKey("foo")
+	if keyName != ring[0] {
+		t.Fatalf("expected the ring to restart from %s, got %s", ring[0], keyName)
+	}
+	if got := testutil.ToFloat64(latencyRingNodesCovered.WithLabelValues("foo", cluster, "probe")); got != 3 {
+		t.Fatalf("expected 3 nodes covered, got %v", got)
+	}
+
+	// Namespaces rotate independently
+	if keyName, _ := e.nextRingKey("bar"); keyName != ring[0] {
+		t.Fatalf("expected namespace bar to start from %s, got %s", ring[0], keyName)
+	}
+}
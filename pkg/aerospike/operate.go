@@ -0,0 +1,188 @@
+package aerospike
+
+import (
+	"fmt"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	udfFunction = "probe"
+	// udfBody is the probe UDF: it stores the given value in a bin and returns it back.
+	udfBody = `-- Registered by the blackbox prober to check the UDF execution path
+function probe(rec, value)
+    rec["udf_val"] = value
+    if aerospike:exists(rec) then
+        aerospike:update(rec)
+    else
+        aerospike:create(rec)
+    end
+    return rec["udf_val"]
+end
+`
+)
+
+// The UDF and Operate commands are indirected through package variables so unit tests can mock
+// them without a live cluster.
+var (
+	// registerUDF registers the probe UDF module and returns the completion of the registration task.
+	registerUDF = func(e *AerospikeEndpoint, policy *as.WritePolicy, serverPath string) (<-chan as.Error, as.Error) {
+		task, err := e.Client.RegisterUDF(policy, []byte(udfBody), serverPath, as.LUA)
+		if err != nil {
+			return nil, err
+		}
+		return task.OnComplete(), nil
+	}
+
+	// operateWrite appends the value to the list bin and puts it at mapKey in the map bin, and
+	// returns the resulting sizes.
+	operateWrite = func(e *AerospikeEndpoint, policy *as.WritePolicy, key *as.Key, mapKey string, val string) (*as.Record, error) {
+		return e.Client.Operate(policy, key,
+			as.ListAppendOp("list", val),
+			as.MapPutOp(as.DefaultMapPolicy(), "map", mapKey, val),
+		)
+	}
+
+	// operateRead reads back the first list item and the map item at mapKey.
+	operateRead = func(e *AerospikeEndpoint, policy *as.WritePolicy, key *as.Key, mapKey string) (*as.Record, error) {
+		return e.Client.Operate(policy, key,
+			as.ListGetOp("list", 0),
+			as.MapGetByKeyOp("map", mapKey, as.MapReturnType.VALUE),
+		)
+	}
+
+	// executeUDF executes the probe UDF function with the value and returns its result.
+	executeUDF = func(e *AerospikeEndpoint, policy *as.WritePolicy, key *as.Key, val string) (interface{}, error) {
+		return e.Client.Execute(policy, key, e.ClusterConfig.genericConfig.UDFModule, udfFunction, as.NewValue(val))
+	}
+)
+
+// OperatePrepare registers the probe UDF module on the cluster. UDF modules are cluster-wide,
+// so it is not done per namespace.
+func OperatePrepare(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+	policy := as.NewWritePolicy(0, 0)
+	policy.TotalTimeout = e.ClusterConfig.genericConfig.TotalTimeout // 0 is default Client value in v7
+
+	serverPath := e.ClusterConfig.genericConfig.UDFModule + ".lua"
+	done, err := registerUDF(e, policy, serverPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to register UDF %s", serverPath)
+	}
+	if err := <-done; err != nil {
+		return errors.Wrapf(err, "failed to await registration of UDF %s", serverPath)
+	}
+	level.Debug(e.Logger).Log("msg", fmt.Sprintf("UDF %s registered", serverPath))
+	return nil
+}
+
+// OperateCheck exercises the Operate path (CDT list append / map put and reads) and the UDF
+// execution path on every monitored namespace. These paths can fail separately from plain puts
+// (e.g. UDF module missing after a node replacement).
+func OperateCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+	return forEachNamespace(e, namespaceCheckParallelism(len(e.Namespaces)), func(namespace string) error {
+		return operateCheckNamespace(e, namespace)
+	})
+}
+
+func operateCheckNamespace(e *AerospikeEndpoint, namespace string) error {
+	conf := e.ClusterConfig.genericConfig
+
+	policy := as.NewWritePolicy(0, 3600) // Expire after one hour if the delete didn't work
+	policy.MaxRetries = 0                // Ensure we never retry (0 is default Client value in v7)
+	policy.ReplicaPolicy = as.MASTER     // Read are always done on master (SEQUENCE is default Client value in v7)
+	policy.TotalTimeout = conf.TotalTimeout
+	// Do not wait until timeout if connections cannot be open
+	policy.ExitFastOnExhaustedConnectionPool = conf.ExitFastOnExhaustedConnectionPool
+
+	for range e.Client.Cluster().GetNodes() { // scale the number of checks to the number of nodes
+		key, as_err := as.NewKey(namespace, conf.MonitoringSet, fmt.Sprintf("%s%s", conf.OperateKeyPrefix, utils.RandomHex(20)))
+		if as_err != nil {
+			return as_err
+		}
+		mapKey := utils.RandomHex(8)
+		val := utils.RandomHex(64)
+
+		node, err := getWriteNode(e.Client, policy, key)
+		if err != nil {
+			return errors.Wrapf(err, "error when trying to find node for: %s", keyAsStr(key))
+		}
+
+		// OPERATE WRITE: list append and map put on a fresh record, both must now hold one item
+		labels := nodeOpLabels(e, "operate_write", namespace, node)
+		opWrite := func() error {
+			rec, err := operateWrite(e, policy, key, mapKey, val)
+			if err != nil {
+				return err
+			}
+			if rec.Bins["list"] != 1 || rec.Bins["map"] != 1 {
+				return errors.Errorf("Operate succeeded but unexpected sizes returned: list={%v} map={%v}", rec.Bins["list"], rec.Bins["map"])
+			}
+			return nil
+		}
+		if err := ObserveOpLatency(opWrite, labels); err != nil {
+			return errors.Wrapf(err, "operate write failed for: %s", keyAsStr(key))
+		}
+
+		// OPERATE READ: read back the list and map items
+		labels[0] = "operate_read"
+		opRead := func() error {
+			rec, err := operateRead(e, policy, key, mapKey)
+			if err != nil {
+				return err
+			}
+			if rec.Bins["list"] != val || rec.Bins["map"] != val {
+				return errors.Errorf("Operate succeeded but there is a missmatch between server values list={%v} map={%v} and pushed value", rec.Bins["list"], rec.Bins["map"])
+			}
+			return nil
+		}
+		if err := ObserveOpLatency(opRead, labels); err != nil {
+			return errors.Wrapf(err, "operate read failed for: %s", keyAsStr(key))
+		}
+
+		// UDF OPERATION: the probe UDF returns the value it stored
+		labels[0] = "udf"
+		opUDF := func() error {
+			res, err := executeUDF(e, policy, key, val)
+			if err != nil {
+				return err
+			}
+			if res != val {
+				return errors.Errorf("UDF succeeded but there is a missmatch between returned value {%v} and pushed value", res)
+			}
+			return nil
+		}
+		if err := ObserveOpLatency(opUDF, labels); err != nil {
+			return errors.Wrapf(err, "udf execute failed for: %s", keyAsStr(key))
+		}
+
+		// DELETE OPERATION
+		labels[0] = "operate_delete"
+		opDelete := func() error {
+			existed, err := e.Client.Delete(policy, key)
+			if err != nil {
+				return err
+			}
+			if !existed {
+				return errors.Errorf("Delete succeeded but there was no data to delete")
+			}
+			return nil
+		}
+		if err := ObserveOpLatency(opDelete, labels); err != nil {
+			return errors.Wrapf(err, "record delete failed for: %s", keyAsStr(key))
+		}
+		level.Debug(e.Logger).Log("msg", fmt.Sprintf("operate and udf validated: %s", keyAsStr(key)))
+	}
+	return nil
+}
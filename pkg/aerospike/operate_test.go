@@ -0,0 +1,163 @@
+package aerospike
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/aerospike/aerospike-client-go/v8/types"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// opFailures sums the op_latency_failures of the operation for the cluster.
+func opFailures(t *testing.T, cluster string, operation string) float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		opFailuresTotal.Collect(ch)
+		close(ch)
+	}()
+	total := 0.0
+	for m := range ch {
+		var dm dto.Metric
+		if err := m.Write(&dm); err != nil {
+			continue
+		}
+		labels := map[string]string{}
+		for _, lp := range dm.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		if labels["cluster"] == cluster && labels["operation"] == operation {
+			total += dm.GetCounter().GetValue()
+		}
+	}
+	return total
+}
+
+func TestOperatePrepare(t *testing.T) {
+	standin := newStandinCluster(t, 1, "ns1")
+	e := standin.standinEndpoint(t, "", "", func(conf *AerospikeEndpointConfig) {
+		conf.UDFModule = "probe_module"
+	})
+
+	orig := registerUDF
+	defer func() { registerUDF = orig }()
+	mockRegister := func(registerErr as.Error, taskErr as.Error) *[]string {
+		paths := []string{}
+		registerUDF = func(_ *AerospikeEndpoint, _ *as.WritePolicy, serverPath string) (<-chan as.Error, as.Error) {
+			paths = append(paths, serverPath)
+			if registerErr != nil {
+				return nil, registerErr
+			}
+			done := make(chan as.Error, 1)
+			done <- taskErr
+			return done, nil
+		}
+		return &paths
+	}
+
+	paths := mockRegister(nil, nil)
+	if err := OperatePrepare(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	// UDF modules are cluster-wide: registered once whatever the number of namespaces
+	if strings.Join(*paths, ",") != "probe_module.lua" {
+		t.Errorf("expected probe_module.lua to be registered once, got %v", *paths)
+	}
+
+	mockRegister(&as.AerospikeError{ResultCode: types.ROLE_VIOLATION}, nil)
+	if err := OperatePrepare(e); err == nil || !strings.Contains(err.Error(), "failed to register UDF probe_module.lua") {
+		t.Errorf("expected a registration error, got %v", err)
+	}
+	mockRegister(nil, &as.AerospikeError{ResultCode: types.TIMEOUT})
+	if err := OperatePrepare(e); err == nil || !strings.Contains(err.Error(), "failed to await registration") {
+		t.Errorf("expected a registration task error, got %v", err)
+	}
+}
+
+func TestOperateCheckStandin(t *testing.T) {
+	standin := newStandinCluster(t, 2, "ns1", "ns2")
+	e := standin.standinEndpoint(t, "", "", nil)
+	cluster := e.ClusterConfig.clusterName
+
+	origWrite, origRead, origExecute := operateWrite, operateRead, executeUDF
+	defer func() { operateWrite, operateRead, executeUDF = origWrite, origRead, origExecute }()
+
+	// The stand-in does not implement CDT operations and UDFs: the mocks keep the pushed values
+	// and write the record on the stand-in so the delete really runs against it.
+	var writeErr error
+	writtenSizes := 1
+	corruptRead, corruptUDF, skipRecord, denyDelete := false, false, false, false
+	values := map[string]string{}
+	operateWrite = func(e *AerospikeEndpoint, policy *as.WritePolicy, key *as.Key, mapKey string, val string) (*as.Record, error) {
+		if writeErr != nil {
+			return nil, writeErr
+		}
+		values[string(key.Digest())+mapKey] = val
+		if !skipRecord {
+			if err := e.Client.Put(policy, key, as.BinMap{"list": val}); err != nil {
+				return nil, err
+			}
+		}
+		if denyDelete {
+			standin.denyWrites(key.Namespace())
+		}
+		return &as.Record{Key: key, Bins: as.BinMap{"list": writtenSizes, "map": writtenSizes}}, nil
+	}
+	operateRead = func(_ *AerospikeEndpoint, _ *as.WritePolicy, key *as.Key, mapKey string) (*as.Record, error) {
+		val := values[string(key.Digest())+mapKey]
+		if corruptRead {
+			return &as.Record{Key: key, Bins: as.BinMap{"list": val, "map": "corrupted"}}, nil
+		}
+		return &as.Record{Key: key, Bins: as.BinMap{"list": val, "map": val}}, nil
+	}
+	executeUDF = func(_ *AerospikeEndpoint, _ *as.WritePolicy, _ *as.Key, val string) (interface{}, error) {
+		if corruptUDF {
+			return "corrupted", nil
+		}
+		return val, nil
+	}
+
+	if err := OperateCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for _, namespace := range []string{"ns1", "ns2"} {
+		if got := standin.recordCount(namespace); got != 0 {
+			t.Errorf("expected operate records to be deleted on %s, got %d records", namespace, got)
+		}
+	}
+	for _, operation := range []string{"operate_write", "operate_read", "udf", "operate_delete"} {
+		if got := opFailures(t, cluster, operation); got != 0 {
+			t.Errorf("expected no %s failure, got %v", operation, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		setup     func()
+		operation string
+		err       string
+	}{
+		{"write error", func() { writeErr = errors.New("bin type error") }, "operate_write", "operate write failed"},
+		{"unexpected sizes", func() { writtenSizes = 2 }, "operate_write", "unexpected sizes returned: list={2} map={2}"},
+		{"read mismatch", func() { corruptRead = true }, "operate_read", "operate read failed"},
+		{"udf mismatch", func() { corruptUDF = true }, "udf", "missmatch between returned value {corrupted}"},
+		{"nothing to delete", func() { skipRecord = true }, "operate_delete", "there was no data to delete"},
+		{"delete error", func() { denyDelete = true }, "operate_delete", "record delete failed"},
+	} {
+		writeErr, writtenSizes = nil, 1
+		corruptRead, corruptUDF, skipRecord = false, false, false
+		tc.setup()
+		before := opFailures(t, cluster, tc.operation)
+		err := OperateCheck(e)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+		// Each namespace fails at its first check
+		if got := opFailures(t, cluster, tc.operation) - before; got != 2 {
+			t.Errorf("%s: expected 2 new %s failures, got %v", tc.name, tc.operation, got)
+		}
+	}
+}
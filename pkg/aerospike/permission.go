@@ -0,0 +1,159 @@
+package aerospike
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/aerospike/aerospike-client-go/v8/types"
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// permissionStatus values double as the `status` label on permission_check_total.
+const (
+	permissionStatusSuccess = "success"
+	permissionStatusDenied  = "permission_denied"
+	permissionStatusError   = "error"
+)
+
+var permissionCheckTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: ASSuffix + "_permission_check_total",
+	Help: "Total number of privileged operations made by the permission check, by status (success, permission_denied, error)",
+}, []string{"namespace", "cluster", "probe_endpoint", "status"})
+
+var permissionRoleGranted = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: ASSuffix + "_permission_role_granted",
+	Help: "Whether an expected role is granted to the probe user (1) or not (0)",
+}, []string{"cluster", "probe_endpoint", "role"})
+
+// userRoles is indirected through a package variable so unit tests can mock the roles returned
+// by the admin API.
+var userRoles = func(e *AerospikeEndpoint) ([]string, error) {
+	user, err := e.Client.QueryUser(nil, e.ClusterConfig.username)
+	if err != nil {
+		return nil, err
+	}
+	return user.Roles, nil
+}
+
+// missingRoles returns the expected roles which are not granted, and the granted roles which are
+// not expected (both sorted).
+func missingRoles(expected []string, granted []string) (missing []string, unexpected []string) {
+	grantedSet := make(map[string]struct{}, len(granted))
+	for _, role := range granted {
+		grantedSet[role] = struct{}{}
+	}
+	expectedSet := make(map[string]struct{}, len(expected))
+	for _, role := range expected {
+		expectedSet[role] = struct{}{}
+		if _, ok := grantedSet[role]; !ok {
+			missing = append(missing, role)
+		}
+	}
+	for _, role := range granted {
+		if _, ok := expectedSet[role]; !ok {
+			unexpected = append(unexpected, role)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	return missing, unexpected
+}
+
+// PermissionCheck verifies that the probe user still holds its privileges, which a fresh login
+// (AuthCheck) does not: after a security config change, the login still succeeds while writes
+// are rejected. The roles of the user are compared to expected_roles, then a record is written
+// and deleted on every monitored namespace. Rejected operations are counted with
+// status="permission_denied", apart from other errors.
+func PermissionCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+
+	// Nothing to verify if security is disabled for this cluster.
+	if !e.ClusterConfig.authEnabled {
+		return nil
+	}
+
+	roleErr := checkUserRoles(e)
+	err := forEachNamespace(e, namespaceCheckParallelism(len(e.Namespaces)), func(namespace string) error {
+		return permissionCheckNamespace(e, namespace)
+	})
+	if roleErr != nil {
+		return roleErr
+	}
+	return err
+}
+
+func checkUserRoles(e *AerospikeEndpoint) error {
+	expected := e.ClusterConfig.genericConfig.ExpectedRoles
+	if len(expected) == 0 {
+		return nil
+	}
+	roles, err := userRoles(e)
+	if err != nil {
+		return errors.Wrapf(err, "failed to query the roles of user %s", e.ClusterConfig.username)
+	}
+
+	missing, unexpected := missingRoles(expected, roles)
+	for _, role := range expected {
+		permissionRoleGranted.WithLabelValues(e.ClusterConfig.clusterName, e.GetName(), role).Set(1)
+	}
+	for _, role := range missing {
+		permissionRoleGranted.WithLabelValues(e.ClusterConfig.clusterName, e.GetName(), role).Set(0)
+	}
+	if len(unexpected) > 0 {
+		level.Warn(e.Logger).Log("msg", fmt.Sprintf("User %s holds unexpected roles: %s", e.ClusterConfig.username, strings.Join(unexpected, ",")))
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("user %s is missing the expected roles: %s", e.ClusterConfig.username, strings.Join(missing, ","))
+	}
+	return nil
+}
+
+func permissionCheckNamespace(e *AerospikeEndpoint, namespace string) error {
+	conf := e.ClusterConfig.genericConfig
+	policy := as.NewWritePolicy(0, 3600)    // Expire after one hour if the delete didn't work
+	policy.MaxRetries = 0                   // Ensure we never retry (0 is default Client value in v7)
+	policy.TotalTimeout = conf.TotalTimeout // 0 is default Client value in v7
+	// Do not wait until timeout if connections cannot be open
+	policy.ExitFastOnExhaustedConnectionPool = conf.ExitFastOnExhaustedConnectionPool
+
+	key, as_err := as.NewKey(namespace, conf.MonitoringSet, fmt.Sprintf("%s%s", conf.PermissionKeyPrefix, utils.RandomHex(20)))
+	if as_err != nil {
+		return as_err
+	}
+	as_err = func() as.Error {
+		if err := e.Client.Put(policy, key, as.BinMap{"val": hash(key.Value().String())}); err != nil {
+			return err
+		}
+		_, err := e.Client.Delete(policy, key)
+		return err
+	}()
+
+	status := permissionStatusSuccess
+	if as_err != nil {
+		status = permissionStatusError
+		if as_err.Matches(types.ROLE_VIOLATION) {
+			status = permissionStatusDenied
+		}
+	}
+	permissionCheckTotal.WithLabelValues(namespace, e.ClusterConfig.clusterName, e.GetName(), status).Inc()
+
+	switch status {
+	case permissionStatusDenied:
+		level.Error(e.Logger).Log("msg", fmt.Sprintf("Permission denied for user %s on namespace %s", e.ClusterConfig.username, namespace), "err", as_err)
+		return errors.Wrapf(as_err, "permission denied on namespace %s", namespace)
+	case permissionStatusError:
+		return errors.Wrapf(as_err, "privileged operation failed for: %s", keyAsStr(key))
+	}
+	level.Debug(e.Logger).Log("msg", fmt.Sprintf("privileged operation succeeded: %s", keyAsStr(key)))
+	return nil
+}
@@ -0,0 +1,110 @@
+package aerospike
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMissingRoles(t *testing.T) {
+	missing, unexpected := missingRoles([]string{"read-write", "data-admin"}, []string{"sys-admin", "read-write"})
+	if len(missing) != 1 || missing[0] != "data-admin" {
+		t.Errorf("expected data-admin to be missing, got %v", missing)
+	}
+	if len(unexpected) != 1 || unexpected[0] != "sys-admin" {
+		t.Errorf("expected sys-admin to be unexpected, got %v", unexpected)
+	}
+	if missing, unexpected := missingRoles(nil, nil); len(missing) != 0 || len(unexpected) != 0 {
+		t.Errorf("expected no difference, got %v and %v", missing, unexpected)
+	}
+}
+
+func TestExpectedRolesConfig(t *testing.T) {
+	config := AerospikeEndpointConfig{}
+	if err := yaml.Unmarshal([]byte("auth_external: false\nexpected_roles: [read-write]"), &config); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	// auth_external is enabled by default
+	if err := yaml.Unmarshal([]byte("expected_roles: [read-write]"), &config); err == nil {
+		t.Fatalf("expected an error for expected roles of an external user")
+	}
+}
+
+func TestPermissionCheck(t *testing.T) {
+	standin := newStandinCluster(t, 2, "ns1", "ns2")
+	standin.setUser("probe", "secret")
+	e := standin.standinEndpoint(t, "probe", "secret", func(conf *AerospikeEndpointConfig) {
+		conf.AuthExternal = false
+		conf.ExpectedRoles = []string{"read-write", "data-admin"}
+	})
+	cluster := e.ClusterConfig.clusterName
+	permissionTotal := func(namespace string, status string) float64 {
+		return testutil.ToFloat64(permissionCheckTotal.WithLabelValues(namespace, cluster, e.GetName(), status))
+	}
+
+	origRoles := userRoles
+	defer func() { userRoles = origRoles }()
+	roles := []string{"read-write", "data-admin"}
+	userRoles = func(_ *AerospikeEndpoint) ([]string, error) {
+		return roles, nil
+	}
+
+	if err := PermissionCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for _, namespace := range []string{"ns1", "ns2"} {
+		if got := permissionTotal(namespace, permissionStatusSuccess); got != 1 {
+			t.Errorf("%s: expected 1 success, got %v", namespace, got)
+		}
+		if got := standin.recordCount(namespace); got != 0 {
+			t.Errorf("%s: expected the record to be deleted, got %d records", namespace, got)
+		}
+	}
+	if got := testutil.ToFloat64(permissionRoleGranted.WithLabelValues(cluster, e.GetName(), "data-admin")); got != 1 {
+		t.Errorf("expected data-admin to be granted, got %v", got)
+	}
+
+	// Role revoked and writes rejected on ns2: both are reported, apart from auth failures
+	roles = []string{"read-write"}
+	standin.denyWrites("ns2")
+	if err := PermissionCheck(e); err == nil {
+		t.Fatal("expected the permission check to fail when a role is missing")
+	}
+	if got := testutil.ToFloat64(permissionRoleGranted.WithLabelValues(cluster, e.GetName(), "data-admin")); got != 0 {
+		t.Errorf("expected data-admin to be missing, got %v", got)
+	}
+	if got := permissionTotal("ns1", permissionStatusSuccess); got != 2 {
+		t.Errorf("ns1: expected 2 successes, got %v", got)
+	}
+	if got := permissionTotal("ns2", permissionStatusDenied); got != 1 {
+		t.Errorf("ns2: expected 1 permission_denied, got %v", got)
+	}
+	if err := AuthCheck(e); err != nil {
+		t.Fatalf("expected the login to keep working, got %v", err)
+	}
+
+	// Roles cannot be queried
+	userRoles = func(_ *AerospikeEndpoint) ([]string, error) {
+		return nil, errors.New("role violation")
+	}
+	if err := PermissionCheck(e); err == nil {
+		t.Fatal("expected the permission check to fail when roles cannot be queried")
+	}
+}
+
+func TestPermissionCheckDisabled(t *testing.T) {
+	e := &AerospikeEndpoint{ClusterConfig: &AerospikeClientConfig{clusterName: authTestCluster(t), authEnabled: false}}
+
+	origRoles := userRoles
+	defer func() { userRoles = origRoles }()
+	userRoles = func(_ *AerospikeEndpoint) ([]string, error) {
+		t.Fatal("roles must not be queried when auth is disabled")
+		return nil, nil
+	}
+
+	if err := PermissionCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package aerospike
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var rackOpLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    ASSuffix + "_rack_op_latency",
+	Help:    "Latency for operations served by a given rack",
+	Buckets: utils.MetricHistogramBuckets,
+}, []string{"operation", "endpoint", "namespace", "node", "pod", "cluster", "node_id", "rack"})
+
+var rackOpFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: ASSuffix + "_rack_op_latency_failures",
+	Help: "Total number of operations served by a given rack that resulted in failure",
+}, []string{"operation", "endpoint", "namespace", "node", "pod", "cluster", "node_id", "rack"})
+
+// rackClient is a client preferring reads from a single rack (ClientPolicy.RackIds + PREFER_RACK).
+type rackClient struct {
+	rack   int
+	client *as.Client
+}
+
+// sharedRackClient is a rack client shared by the running latency checks. The client of a removed
+// rack is closed once the last check using it has released it.
+type sharedRackClient struct {
+	client  *as.Client
+	users   int
+	removed bool
+}
+
+// remove marks the client as removed and closes it if no check is using it. Must be called with
+// the rack lock held.
+func (c *sharedRackClient) remove() {
+	c.removed = true
+	if c.users == 0 {
+		c.client.Close()
+	}
+}
+
+// parseRacks parses the output of the `racks` info command into the rack ids of each namespace.
+// Format: ns=<ns>:rack_<id>=<node>,<node>:rack_<id>=<node>;ns=<ns>:...
+// Roster entries (strong consistency) are ignored as they describe the desired state.
+func parseRacks(response string) (map[string][]int, error) {
+	racks := make(map[string][]int)
+	for _, nsEntry := range parseInfoList(response) {
+		fields := strings.Split(nsEntry, ":")
+		if !strings.HasPrefix(fields[0], "ns=") {
+			return nil, errors.Errorf("invalid racks entry %q", nsEntry)
+		}
+		namespace := strings.TrimPrefix(fields[0], "ns=")
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "rack_") {
+				continue
+			}
+			rackId, _, _ := strings.Cut(strings.TrimPrefix(field, "rack_"), "=")
+			rack, err := strconv.Atoi(rackId)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid rack id in racks entry %q", nsEntry)
+			}
+			racks[namespace] = append(racks[namespace], rack)
+		}
+		sort.Ints(racks[namespace])
+	}
+	return racks, nil
+}
+
+// refreshRacks fetches the racks of the cluster and keeps one rack-aware client per rack. Clients
+// of racks that disappeared are closed once released by the checks using them; a client failing
+// to connect is retried on next refresh.
+func (e *AerospikeEndpoint) refreshRacks() error {
+	var (
+		racks map[string][]int
+		err   error
+	)
+	for _, target := range infoTargets(e) {
+		var res map[string]string
+		res, err = target.info("racks")
+		if err != nil {
+			continue
+		}
+		racks, err = parseRacks(res["racks"])
+		if err == nil {
+			break
+		}
+	}
+	if racks == nil {
+		return errors.Wrap(err, "failed to fetch racks")
+	}
+
+	wanted := make(map[int]struct{})
+	for _, namespace := range e.Namespaces {
+		for _, rack := range racks[namespace] {
+			wanted[rack] = struct{}{}
+		}
+	}
+
+	e.rackLock.Lock()
+	defer e.rackLock.Unlock()
+	e.racks = racks
+	if e.rackClients == nil {
+		e.rackClients = make(map[int]*sharedRackClient)
+	}
+	for rack, client := range e.rackClients {
+		if _, ok := wanted[rack]; !ok {
+			level.Info(e.Logger).Log("msg", fmt.Sprintf("Closing client of removed rack %d", rack))
+			client.remove()
+			delete(e.rackClients, rack)
+		}
+	}
+	for rack := range wanted {
+		if _, ok := e.rackClients[rack]; ok {
+			continue
+		}
+		policy := e.clientPolicy()
+		policy.RackAware = true
+		policy.RackIds = []int{rack}
+		// Rack clients only serve the rack reads of the latency check
+		policy.MinConnectionsPerNode = namespaceCheckParallelism(len(e.Namespaces))
+		client, err := as.NewClientWithPolicyAndHost(policy, e.ClusterConfig.hosts...)
+		if err != nil {
+			level.Error(e.Logger).Log("msg", fmt.Sprintf("Failed to create client for rack %d", rack), "err", err)
+			continue
+		}
+		e.rackClients[rack] = &sharedRackClient{client: client}
+	}
+	return nil
+}
+
+// rackClientsForNamespace returns the rack clients of the racks holding the namespace, sorted by
+// rack id, and the function releasing them. They are not closed before being released.
+func (e *AerospikeEndpoint) rackClientsForNamespace(namespace string) ([]rackClient, func()) {
+	e.rackLock.Lock()
+	defer e.rackLock.Unlock()
+	clients := []rackClient{}
+	shared := []*sharedRackClient{}
+	for _, rack := range e.racks[namespace] {
+		if client, ok := e.rackClients[rack]; ok {
+			client.users++
+			clients = append(clients, rackClient{rack: rack, client: client.client})
+			shared = append(shared, client)
+		}
+	}
+	release := func() {
+		e.rackLock.Lock()
+		defer e.rackLock.Unlock()
+		for _, client := range shared {
+			client.users--
+			if client.removed && client.users == 0 {
+				client.client.Close()
+			}
+		}
+	}
+	return clients, release
+}
+
+func (e *AerospikeEndpoint) closeRackClients() {
+	e.rackLock.Lock()
+	defer e.rackLock.Unlock()
+	for rack, client := range e.rackClients {
+		client.remove()
+		delete(e.rackClients, rack)
+	}
+}
+
+// getReadNode find the node against which the read will be made
+func getReadNode(c *as.Client, policy *as.BasePolicy, key *as.Key) (*as.Node, error) {
+	partition, err := as.PartitionForRead(c.Cluster(), policy, key)
+	if err != nil {
+		return nil, err
+	}
+	node, err := partition.GetNodeRead(c.Cluster())
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// rackReadNamespace reads the key from every rack holding a replica of it, so a degraded rack
+// (or a slow cross-AZ path) is visible even if the master path is healthy. All racks are read;
+// the first failure is returned.
+func rackReadNamespace(e *AerospikeEndpoint, namespace string, key *as.Key, val as.BinMap) error {
+	policy := as.NewPolicy()
+	policy.MaxRetries = 0                                            // Ensure we never retry to measure the rack itself
+	policy.ReplicaPolicy = as.PREFER_RACK                            // Read from the rack configured on the client
+	policy.TotalTimeout = e.ClusterConfig.genericConfig.TotalTimeout // 0 is default Client value in v7
+	// Do not wait until timeout if connections cannot be open
+	policy.ExitFastOnExhaustedConnectionPool = e.ClusterConfig.genericConfig.ExitFastOnExhaustedConnectionPool
+
+	rackClients, release := e.rackClientsForNamespace(namespace)
+	defer release()
+
+	var firstErr error
+	for _, rc := range rackClients {
+		node, err := getReadNode(rc.client, policy, key)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "error when trying to find node of rack %d for: %s", rc.rack, keyAsStr(key))
+			}
+			continue
+		}
+		// With fewer replicas than racks, the key has no copy on some racks: PREFER_RACK then
+		// falls back to another rack, which must not be reported as this rack's latency.
+		if rack, err := node.Rack(namespace); err != nil || rack != rc.rack {
+			continue
+		}
+
+		labels := append(nodeOpLabels(e, "get", namespace, node), strconv.Itoa(rc.rack))
+
+		start := time.Now()
+		recVal, err := rc.client.Get(policy, key)
+		rackOpLatency.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		if err == nil && recVal == nil {
+			err = errors.Errorf("Record not found after being put")
+		} else if err == nil && recVal.Bins["val"] != val["val"] {
+			err = errors.Errorf("Get succeeded but there is a missmatch between server value {%s} and pushed value", recVal.Bins["val"])
+		}
+		if err != nil {
+			rackOpFailuresTotal.WithLabelValues(labels...).Inc()
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "record get failed on rack %d for: %s", rc.rack, keyAsStr(key))
+			}
+			continue
+		}
+		rackOpFailuresTotal.WithLabelValues(labels...).Add(0) // Force creation of metric
+		level.Debug(e.Logger).Log("msg", fmt.Sprintf("record get on rack %d: %s", rc.rack, keyAsStr(key)))
+	}
+	return firstErr
+}
@@ -0,0 +1,190 @@
+package aerospike
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseRacks(t *testing.T) {
+	got, err := parseRacks("ns=foo:rack_1=BB9020011AC4202,BB9030011AC4202:rack_2=BB9040011AC4202;" +
+		"ns=bar:roster_rack_1=BB9020011AC4202:rack_0=BB9020011AC4202,BB9030011AC4202")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	expected := map[string][]int{
+		"foo": {1, 2},
+		"bar": {0},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	for _, invalid := range []string{"foo:rack_1=A", "ns=foo:rack_x=A"} {
+		if _, err := parseRacks(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestRackClientsForNamespace(t *testing.T) {
+	c1, c2 := &as.Client{}, &as.Client{}
+	e := &AerospikeEndpoint{
+		rackClients: map[int]*sharedRackClient{1: {client: c1}, 2: {client: c2}},
+		racks:       map[string][]int{"foo": {1, 2, 3}, "bar": {2}},
+	}
+
+	// Racks without a (connected) client are skipped.
+	got, release := e.rackClientsForNamespace("foo")
+	expected := []rackClient{{rack: 1, client: c1}, {rack: 2, client: c2}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if e.rackClients[1].users != 1 || e.rackClients[2].users != 1 {
+		t.Fatal("expected the rack clients to be acquired")
+	}
+	release()
+	if e.rackClients[1].users != 0 || e.rackClients[2].users != 0 {
+		t.Fatal("expected the rack clients to be released")
+	}
+	if got, release := e.rackClientsForNamespace("unknown"); len(got) != 0 {
+		t.Fatalf("expected no rack client for an unknown namespace, got %v", got)
+	} else {
+		release()
+	}
+}
+
+// rackStandinEndpoint returns a connected rack-aware endpoint on a stand-in whose nodes are in
+// racks 1 and 2.
+func rackStandinEndpoint(t *testing.T) (*standinCluster, *AerospikeEndpoint) {
+	t.Helper()
+	standin := newStandinCluster(t, 2, "ns1")
+	standin.setRacks(1, 2)
+	e := standin.standinEndpoint(t, "", "", func(conf *AerospikeEndpointConfig) {
+		conf.RackAwareLatency = true
+	})
+	return standin, e
+}
+
+// rackOpLatencyRacks returns the racks with rack_op_latency series for the cluster.
+func rackOpLatencyRacks(t *testing.T, cluster string) map[string]struct{} {
+	t.Helper()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		rackOpLatency.Collect(ch)
+		close(ch)
+	}()
+	racks := map[string]struct{}{}
+	for m := range ch {
+		var dm dto.Metric
+		if err := m.Write(&dm); err != nil {
+			continue
+		}
+		labels := map[string]string{}
+		for _, lp := range dm.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		if labels["cluster"] == cluster {
+			racks[labels["rack"]] = struct{}{}
+		}
+	}
+	return racks
+}
+
+func TestRefreshRacksStandin(t *testing.T) {
+	standin, e := rackStandinEndpoint(t)
+	if len(e.rackClients) != 2 {
+		t.Fatalf("expected a client per rack after connecting, got %d", len(e.rackClients))
+	}
+	if expected := map[string][]int{"ns1": {1, 2}}; !reflect.DeepEqual(e.racks, expected) {
+		t.Fatalf("expected racks %v, got %v", expected, e.racks)
+	}
+
+	// Rack 2 disappears while a latency check is using its client
+	clients, release := e.rackClientsForNamespace("ns1")
+	rack2 := clients[1].client
+	standin.setRacks(1, 1)
+	if err := e.refreshRacks(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if _, ok := e.rackClients[2]; ok || len(e.rackClients) != 1 {
+		t.Fatalf("expected the client of rack 2 to be removed, got %v", e.rackClients)
+	}
+	if !rack2.IsConnected() {
+		t.Fatal("expected the client of rack 2 to stay open while in use")
+	}
+	release()
+	if rack2.IsConnected() {
+		t.Fatal("expected the client of rack 2 to be closed once released")
+	}
+
+	// Racks are kept when no node answers
+	origTargets := infoTargets
+	defer func() { infoTargets = origTargets }()
+	infoTargets = func(_ *AerospikeEndpoint) []infoTarget {
+		return []infoTarget{fakeInfoTarget("A", "10.0.0.1", nil, errors.New("connection refused"))}
+	}
+	if err := e.refreshRacks(); err == nil {
+		t.Fatal("expected an error when no node answers")
+	}
+	if len(e.rackClients) != 1 {
+		t.Fatalf("expected the rack clients to be kept, got %v", e.rackClients)
+	}
+}
+
+func TestRackReadNamespaceStandin(t *testing.T) {
+	standin, e := rackStandinEndpoint(t)
+	key, err := as.NewKey("ns1", e.ClusterConfig.genericConfig.MonitoringSet, "rack_key")
+	if err != nil {
+		t.Fatalf("failed to build key: %v", err)
+	}
+	val := as.BinMap{"val": "value"}
+	if err := e.Client.Put(nil, key, val); err != nil {
+		t.Fatalf("failed to put record: %v", err)
+	}
+
+	if err := rackReadNamespace(e, "ns1", key, val); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	expected := map[string]struct{}{"1": {}, "2": {}}
+	if got := rackOpLatencyRacks(t, e.ClusterConfig.clusterName); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected rack_op_latency series for racks 1 and 2, got %v", got)
+	}
+
+	if err := rackReadNamespace(e, "ns1", key, as.BinMap{"val": "other"}); err == nil {
+		t.Error("expected an error on a value mismatch")
+	}
+	standin.dropRecord("ns1", e.ClusterConfig.genericConfig.MonitoringSet, "rack_key")
+	if err := rackReadNamespace(e, "ns1", key, val); err == nil {
+		t.Error("expected an error on a missing record")
+	}
+}
+
+func TestRefreshRunsEveryRefresh(t *testing.T) {
+	standin := newStandinCluster(t, 1, "ns1")
+	e := standin.standinEndpoint(t, "", "", func(conf *AerospikeEndpointConfig) {
+		conf.RackAwareLatency = true
+		conf.NamespaceAutoDiscovery = true
+	})
+
+	origTargets := infoTargets
+	defer func() { infoTargets = origTargets }()
+	infoTargets = func(_ *AerospikeEndpoint) []infoTarget {
+		return []infoTarget{fakeInfoTarget("A", "10.0.0.1", map[string]string{"racks": "invalid", "namespaces": "ns1;ns2"}, nil)}
+	}
+
+	// A failed racks refresh does not skip the namespace discovery
+	err := e.Refresh()
+	if err == nil || !strings.Contains(err.Error(), "refresh racks") {
+		t.Fatalf("expected the racks refresh error, got %v", err)
+	}
+	expected := []string{"ns1", "ns2"}
+	if got := getDiscoveredNamespaces(e.ClusterConfig.clusterName); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected discovered namespaces %v, got %v", expected, got)
+	}
+}
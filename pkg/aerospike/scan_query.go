@@ -0,0 +1,244 @@
+package aerospike
+
+import (
+	"fmt"
+	"time"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/aerospike/aerospike-client-go/v8/types"
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var scanQueryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    ASSuffix + "_scan_query_latency",
+	Help:    "Latency for secondary index queries and partition scans",
+	Buckets: utils.MetricHistogramBuckets,
+}, []string{"operation", "namespace", "cluster", "probe_endpoint"})
+
+var scanQueryFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: ASSuffix + "_scan_query_latency_failures",
+	Help: "Total number of secondary index queries and partition scans that resulted in failure",
+}, []string{"operation", "namespace", "cluster", "probe_endpoint"})
+
+func observeScanQueryLatency(op func() error, labels []string) error {
+	start := time.Now()
+	err := op()
+	scanQueryLatency.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	if err != nil {
+		scanQueryFailuresTotal.WithLabelValues(labels...).Inc()
+	} else {
+		scanQueryFailuresTotal.WithLabelValues(labels...).Add(0) // Force creation of metric
+	}
+	return err
+}
+
+// queryIndexName is the name of the secondary index on the query bin of the monitoring set
+// (index names are unique per namespace).
+func queryIndexName(conf *AerospikeEndpointConfig) string {
+	return fmt.Sprintf("%s_%s", conf.MonitoringSet, conf.QueryIndexBin)
+}
+
+func queryKeyName(conf *AerospikeEndpointConfig, i int) string {
+	return fmt.Sprintf("%s%d", conf.QueryKeyPrefix, i)
+}
+
+// The secondary index and multi-record commands are indirected through package variables so unit
+// tests can mock them without a live cluster.
+var (
+	// createQueryIndex creates the secondary index of the query bin on the namespace and returns
+	// the completion of the index task.
+	createQueryIndex = func(e *AerospikeEndpoint, policy *as.WritePolicy, namespace string) (<-chan as.Error, as.Error) {
+		conf := e.ClusterConfig.genericConfig
+		task, err := e.Client.CreateIndex(policy, namespace, conf.MonitoringSet, queryIndexName(conf), conf.QueryIndexBin, as.NUMERIC)
+		if err != nil {
+			return nil, err
+		}
+		return task.OnComplete(), nil
+	}
+
+	// queryRecords runs the query and returns the records it returned.
+	queryRecords = func(e *AerospikeEndpoint, policy *as.QueryPolicy, stmt *as.Statement) ([]*as.Record, error) {
+		rs, err := e.Client.Query(policy, stmt)
+		if err != nil {
+			return nil, err
+		}
+		return recordsOf(rs)
+	}
+
+	// scanPartitionRecords scans the partitions of the filter and returns the records it returned.
+	scanPartitionRecords = func(e *AerospikeEndpoint, policy *as.ScanPolicy, filter *as.PartitionFilter, namespace string, binNames ...string) ([]*as.Record, error) {
+		rs, err := e.Client.ScanPartitions(policy, filter, namespace, e.ClusterConfig.genericConfig.MonitoringSet, binNames...)
+		if err != nil {
+			return nil, err
+		}
+		return recordsOf(rs)
+	}
+)
+
+func recordsOf(rs *as.Recordset) ([]*as.Record, error) {
+	defer rs.Close()
+	records := []*as.Record{}
+	for res := range rs.Results() {
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		records = append(records, res.Record)
+	}
+	return records, nil
+}
+
+// validateQueryRecords checks that the records returned by the range query are exactly the known
+// records, with their expected values.
+func validateQueryRecords(conf *AerospikeEndpointConfig, records []*as.Record) error {
+	seen := make(map[int]struct{}, conf.QueryKeyTotal)
+	for _, record := range records {
+		i, ok := record.Bins[conf.QueryIndexBin].(int)
+		if !ok {
+			return errors.Errorf("unexpected %s value {%v} returned by query", conf.QueryIndexBin, record.Bins[conf.QueryIndexBin])
+		}
+		if record.Bins["val"] != hash(queryKeyName(conf, i)) {
+			return errors.Errorf("query succeeded but there is a missmatch for record %d: got {%v}", i, record.Bins["val"])
+		}
+		seen[i] = struct{}{}
+	}
+	if len(seen) != conf.QueryKeyTotal {
+		return errors.Errorf("query returned %d of the %d known records", len(seen), conf.QueryKeyTotal)
+	}
+	return nil
+}
+
+// validateScanRecords checks that the records returned by the scan of the partition of the i-th
+// known record contain it, with its expected value.
+func validateScanRecords(conf *AerospikeEndpointConfig, key *as.Key, i int, records []*as.Record) error {
+	found := false
+	for _, record := range records {
+		if string(record.Key.Digest()) != string(key.Digest()) {
+			continue
+		}
+		if record.Bins["val"] != hash(queryKeyName(conf, i)) {
+			return errors.Errorf("scan succeeded but there is a missmatch for %s: got {%v}", keyAsStr(key), record.Bins["val"])
+		}
+		found = true
+	}
+	if !found {
+		return errors.Errorf("scan of the partition of %s did not return it", keyAsStr(key))
+	}
+	return nil
+}
+
+func ScanQueryPrepare(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+	return forEachNamespace(e, 1, func(namespace string) error {
+		return scanQueryPrepareNamespace(e, namespace)
+	})
+}
+
+// scanQueryPrepareNamespace creates the secondary index on the monitoring set and writes the
+// known records the query and the scan are validated against. Records are always rewritten as
+// there are only a few of them.
+func scanQueryPrepareNamespace(e *AerospikeEndpoint, namespace string) error {
+	conf := e.ClusterConfig.genericConfig
+	policy := as.NewWritePolicy(0, as.TTLDontExpire) // No expiration
+	policy.MaxRetries = 2                            // We can retry for preparation (0 is default Client value in v7)
+	policy.TotalTimeout = conf.TotalTimeout          // 0 is default Client value in v7
+	policy.ExitFastOnExhaustedConnectionPool = conf.ExitFastOnExhaustedConnectionPool
+
+	done, err := createQueryIndex(e, policy, namespace)
+	if err != nil && !err.Matches(types.INDEX_FOUND) {
+		return errors.Wrapf(err, "failed to create index %s on namespace %s", queryIndexName(conf), namespace)
+	}
+	if err == nil {
+		if err := <-done; err != nil {
+			return errors.Wrapf(err, "failed to await index %s on namespace %s", queryIndexName(conf), namespace)
+		}
+	}
+
+	for i := 0; i < conf.QueryKeyTotal; i++ {
+		keyName := queryKeyName(conf, i)
+		key, err := as.NewKey(namespace, conf.MonitoringSet, keyName)
+		if err != nil {
+			return err
+		}
+		val := as.BinMap{
+			conf.QueryIndexBin: i,
+			"val":              hash(keyName),
+		}
+		if err := e.Client.Put(policy, key, val); err != nil {
+			return errors.Wrapf(err, "record put failed for: %s", keyAsStr(key))
+		}
+	}
+	level.Debug(e.Logger).Log("msg", fmt.Sprintf("Prepared %d query records on namespace %s", conf.QueryKeyTotal, namespace))
+	return nil
+}
+
+// ScanQueryCheck runs a secondary index query and a single partition scan on every monitored
+// namespace, and validates the results against the records written during prepare. Secondary
+// index queries and scans can break independently of single-record operations (e.g. while an
+// index is rebuilding).
+func ScanQueryCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*AerospikeEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not an aerospike endpoint")
+	}
+	return forEachNamespace(e, namespaceCheckParallelism(len(e.Namespaces)), func(namespace string) error {
+		return scanQueryCheckNamespace(e, namespace)
+	})
+}
+
+func scanQueryCheckNamespace(e *AerospikeEndpoint, namespace string) error {
+	conf := e.ClusterConfig.genericConfig
+	labels := []string{"query", namespace, e.ClusterConfig.clusterName, e.GetName()}
+
+	// QUERY OPERATION: every known record must be returned by a range query on the index
+	queryPolicy := as.NewQueryPolicy()
+	queryPolicy.MaxRetries = 0 // Ensure we never retry
+	queryPolicy.TotalTimeout = conf.TotalTimeout
+	queryPolicy.ExitFastOnExhaustedConnectionPool = conf.ExitFastOnExhaustedConnectionPool
+	opQuery := func() error {
+		stmt := as.NewStatement(namespace, conf.MonitoringSet, conf.QueryIndexBin, "val")
+		if err := stmt.SetFilter(as.NewRangeFilter(conf.QueryIndexBin, 0, int64(conf.QueryKeyTotal-1))); err != nil {
+			return err
+		}
+		records, err := queryRecords(e, queryPolicy, stmt)
+		if err != nil {
+			return err
+		}
+		return validateQueryRecords(conf, records)
+	}
+	if err := observeScanQueryLatency(opQuery, labels); err != nil {
+		return errors.Wrapf(err, "query failed on namespace %s", namespace)
+	}
+
+	// SCAN OPERATION: the partition of a known record must return it (a different record is
+	// picked at each interval to cover different partitions)
+	i := int(time.Now().UnixNano() % int64(conf.QueryKeyTotal))
+	key, err := as.NewKey(namespace, conf.MonitoringSet, queryKeyName(conf, i))
+	if err != nil {
+		return err
+	}
+	scanPolicy := as.NewScanPolicy()
+	scanPolicy.MaxRetries = 0 // Ensure we never retry
+	scanPolicy.TotalTimeout = conf.TotalTimeout
+	scanPolicy.ExitFastOnExhaustedConnectionPool = conf.ExitFastOnExhaustedConnectionPool
+	labels[0] = "scan"
+	opScan := func() error {
+		records, err := scanPartitionRecords(e, scanPolicy, as.NewPartitionFilterByKey(key), namespace, "val")
+		if err != nil {
+			return err
+		}
+		return validateScanRecords(conf, key, i, records)
+	}
+	if err := observeScanQueryLatency(opScan, labels); err != nil {
+		return errors.Wrapf(err, "scan failed on namespace %s", namespace)
+	}
+	level.Debug(e.Logger).Log("msg", fmt.Sprintf("query and scan validated on namespace %s", namespace))
+	return nil
+}
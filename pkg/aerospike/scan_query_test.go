@@ -0,0 +1,205 @@
+package aerospike
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/aerospike/aerospike-client-go/v8/types"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// mockCreateQueryIndex replaces the index creation for the duration of the test, and returns the
+// namespaces it was called on.
+func mockCreateQueryIndex(t *testing.T, createErr as.Error, taskErr as.Error) *[]string {
+	t.Helper()
+	orig := createQueryIndex
+	t.Cleanup(func() { createQueryIndex = orig })
+	namespaces := []string{}
+	createQueryIndex = func(_ *AerospikeEndpoint, _ *as.WritePolicy, namespace string) (<-chan as.Error, as.Error) {
+		namespaces = append(namespaces, namespace)
+		if createErr != nil {
+			return nil, createErr
+		}
+		done := make(chan as.Error, 1)
+		done <- taskErr
+		return done, nil
+	}
+	return &namespaces
+}
+
+func TestScanQueryPrepareStandin(t *testing.T) {
+	standin := newStandinCluster(t, 2, "ns1", "ns2")
+	e := standin.standinEndpoint(t, "", "", func(conf *AerospikeEndpointConfig) {
+		conf.QueryKeyTotal = 10
+	})
+	conf := e.ClusterConfig.genericConfig
+
+	namespaces := mockCreateQueryIndex(t, nil, nil)
+	if err := ScanQueryPrepare(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if strings.Join(*namespaces, ",") != "ns1,ns2" {
+		t.Errorf("expected the index to be created on ns1 and ns2, got %v", *namespaces)
+	}
+	for _, namespace := range []string{"ns1", "ns2"} {
+		if got := standin.recordCount(namespace); got != 10 {
+			t.Errorf("expected 10 query records on %s, got %d", namespace, got)
+		}
+	}
+	key, _ := as.NewKey("ns1", conf.MonitoringSet, queryKeyName(conf, 3))
+	rec, err := e.Client.Get(nil, key)
+	if err != nil {
+		t.Fatalf("failed to get query record: %v", err)
+	}
+	if rec.Bins[conf.QueryIndexBin] != 3 || rec.Bins["val"] != hash(queryKeyName(conf, 3)) {
+		t.Errorf("unexpected query record bins %v", rec.Bins)
+	}
+
+	// An existing index is not an error
+	mockCreateQueryIndex(t, &as.AerospikeError{ResultCode: types.INDEX_FOUND}, nil)
+	if err := ScanQueryPrepare(e); err != nil {
+		t.Fatalf("expected nil error with an existing index, got %v", err)
+	}
+
+	mockCreateQueryIndex(t, &as.AerospikeError{ResultCode: types.INDEX_GENERIC}, nil)
+	if err := ScanQueryPrepare(e); err == nil || !strings.Contains(err.Error(), "failed to create index") {
+		t.Errorf("expected an index creation error, got %v", err)
+	}
+	mockCreateQueryIndex(t, nil, &as.AerospikeError{ResultCode: types.TIMEOUT})
+	if err := ScanQueryPrepare(e); err == nil || !strings.Contains(err.Error(), "failed to await index") {
+		t.Errorf("expected an index task error, got %v", err)
+	}
+}
+
+// queryTestRecords returns the known query records of the namespace, as returned by the query.
+func queryTestRecords(t *testing.T, conf *AerospikeEndpointConfig, namespace string) []*as.Record {
+	t.Helper()
+	records := make([]*as.Record, 0, conf.QueryKeyTotal)
+	for i := 0; i < conf.QueryKeyTotal; i++ {
+		key, err := as.NewKey(namespace, conf.MonitoringSet, queryKeyName(conf, i))
+		if err != nil {
+			t.Fatalf("failed to build key: %v", err)
+		}
+		records = append(records, &as.Record{Key: key, Bins: as.BinMap{
+			conf.QueryIndexBin: i,
+			"val":              hash(queryKeyName(conf, i)),
+		}})
+	}
+	return records
+}
+
+func TestValidateQueryRecords(t *testing.T) {
+	conf := defaultAerospikeClient
+	conf.QueryKeyTotal = 5
+
+	withBin := func(i int, bin string, value interface{}) []*as.Record {
+		records := queryTestRecords(t, &conf, "ns1")
+		records[i].Bins[bin] = value
+		return records
+	}
+	for name, tc := range map[string]struct {
+		records []*as.Record
+		err     string
+	}{
+		"all records":     {queryTestRecords(t, &conf, "ns1"), ""},
+		"missing record":  {queryTestRecords(t, &conf, "ns1")[1:], "query returned 4 of the 5 known records"},
+		"duplicates":      {append(queryTestRecords(t, &conf, "ns1")[1:], queryTestRecords(t, &conf, "ns1")[1]), "query returned 4 of the 5"},
+		"wrong value":     {withBin(2, "val", "corrupted"), "missmatch for record 2"},
+		"wrong index bin": {withBin(2, conf.QueryIndexBin, "2"), "unexpected query_idx value"},
+	} {
+		err := validateQueryRecords(&conf, tc.records)
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: expected nil error, got %v", name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: expected error %q, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestValidateScanRecords(t *testing.T) {
+	conf := defaultAerospikeClient
+	conf.QueryKeyTotal = 5
+	records := queryTestRecords(t, &conf, "ns1")
+	key := records[2].Key
+
+	if err := validateScanRecords(&conf, key, 2, records); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if err := validateScanRecords(&conf, key, 2, records[3:]); err == nil || !strings.Contains(err.Error(), "did not return it") {
+		t.Errorf("expected a missing record error, got %v", err)
+	}
+	records[2].Bins["val"] = "corrupted"
+	if err := validateScanRecords(&conf, key, 2, records); err == nil || !strings.Contains(err.Error(), "missmatch") {
+		t.Errorf("expected a mismatch error, got %v", err)
+	}
+}
+
+func TestScanQueryCheck(t *testing.T) {
+	conf := defaultAerospikeClient
+	conf.QueryKeyTotal = 5
+	cluster := authTestCluster(t)
+	e := &AerospikeEndpoint{
+		Name:       cluster,
+		Namespaces: []string{"ns1"},
+		Logger:     log.NewNopLogger(),
+		ClusterConfig: &AerospikeClientConfig{
+			clusterName:   cluster,
+			genericConfig: &conf,
+		},
+	}
+
+	origQuery, origScan := queryRecords, scanPartitionRecords
+	defer func() { queryRecords, scanPartitionRecords = origQuery, origScan }()
+	var queryErr, scanErr error
+	queried := queryTestRecords(t, &conf, "ns1")
+	// The scan returns every known record, whatever the scanned partition
+	scanned := queryTestRecords(t, &conf, "ns1")
+	queryRecords = func(_ *AerospikeEndpoint, _ *as.QueryPolicy, stmt *as.Statement) ([]*as.Record, error) {
+		if stmt.Namespace != "ns1" || stmt.Filter == nil {
+			t.Errorf("expected a filtered query on ns1, got %+v", stmt)
+		}
+		return queried, queryErr
+	}
+	scanPartitionRecords = func(_ *AerospikeEndpoint, _ *as.ScanPolicy, _ *as.PartitionFilter, _ string, _ ...string) ([]*as.Record, error) {
+		return scanned, scanErr
+	}
+	failures := func(operation string) float64 {
+		return testutil.ToFloat64(scanQueryFailuresTotal.WithLabelValues(operation, "ns1", cluster, cluster))
+	}
+
+	if err := ScanQueryCheck(e); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if failures("query") != 0 || failures("scan") != 0 {
+		t.Fatal("expected no failure")
+	}
+
+	queryErr = errors.New("index not readable")
+	if err := ScanQueryCheck(e); err == nil || !strings.Contains(err.Error(), "query failed") {
+		t.Errorf("expected a query error, got %v", err)
+	}
+	queryErr, queried = nil, queried[1:]
+	if err := ScanQueryCheck(e); err == nil || !strings.Contains(err.Error(), "query returned 4") {
+		t.Errorf("expected a query result error, got %v", err)
+	}
+	if failures("query") != 2 || failures("scan") != 0 {
+		t.Errorf("expected 2 query failures and no scan failure, got %v and %v", failures("query"), failures("scan"))
+	}
+
+	queried = queryTestRecords(t, &conf, "ns1")
+	scanErr = errors.New("partition unavailable")
+	if err := ScanQueryCheck(e); err == nil || !strings.Contains(err.Error(), "scan failed") {
+		t.Errorf("expected a scan error, got %v", err)
+	}
+	scanErr, scanned = nil, nil
+	if err := ScanQueryCheck(e); err == nil || !strings.Contains(err.Error(), "did not return it") {
+		t.Errorf("expected a scan result error, got %v", err)
+	}
+	if failures("scan") != 2 {
+		t.Errorf("expected 2 scan failures, got %v", failures("scan"))
+	}
+}
@@ -0,0 +1,673 @@
+package aerospike
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	as "github.com/aerospike/aerospike-client-go/v8"
+	"github.com/aerospike/aerospike-client-go/v8/pkg/bcrypt"
+	"github.com/aerospike/aerospike-client-go/v8/types"
+	particleType "github.com/aerospike/aerospike-client-go/v8/types/particle_type"
+	"github.com/criteo/blackbox-prober/pkg/common"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log"
+)
+
+// Wire protocol constants used by the stand-in (see the aerospike client command.go,
+// admin_command.go and login_command.go).
+const (
+	standinProtoVersion = 2
+	standinTypeInfo     = 1
+	standinTypeAdmin    = 2
+	standinTypeMessage  = 3
+
+	standinMsgHeaderSize   = 22
+	standinAdminHeaderSize = 16
+
+	standinInfo1Read      = 1 << 0
+	standinInfo1GetAll    = 1 << 1
+	standinInfo1NoBinData = 1 << 5
+	standinInfo2Write     = 1 << 0
+	standinInfo2Delete    = 1 << 1
+
+	standinFieldNamespace = 0
+	standinFieldDigest    = 4
+
+	standinOpRead  = 1
+	standinOpWrite = 2
+
+	standinAdminAuthenticate = 0
+	standinAdminLogin        = 20
+	standinAdminUser         = 0
+	standinAdminCredential   = 3
+	standinAdminToken        = 5
+	standinAdminTTL          = 6
+
+	standinTTLDontExpire = 0xFFFFFFFF
+	standinTTLDontUpdate = 0xFFFFFFFE
+
+	// Static salt used by the client to hash passwords
+	standinPasswordSalt = "$2a$10$7EqJtq98hPqEX7fNZaFWoO"
+)
+
+// standinCluster is an in-process stand-in for an aerospike cluster. It speaks enough of the wire
+// protocol (info, login and single record commands) for the checks to run end-to-end against the
+// real client. Records are shared by all nodes, as if they were replicated everywhere: dropping a
+// node only moves its partitions to the surviving nodes.
+type standinCluster struct {
+	t          *testing.T
+	namespaces []string
+
+	mu         sync.Mutex
+	nodes      []*standinNode
+	generation int
+	// Hashed password of each user. Security is disabled if users is nil. External (LDAP) logins
+	// are not supported: the client only sends clear passwords over TLS.
+	users   map[string]string
+	tokens  map[string]string // session token -> user
+	records map[string]map[[20]byte]*standinRecord
+	// Namespaces on which writes are rejected for lack of privileges
+	deniedWrites map[string]bool
+	// Rack of each node (same index as nodes), racks are not supported if nil
+	racks []int
+}
+
+type standinNode struct {
+	cluster  *standinCluster
+	name     string
+	listener net.Listener
+
+	mu    sync.Mutex
+	down  bool
+	conns map[net.Conn]struct{}
+}
+
+type standinBin struct {
+	particle byte
+	data     []byte
+}
+
+type standinRecord struct {
+	bins       map[string]standinBin
+	generation uint32
+	voidTime   time.Time // zero if the record never expires
+}
+
+// newStandinCluster starts nodeCount nodes on the loopback, holding the given namespaces. They are
+// stopped at the end of the test.
+func newStandinCluster(t *testing.T, nodeCount int, namespaces ...string) *standinCluster {
+	t.Helper()
+	c := &standinCluster{
+		t:          t,
+		namespaces: namespaces,
+		generation: 1,
+		tokens:     make(map[string]string),
+		records:    make(map[string]map[[20]byte]*standinRecord),
+
+		deniedWrites: make(map[string]bool),
+	}
+	for _, namespace := range namespaces {
+		c.records[namespace] = make(map[[20]byte]*standinRecord)
+	}
+	for i := 0; i < nodeCount; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to start stand-in node: %v", err)
+		}
+		node := &standinNode{
+			cluster:  c,
+			name:     fmt.Sprintf("BB9%012X", i+1),
+			listener: listener,
+			conns:    make(map[net.Conn]struct{}),
+		}
+		c.nodes = append(c.nodes, node)
+		go node.serve()
+	}
+	t.Cleanup(func() {
+		for i := range c.nodes {
+			c.stopNode(i)
+		}
+	})
+	return c
+}
+
+// hosts returns the seeds of the cluster (all nodes, including stopped ones).
+func (c *standinCluster) hosts() []*as.Host {
+	hosts := make([]*as.Host, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		hosts = append(hosts, standinHost(node))
+	}
+	return hosts
+}
+
+func standinHost(node *standinNode) *as.Host {
+	addr := node.listener.Addr().(*net.TCPAddr)
+	return as.NewHost(addr.IP.String(), addr.Port)
+}
+
+// setUser enables security and sets the password of the user. Sessions already open stay valid.
+func (c *standinCluster) setUser(user string, password string) {
+	hashed, err := bcrypt.Hash(password, standinPasswordSalt)
+	if err != nil {
+		c.t.Fatalf("failed to hash password: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.users == nil {
+		c.users = make(map[string]string)
+	}
+	c.users[user] = hashed
+}
+
+// denyWrites rejects the writes on the namespace, as if the write privilege had been revoked.
+func (c *standinCluster) denyWrites(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deniedWrites[namespace] = true
+}
+
+// setRacks sets the rack of each node, in the order of the nodes.
+func (c *standinCluster) setRacks(racks ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.racks = racks
+}
+
+// rackInfo answers the `rack-ids` command of the node, and the `racks` command of the cluster.
+func (n *standinNode) rackInfo() (string, string) {
+	c := n.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.racks == nil {
+		return "", ""
+	}
+	nodesByRack := map[int][]string{}
+	rackIds := []int{}
+	nodeRack := 0
+	for i, node := range c.nodes {
+		if _, ok := nodesByRack[c.racks[i]]; !ok {
+			rackIds = append(rackIds, c.racks[i])
+		}
+		nodesByRack[c.racks[i]] = append(nodesByRack[c.racks[i]], node.name)
+		if node == n {
+			nodeRack = c.racks[i]
+		}
+	}
+	sort.Ints(rackIds)
+	ids := make([]string, 0, len(c.namespaces))
+	racks := make([]string, 0, len(c.namespaces))
+	for _, namespace := range c.namespaces {
+		ids = append(ids, fmt.Sprintf("%s:%d", namespace, nodeRack))
+		entry := "ns=" + namespace
+		for _, rack := range rackIds {
+			entry += fmt.Sprintf(":rack_%d=%s", rack, strings.Join(nodesByRack[rack], ","))
+		}
+		racks = append(racks, entry)
+	}
+	return strings.Join(ids, ";"), strings.Join(racks, ";")
+}
+
+// stopNode closes the listener and the connections of the node, and moves its partitions to the
+// surviving nodes.
+func (c *standinCluster) stopNode(i int) {
+	node := c.nodes[i]
+	node.mu.Lock()
+	if node.down {
+		node.mu.Unlock()
+		return
+	}
+	node.down = true
+	node.listener.Close()
+	for conn := range node.conns {
+		conn.Close()
+	}
+	node.mu.Unlock()
+
+	c.mu.Lock()
+	c.generation++
+	c.mu.Unlock()
+}
+
+func (c *standinCluster) liveNodes() []*standinNode {
+	live := make([]*standinNode, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		node.mu.Lock()
+		if !node.down {
+			live = append(live, node)
+		}
+		node.mu.Unlock()
+	}
+	return live
+}
+
+func standinDigest(t *testing.T, namespace string, set string, keyName string) [20]byte {
+	t.Helper()
+	key, err := as.NewKey(namespace, set, keyName)
+	if err != nil {
+		t.Fatalf("failed to build key: %v", err)
+	}
+	var digest [20]byte
+	copy(digest[:], key.Digest())
+	return digest
+}
+
+// setStringBin overwrites a string bin of a stored record, behind the back of the client.
+func (c *standinCluster) setStringBin(namespace string, set string, keyName string, bin string, value string) {
+	digest := standinDigest(c.t, namespace, set, keyName)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rec, ok := c.records[namespace][digest]
+	if !ok {
+		c.t.Fatalf("no record %s/%s/%s in the stand-in", namespace, set, keyName)
+	}
+	rec.bins[bin] = standinBin{particle: particleType.STRING, data: []byte(value)}
+}
+
+// dropRecord removes a stored record, behind the back of the client.
+func (c *standinCluster) dropRecord(namespace string, set string, keyName string) {
+	digest := standinDigest(c.t, namespace, set, keyName)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.records[namespace], digest)
+}
+
+// recordCount returns the number of live records of the namespace.
+func (c *standinCluster) recordCount(namespace string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, rec := range c.records[namespace] {
+		if rec.voidTime.IsZero() || time.Now().Before(rec.voidTime) {
+			n++
+		}
+	}
+	return n
+}
+
+func (n *standinNode) serve() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		n.mu.Lock()
+		if n.down {
+			n.mu.Unlock()
+			conn.Close()
+			return
+		}
+		n.conns[conn] = struct{}{}
+		n.mu.Unlock()
+		go n.handle(conn)
+	}
+}
+
+// handle answers the messages of a client connection until it is closed.
+func (n *standinNode) handle(conn net.Conn) {
+	defer func() {
+		n.mu.Lock()
+		delete(n.conns, conn)
+		n.mu.Unlock()
+		conn.Close()
+	}()
+
+	authenticated := false
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		proto := binary.BigEndian.Uint64(header)
+		body := make([]byte, proto&0xFFFFFFFFFFFF)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		var msgType byte
+		var response []byte
+		switch byte(proto >> 48) {
+		case standinTypeInfo:
+			msgType, response = standinTypeInfo, n.info(body)
+		case standinTypeAdmin:
+			msgType, response = standinTypeAdmin, n.cluster.admin(body, &authenticated)
+		case standinTypeMessage:
+			msgType, response = standinTypeMessage, n.cluster.message(body, authenticated)
+		default:
+			return
+		}
+
+		frame := make([]byte, 8+len(response))
+		binary.BigEndian.PutUint64(frame, uint64(standinProtoVersion)<<56|uint64(msgType)<<48|uint64(len(response)))
+		copy(frame[8:], response)
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// info answers each info command (one per line) with `name\tvalue`. Unknown commands get an empty
+// value.
+func (n *standinNode) info(body []byte) []byte {
+	c := n.cluster
+	live := c.liveNodes()
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	var res strings.Builder
+	for _, command := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+		value := ""
+		switch command {
+		case "node":
+			value = n.name
+		case "build":
+			value = "8.0.0.0"
+		case "partition-generation", "peers-generation":
+			value = strconv.Itoa(generation)
+		case "peers-clear-std":
+			peers := []string{}
+			for _, node := range live {
+				if node != n {
+					peers = append(peers, fmt.Sprintf("[%s,,[%s]]", node.name, node.listener.Addr()))
+				}
+			}
+			value = fmt.Sprintf("%d,%d,[%s]", generation, 3000, strings.Join(peers, ","))
+		case "replicas":
+			value = n.replicas(live)
+		case "namespaces":
+			value = strings.Join(c.namespaces, ";")
+		case "statistics":
+			value = fmt.Sprintf("cluster_size=%d", len(live))
+		case "rack-ids":
+			value, _ = n.rackInfo()
+		case "racks":
+			_, value = n.rackInfo()
+		}
+		fmt.Fprintf(&res, "%s\t%s\n", command, value)
+	}
+	return []byte(res.String())
+}
+
+// replicas returns the partitions owned by the node: the master of partition p is live[p%N] and
+// its replica live[(p+1)%N].
+func (n *standinNode) replicas(live []*standinNode) string {
+	replicaCount := 2
+	if len(live) < replicaCount {
+		replicaCount = len(live)
+	}
+	namespaces := make([]string, 0, len(n.cluster.namespaces))
+	for _, namespace := range n.cluster.namespaces {
+		bitmaps := make([]string, 0, replicaCount)
+		for replica := 0; replica < replicaCount; replica++ {
+			bitmap := make([]byte, partitionCount/8)
+			for p := 0; p < partitionCount; p++ {
+				if live[(p+replica)%len(live)] == n {
+					bitmap[p>>3] |= 0x80 >> uint(p&7)
+				}
+			}
+			bitmaps = append(bitmaps, base64.StdEncoding.EncodeToString(bitmap))
+		}
+		namespaces = append(namespaces, fmt.Sprintf("%s:0,%d,%s", namespace, replicaCount, strings.Join(bitmaps, ",")))
+	}
+	return strings.Join(namespaces, ";")
+}
+
+type standinField struct {
+	id   byte
+	data []byte
+}
+
+func parseStandinFields(buf []byte, count int) ([]standinField, []byte) {
+	fields := make([]standinField, 0, count)
+	for i := 0; i < count && len(buf) >= 5; i++ {
+		size := int(binary.BigEndian.Uint32(buf))
+		fields = append(fields, standinField{id: buf[4], data: buf[5 : 4+size]})
+		buf = buf[4+size:]
+	}
+	return fields, buf
+}
+
+func appendStandinField(buf []byte, id byte, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)+1))
+	buf = append(buf, id)
+	return append(buf, data...)
+}
+
+// admin answers the internal login (credentials checked against the hashed password) and the
+// authentication of new connections (session token).
+func (c *standinCluster) admin(body []byte, authenticated *bool) []byte {
+	command := body[2]
+	fields, _ := parseStandinFields(body[standinAdminHeaderSize:], int(body[3]))
+	values := make(map[byte]string, len(fields))
+	for _, field := range fields {
+		values[field.id] = string(field.data)
+	}
+
+	response := make([]byte, standinAdminHeaderSize)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.users == nil {
+		response[1] = byte(types.SECURITY_NOT_ENABLED)
+		*authenticated = true
+		return response
+	}
+
+	switch command {
+	case standinAdminLogin:
+		password, ok := c.users[values[standinAdminUser]]
+		if !ok {
+			response[1] = byte(types.INVALID_USER)
+			return response
+		}
+		if values[standinAdminCredential] != password {
+			response[1] = byte(types.INVALID_PASSWORD)
+			return response
+		}
+		token := utils.RandomHex(16)
+		c.tokens[token] = values[standinAdminUser]
+		*authenticated = true
+		response[3] = 2
+		response = appendStandinField(response, standinAdminToken, []byte(token))
+		return appendStandinField(response, standinAdminTTL, binary.BigEndian.AppendUint32(nil, 86400))
+	case standinAdminAuthenticate:
+		if user, ok := c.tokens[values[standinAdminToken]]; !ok || user != values[standinAdminUser] {
+			response[1] = byte(types.INVALID_CREDENTIAL)
+			return response
+		}
+		*authenticated = true
+		return response
+	default:
+		response[1] = byte(types.PARAMETER_ERROR)
+		return response
+	}
+}
+
+// message answers single record commands: put (a null bin deletes the bin), delete, exists and
+// get (all bins or named bins). Other commands fail with a parameter error.
+func (c *standinCluster) message(body []byte, authenticated bool) []byte {
+	info1, info2 := body[1], body[2]
+	expiration := binary.BigEndian.Uint32(body[10:14])
+	fields, buf := parseStandinFields(body[standinMsgHeaderSize:], int(binary.BigEndian.Uint16(body[18:20])))
+	opCount := int(binary.BigEndian.Uint16(body[20:22]))
+
+	var namespace string
+	var digest [20]byte
+	for _, field := range fields {
+		switch field.id {
+		case standinFieldNamespace:
+			namespace = string(field.data)
+		case standinFieldDigest:
+			copy(digest[:], field.data)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.users != nil && !authenticated {
+		return standinResult(types.NOT_AUTHENTICATED, nil, nil)
+	}
+	records, ok := c.records[namespace]
+	if !ok {
+		return standinResult(types.INVALID_NAMESPACE, nil, nil)
+	}
+	rec, exists := records[digest]
+	if exists && !rec.voidTime.IsZero() && !time.Now().Before(rec.voidTime) {
+		delete(records, digest)
+		rec, exists = nil, false
+	}
+
+	if info2&standinInfo2Write != 0 {
+		if c.deniedWrites[namespace] {
+			return standinResult(types.ROLE_VIOLATION, nil, nil)
+		}
+		if info2&standinInfo2Delete != 0 {
+			if !exists {
+				return standinResult(types.KEY_NOT_FOUND_ERROR, nil, nil)
+			}
+			delete(records, digest)
+			return standinResult(types.OK, nil, nil)
+		}
+		if !exists {
+			rec = &standinRecord{bins: make(map[string]standinBin)}
+		}
+		for i := 0; i < opCount; i++ {
+			size := int(binary.BigEndian.Uint32(buf))
+			op, particle, nameLen := buf[4], buf[5], int(buf[7])
+			name := string(buf[8 : 8+nameLen])
+			data := append([]byte(nil), buf[8+nameLen:4+size]...)
+			buf = buf[4+size:]
+			if op != standinOpWrite {
+				return standinResult(types.PARAMETER_ERROR, nil, nil)
+			}
+			if particle == particleType.NULL {
+				delete(rec.bins, name)
+			} else {
+				rec.bins[name] = standinBin{particle: particle, data: data}
+			}
+		}
+		switch expiration {
+		case standinTTLDontUpdate:
+		case standinTTLDontExpire, 0:
+			rec.voidTime = time.Time{}
+		default:
+			rec.voidTime = time.Now().Add(time.Duration(expiration) * time.Second)
+		}
+		rec.generation++
+		if len(rec.bins) == 0 {
+			delete(records, digest)
+		} else {
+			records[digest] = rec
+		}
+		return standinResult(types.OK, rec, nil)
+	}
+
+	if info1&standinInfo1Read == 0 {
+		return standinResult(types.PARAMETER_ERROR, nil, nil)
+	}
+	if !exists {
+		return standinResult(types.KEY_NOT_FOUND_ERROR, nil, nil)
+	}
+	if info1&standinInfo1NoBinData != 0 {
+		return standinResult(types.OK, rec, nil)
+	}
+	names := []string{}
+	if info1&standinInfo1GetAll != 0 {
+		for name := range rec.bins {
+			names = append(names, name)
+		}
+	} else {
+		for i := 0; i < opCount; i++ {
+			size := int(binary.BigEndian.Uint32(buf))
+			if buf[4] != standinOpRead {
+				return standinResult(types.PARAMETER_ERROR, nil, nil)
+			}
+			nameLen := int(buf[7])
+			names = append(names, string(buf[8:8+nameLen]))
+			buf = buf[4+size:]
+		}
+	}
+	return standinResult(types.OK, rec, names)
+}
+
+// standinResult builds the response to a record command, with the named bins of the record.
+func standinResult(resultCode types.ResultCode, rec *standinRecord, names []string) []byte {
+	response := make([]byte, standinMsgHeaderSize)
+	response[0] = standinMsgHeaderSize
+	response[5] = byte(resultCode)
+	if rec != nil {
+		binary.BigEndian.PutUint32(response[6:10], rec.generation)
+	}
+	opCount := 0
+	for _, name := range names {
+		bin, ok := rec.bins[name]
+		if !ok {
+			continue
+		}
+		response = binary.BigEndian.AppendUint32(response, uint32(4+len(name)+len(bin.data)))
+		response = append(response, standinOpRead, bin.particle, 0, byte(len(name)))
+		response = append(response, name...)
+		response = append(response, bin.data...)
+		opCount++
+	}
+	binary.BigEndian.PutUint16(response[20:22], uint16(opCount))
+	return response
+}
+
+// standinEndpoint returns a connected endpoint monitoring all the namespaces of the stand-in,
+// with a small durability key range and a fast tend. The configuration can be adjusted before
+// connecting.
+func (c *standinCluster) standinEndpoint(t *testing.T, user string, password string, configure func(*AerospikeEndpointConfig)) *AerospikeEndpoint {
+	t.Helper()
+	conf := defaultAerospikeClient
+	conf.DurabilityKeyTotal = 20
+	conf.TendInterval = 50 * time.Millisecond
+	conf.TotalTimeout = 2 * time.Second
+	conf.ConnectionTimeout = time.Second
+	if configure != nil {
+		configure(&conf)
+	}
+
+	clusterName := authTestCluster(t)
+	e := &AerospikeEndpoint{
+		Name:         clusterName,
+		ClusterLevel: true,
+		ClusterName:  clusterName,
+		Logger:       log.NewNopLogger(),
+		Namespaces:   c.namespaces,
+		ClusterConfig: &AerospikeClientConfig{
+			clusterName:   clusterName,
+			authEnabled:   user != "",
+			username:      user,
+			password:      password,
+			hosts:         c.hosts(),
+			genericConfig: &conf,
+			nodeInfoCache: map[string]*common.ClusterNodeInfo{},
+		},
+	}
+	if err := e.Connect(); err != nil {
+		t.Fatalf("failed to connect to the stand-in: %v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// waitForNodes waits until the client of the endpoint sees count nodes.
+func waitForNodes(t *testing.T, e *AerospikeEndpoint, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(e.Client.GetNodes()) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the client to see %d nodes, got %d", count, len(e.Client.GetNodes()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package milvus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/go-kit/log/level"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var authCheckTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: MVSuffix + "_auth_check_total",
+	Help: "Total number of authentication attempts with a fresh client per outcome. " +
+		"status: success | auth_failure | connection_error",
+}, []string{"namespace", "cluster", "probe_endpoint", "status"})
+
+// authStatus values double as the `status` label on auth_check_total.
+const (
+	authStatusSuccess   = "success"
+	authStatusAuthFail  = "auth_failure"
+	authStatusConnError = "connection_error"
+)
+
+// authErrorStatus classifies an error of a fresh client: rejected credentials or missing
+// privileges are auth failures, anything else is a connection error.
+func authErrorStatus(err error) string {
+	switch merr.Code(err) {
+	case merr.Code(merr.ErrPrivilegeNotAuthenticated), merr.Code(merr.ErrPrivilegeNotPermitted):
+		return authStatusAuthFail
+	}
+	// gRPC status of the interceptors, possibly wrapped
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unauthenticated, codes.PermissionDenied:
+			return authStatusAuthFail
+		}
+	}
+	return authStatusConnError
+}
+
+// freshListCollections is indirected through a package variable so unit tests can mock it
+// without a live cluster. It opens a brand-new client with the configuration of the endpoint
+// client (address, credentials, TLS), lists the collections of the monitoring database, which
+// requires privileges on it, and closes the client.
+var freshListCollections = func(e *MilvusEndpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Config.AuthCheckTimeout)
+	defer cancel()
+
+	config := e.ClientConfig
+	config.DBName = e.Config.MonitoringDatabase
+	client, err := milvusclient.New(ctx, &config)
+	if err != nil {
+		return err
+	}
+	defer client.Close(context.Background())
+
+	_, err = client.ListCollections(ctx, milvusclient.NewListCollectionOption())
+	return err
+}
+
+// AuthCheck verifies that a brand-new client can still authenticate and is still granted the
+// privileges of the probe, contrary to the other checks that reuse the client created once by
+// Connect, which keeps working after credentials are revoked or RBAC is broken. Auth failures
+// fail the check, connection errors are counted only (connectivity is surfaced elsewhere) so
+// the scheduler's auth_check failure signal stays specific to authentication.
+func AuthCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+
+	// Nothing to verify if authentication is disabled for this cluster.
+	if !e.Config.AuthEnabled {
+		return nil
+	}
+
+	status := authStatusSuccess
+	err := freshListCollections(e)
+	if err != nil {
+		status = authErrorStatus(err)
+	}
+	authCheckTotal.WithLabelValues(e.Config.MonitoringDatabase, e.ClusterName, e.GetName(), status).Inc()
+
+	switch status {
+	case authStatusAuthFail:
+		level.Error(e.Logger).Log("msg", "Fresh authentication failed", "err", err)
+		return errors.Wrap(err, "fresh authentication failed")
+	case authStatusConnError:
+		level.Error(e.Logger).Log("msg", "Failed to open connection for auth check", "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package milvus
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status string
+	}{
+		{status.Error(codes.Unauthenticated, "auth check failure"), authStatusAuthFail},
+		{errors.Wrap(status.Error(codes.PermissionDenied, "denied"), "list collections"), authStatusAuthFail},
+		{merr.WrapErrPrivilegeNotPermitted("ShowCollections"), authStatusAuthFail},
+		{status.Error(codes.Unavailable, "connection refused"), authStatusConnError},
+		{errors.New("context deadline exceeded"), authStatusConnError},
+	}
+	for _, tt := range tests {
+		if got := authErrorStatus(tt.err); got != tt.status {
+			t.Errorf("%v: expected %s, got %s", tt.err, tt.status, got)
+		}
+	}
+}
+
+func TestAuthCheck(t *testing.T) {
+	e := &MilvusEndpoint{Name: "auth_test", ClusterName: "auth_test_cluster", Logger: log.NewNopLogger(), Config: defaultMilvusEndpointConfig}
+	e.Config.AuthEnabled = true
+	labels := func(status string) []string {
+		return []string{e.Config.MonitoringDatabase, e.ClusterName, e.Name, status}
+	}
+
+	origList := freshListCollections
+	defer func() { freshListCollections = origList }()
+
+	var listErr error
+	freshListCollections = func(_ *MilvusEndpoint) error { return listErr }
+
+	if err := AuthCheck(e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listErr = status.Error(codes.Unavailable, "connection refused")
+	if err := AuthCheck(e); err != nil {
+		t.Fatalf("expected connection errors not to fail the check, got %v", err)
+	}
+	listErr = status.Error(codes.Unauthenticated, "auth check failure")
+	if err := AuthCheck(e); err == nil {
+		t.Fatal("expected AuthCheck to fail when authentication is rejected")
+	}
+	for _, s := range []string{authStatusSuccess, authStatusConnError, authStatusAuthFail} {
+		if got := testutil.ToFloat64(authCheckTotal.WithLabelValues(labels(s)...)); got != 1 {
+			t.Errorf("expected 1 %s, got %v", s, got)
+		}
+	}
+
+	// Nothing is attempted when auth is disabled
+	e.Config.AuthEnabled = false
+	if err := AuthCheck(e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := testutil.ToFloat64(authCheckTotal.WithLabelValues(labels(authStatusAuthFail)...)); got != 1 {
+		t.Errorf("expected no attempt with auth disabled, got %v auth failures", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -33,12 +34,12 @@ var opLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Name:    MVSuffix + "_op_latency",
 	Help:    "Latency for operations",
 	Buckets: utils.MetricHistogramBuckets,
-}, []string{"operation", "endpoint", "namespace", "cluster", "id"})
+}, []string{"operation", "endpoint", "namespace", "cluster", "id", "partition"})
 
 var opFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: MVSuffix + "_op_latency_failures",
 	Help: "Total number of operations that resulted in failure",
-}, []string{"operation", "endpoint", "namespace", "cluster", "id"})
+}, []string{"operation", "endpoint", "namespace", "cluster", "id", "partition"})
 
 var durabilityExpectedItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Name: MVSuffix + "_durability_expected_items",
@@ -55,15 +56,53 @@ var durabilityCorruptedItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Help: "Total number of items found to be corrupted for durability",
 }, []string{"namespace", "cluster", "probe_endpoint"})
 
+var durabilityMissingItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_durability_missing_items",
+	Help: "Total number of items expected for durability but not found",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+var durabilityPersistedRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_durability_persisted_rows",
+	Help: "Number of rows of the flushed (persisted to object storage) segments of the durability collection",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+var durabilityUnpersistedRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_durability_unpersisted_rows",
+	Help: "Number of durability items (with the init flag) exceeding the rows of the flushed segments, lost on query node restart",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+var durabilityPartitionExpectedItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_durability_partition_expected_items",
+	Help: "Number of items expected for durability in a partition",
+}, []string{"partition", "namespace", "cluster", "probe_endpoint"})
+
+var durabilityPartitionFoundItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_durability_partition_found_items",
+	Help: "Number of items found with correct value for durability in a partition",
+}, []string{"partition", "namespace", "cluster", "probe_endpoint"})
+
+var durabilityPartitionCorruptedItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_durability_partition_corrupted_items",
+	Help: "Number of items found to be corrupted for durability in a partition",
+}, []string{"partition", "namespace", "cluster", "probe_endpoint"})
+
+var durabilityPartitionMissingItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_durability_partition_missing_items",
+	Help: "Number of items expected for durability in a partition but not found",
+}, []string{"partition", "namespace", "cluster", "probe_endpoint"})
+
 const (
 	// Vector setup
-	DIMENSION   = 100
-	TOP_K       = 1
-	METRIC_TYPE = entity.COSINE
+	SPARSE_NON_ZEROS = 16 // Non-zero values of the generated sparse vectors
+	// Maximum difference between a stored vector component and the expected one
+	VECTOR_TOLERANCE = 1e-6
 
 	// Init
 	MAX_VARCHAR_LEN         = 256
 	INITIAL_VALUE_HEX_BYTES = 128 // 128 hex chars <= 256
+
+	// Query
+	MAX_QUERY_RESULT_WINDOW = 16384 // offset+limit of a query cannot exceed this (queryNode.maxQueryResultWindow)
 )
 
 func ObserveOpLatency(op func() error, labels []string) error {
@@ -161,8 +200,43 @@ func ensureMonitoringDB(ctx context.Context, e *MilvusEndpoint) error {
 	return nil
 }
 
-// ensureCollection creates schema+index and loads the collection in current DB.
-func ensureCollection(ctx context.Context, e *MilvusEndpoint, collectionName string, cl entity.ConsistencyLevel) error {
+// useMonitoringDB uses the monitoring DB without creating it, for the checks which must not
+// change the cluster.
+func useMonitoringDB(ctx context.Context, e *MilvusEndpoint) error {
+	db := e.Config.MonitoringDatabase
+	tctx, cancel := context.WithTimeout(ctx, e.Config.CreateDatabaseTimeout)
+	defer cancel()
+	if err := e.Client.UseDatabase(tctx, milvusclient.NewUseDatabaseOption(db)); err != nil {
+		return errors.Wrapf(err, "use database %q", db)
+	}
+	return nil
+}
+
+// ensureCollection creates schema+exact index (FLAT, BIN_FLAT or sparse inverted index) and loads
+// the collection in current DB.
+func ensureCollection(ctx context.Context, e *MilvusEndpoint, collectionName string, cl entity.ConsistencyLevel, vector VectorConfig) error {
+	return ensureCollectionWithIndex(ctx, e, collectionName, cl, vector, vector.exactIndex())
+}
+
+// ensureCollectionWithIndex creates schema+index and loads the collection in current DB. The index
+// of an existing collection is left untouched.
+func ensureCollectionWithIndex(ctx context.Context, e *MilvusEndpoint, collectionName string, cl entity.ConsistencyLevel, vector VectorConfig, idx mvindex.Index) error {
+	return ensureCollectionWithSchema(ctx, e, collectionName, cl, monitoringSchema(collectionName, vector), map[string]mvindex.Index{"vector": idx})
+}
+
+// monitoringSchema returns the schema of the monitoring collections: id, key, value and vector.
+func monitoringSchema(collectionName string, vector VectorConfig) *entity.Schema {
+	return entity.NewSchema().
+		WithName(collectionName).
+		WithField(entity.NewField().WithName("id").WithDataType(entity.FieldTypeInt64).WithIsPrimaryKey(true).WithIsAutoID(false)).
+		WithField(entity.NewField().WithName("key").WithDataType(entity.FieldTypeVarChar).WithMaxLength(MAX_VARCHAR_LEN)).
+		WithField(entity.NewField().WithName("value").WithDataType(entity.FieldTypeVarChar).WithMaxLength(MAX_VARCHAR_LEN)).
+		WithField(vector.field())
+}
+
+// ensureCollectionWithSchema creates the collection with the given schema and indexes (by field)
+// and loads it in current DB. The schema and indexes of an existing collection are left untouched.
+func ensureCollectionWithSchema(ctx context.Context, e *MilvusEndpoint, collectionName string, cl entity.ConsistencyLevel, schema *entity.Schema, indexes map[string]mvindex.Index) error {
 	has, err := e.Client.HasCollection(ctx, milvusclient.NewHasCollectionOption(collectionName))
 	if err != nil {
 		return errors.Wrap(err, "failed to check if collection exists")
@@ -188,31 +262,29 @@ func ensureCollection(ctx context.Context, e *MilvusEndpoint, collectionName str
 		return nil
 	}
 
-	schema := entity.NewSchema().
-		WithName(collectionName).
-		WithField(entity.NewField().WithName("id").WithDataType(entity.FieldTypeInt64).WithIsPrimaryKey(true).WithIsAutoID(false)).
-		WithField(entity.NewField().WithName("key").WithDataType(entity.FieldTypeVarChar).WithMaxLength(MAX_VARCHAR_LEN)).
-		WithField(entity.NewField().WithName("value").WithDataType(entity.FieldTypeVarChar).WithMaxLength(MAX_VARCHAR_LEN)).
-		WithField(entity.NewField().WithName("vector").WithDataType(entity.FieldTypeFloatVector).WithDim(DIMENSION))
-
 	if err := e.Client.CreateCollection(ctx, milvusclient.NewCreateCollectionOption(collectionName, schema).WithConsistencyLevel(cl)); err != nil {
 		return errors.Wrap(err, "failed to create collection")
 	}
 	level.Info(e.Logger).Log("msg", "Created collection", "collection", collectionName)
 
-	{
+	fields := make([]string, 0, len(indexes))
+	for field := range indexes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		idx := indexes[field]
 		tctx, indexCancel := context.WithTimeout(ctx, e.Config.IndexTimeout)
 		defer indexCancel()
-		idx := mvindex.NewFlatIndex(METRIC_TYPE)
-		createIdxTask, err := e.Client.CreateIndex(tctx, milvusclient.NewCreateIndexOption(collectionName, "vector", idx))
+		createIdxTask, err := e.Client.CreateIndex(tctx, milvusclient.NewCreateIndexOption(collectionName, field, idx))
 		if err != nil {
-			return errors.Wrap(err, "failed to create index")
+			return errors.Wrapf(err, "failed to create index on %s", field)
 		}
 		if err := createIdxTask.Await(tctx); err != nil {
-			return errors.Wrap(err, "failed to await index creation")
+			return errors.Wrapf(err, "failed to await index creation on %s", field)
 		}
+		level.Info(e.Logger).Log("msg", "Created index", "collection", collectionName, "field", field, "index_type", idx.Params()[mvindex.IndexTypeKey])
 	}
-	level.Info(e.Logger).Log("msg", "Created FLAT index", "collection", collectionName)
 
 	{
 		tctx, loadCancel := context.WithTimeout(ctx, e.Config.LoadTimeout)
@@ -230,8 +302,22 @@ func ensureCollection(ctx context.Context, e *MilvusEndpoint, collectionName str
 	return nil
 }
 
-// initCollectionIfNeeded populates a collection with INIT_ITEMS_PER_COL items once.
-func initCollectionIfNeeded(ctx context.Context, e *MilvusEndpoint, collectionName, keyPrefix string) error {
+// initCollectionIfNeeded populates a collection with INIT_ITEMS_PER_COL items once, spread across
+// its partitions.
+func initCollectionIfNeeded(ctx context.Context, e *MilvusEndpoint, collectionName, keyPrefix string, vector VectorConfig, partitions PartitionConfig) error {
+	return initCollectionWithColumnsIfNeeded(ctx, e, collectionName, keyPrefix, partitions, func(ids []int64, keys []string) []mvcol.Column {
+		vecs := make([]entity.Vector, len(keys))
+		for i, k := range keys {
+			vecs[i] = vector.deterministicVector(k)
+		}
+		return append([]mvcol.Column{vector.column(vecs)}, partitions.columns(ids)...)
+	})
+}
+
+// initCollectionWithColumnsIfNeeded populates a collection with INIT_ITEMS_PER_COL items once. The
+// columns besides id, key and value are built by columns from the ids and keys. Items are upserted
+// in their explicit partition, if any.
+func initCollectionWithColumnsIfNeeded(ctx context.Context, e *MilvusEndpoint, collectionName, keyPrefix string, partitions PartitionConfig, columns func(ids []int64, keys []string) []mvcol.Column) error {
 	flagKey := fmt.Sprintf("%s%s", keyPrefix, e.Config.InitFlagKey)
 	expectedFlagValue := fmt.Sprintf("v1:%d", e.Config.InitItemsPerCollection)
 
@@ -264,7 +350,6 @@ func initCollectionIfNeeded(ctx context.Context, e *MilvusEndpoint, collectionNa
 		ids := make([]int64, n)
 		keys := make([]string, n)
 		values := make([]string, n)
-		vecs := make([][]float32, n)
 
 		for i := 0; i < n; i++ {
 			id := int64(base + i)
@@ -272,37 +357,49 @@ func initCollectionIfNeeded(ctx context.Context, e *MilvusEndpoint, collectionNa
 			ids[i] = id
 			keys[i] = k
 			values[i] = hash(k)
-			vecs[i] = normalizeVector(generateDeterministicArbitraryVector(DIMENSION, k))
 		}
 
-		insertCtx, insertCancel := context.WithTimeout(ctx, e.Config.InsertTimeout)
-		defer insertCancel()
+		order, groups := partitions.groupByPartition(ids)
+		for _, partition := range order {
+			group := groups[partition]
+			pIDs := make([]int64, len(group))
+			pKeys := make([]string, len(group))
+			pValues := make([]string, len(group))
+			for i, idx := range group {
+				pIDs[i] = ids[idx]
+				pKeys[i] = keys[idx]
+				pValues[i] = values[idx]
+			}
 
-		_, err := e.Client.Upsert(insertCtx,
-			milvusclient.NewColumnBasedInsertOption(collectionName).
-				WithInt64Column("id", ids).
-				WithVarcharColumn("key", keys).
-				WithVarcharColumn("value", values).
-				WithFloatVectorColumn("vector", DIMENSION, vecs),
-		)
+			insertCtx, insertCancel := context.WithTimeout(ctx, e.Config.InsertTimeout)
+			defer insertCancel()
 
-		if err != nil {
-			return errors.Wrapf(err, "insert batch %d-%d", base, end)
+			_, err := e.Client.Upsert(insertCtx,
+				milvusclient.NewColumnBasedInsertOption(collectionName).
+					WithPartition(partitions.insertPartition(partition)).
+					WithInt64Column("id", pIDs).
+					WithVarcharColumn("key", pKeys).
+					WithVarcharColumn("value", pValues).
+					WithColumns(columns(pIDs, pKeys)...),
+			)
+
+			if err != nil {
+				return errors.Wrapf(err, "insert batch %d-%d", base, end)
+			}
 		}
 	}
 
 	{
-		vec := normalizeVector(generateDeterministicArbitraryVector(DIMENSION, flagKey))
-
 		insertInitFlagCtx, insertInitFlagCancel := context.WithTimeout(ctx, e.Config.InsertTimeout)
 		defer insertInitFlagCancel()
 
 		_, err := e.Client.Upsert(insertInitFlagCtx,
 			milvusclient.NewColumnBasedInsertOption(collectionName).
+				WithPartition(partitions.insertPartition(partitions.of(int64(e.Config.InitItemsPerCollection)))).
 				WithInt64Column("id", []int64{int64(e.Config.InitItemsPerCollection)}).
 				WithVarcharColumn("key", []string{flagKey}).
 				WithVarcharColumn("value", []string{expectedFlagValue}).
-				WithFloatVectorColumn("vector", DIMENSION, [][]float32{vec}),
+				WithColumns(columns([]int64{int64(e.Config.InitItemsPerCollection)}, []string{flagKey})...),
 		)
 		if err != nil {
 			return errors.Wrap(err, "insert init flag")
@@ -338,24 +435,25 @@ func LatencyPrepare(p topology.ProbeableEndpoint) error {
 		return err
 	}
 
-	if err := ensureCollection(ctx, e, e.Config.MonitoringCollectionLatencyRW, entity.ClStrong); err != nil {
+	if err := ensurePartitionedCollection(ctx, e, e.Config.MonitoringCollectionLatencyRW, entity.ClStrong, e.Config.LatencyVector); err != nil {
 		return errors.Wrapf(err, "ensure %s", e.Config.MonitoringCollectionLatencyRW)
 	}
-	if err := initCollectionIfNeeded(ctx, e, e.Config.MonitoringCollectionLatencyRW, e.Config.LatencyInitKeyPrefix); err != nil {
+	if err := initCollectionIfNeeded(ctx, e, e.Config.MonitoringCollectionLatencyRW, e.Config.LatencyInitKeyPrefix, e.Config.LatencyVector, e.Config.Partitions); err != nil {
 		return errors.Wrapf(err, "init latency %s", e.Config.MonitoringCollectionLatencyRW)
 	}
 
-	if err := ensureCollection(ctx, e, e.Config.MonitoringCollectionLatencyRO, entity.DefaultConsistencyLevel); err != nil {
+	if err := ensurePartitionedCollection(ctx, e, e.Config.MonitoringCollectionLatencyRO, entity.DefaultConsistencyLevel, e.Config.LatencyVector); err != nil {
 		return errors.Wrapf(err, "ensure %s", e.Config.MonitoringCollectionLatencyRO)
 	}
-	if err := initCollectionIfNeeded(ctx, e, e.Config.MonitoringCollectionLatencyRO, e.Config.LatencyInitKeyPrefix); err != nil {
+	if err := initCollectionIfNeeded(ctx, e, e.Config.MonitoringCollectionLatencyRO, e.Config.LatencyInitKeyPrefix, e.Config.LatencyVector, e.Config.Partitions); err != nil {
 		return errors.Wrapf(err, "init latency %s", e.Config.MonitoringCollectionLatencyRO)
 	}
 
 	return nil
 }
 
-// LatencyCheck: RW collection insert/search/delete. Then search-only on latency RO.
+// LatencyCheck ensures the DB and the latency collections exist, then runs the latency
+// operations (see latencyOperations).
 func LatencyCheck(p topology.ProbeableEndpoint) error {
 	e, ok := p.(*MilvusEndpoint)
 	if !ok {
@@ -366,61 +464,90 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 	if err := ensureMonitoringDB(ctx, e); err != nil {
 		return err
 	}
+	if err := ensurePartitionedCollection(ctx, e, e.Config.MonitoringCollectionLatencyRW, entity.ClStrong, e.Config.LatencyVector); err != nil {
+		return errors.Wrap(err, "ensure latency RW collection")
+	}
+	if err := ensurePartitionedCollection(ctx, e, e.Config.MonitoringCollectionLatencyRO, entity.DefaultConsistencyLevel, e.Config.LatencyVector); err != nil {
+		return errors.Wrap(err, "ensure latency RO collection")
+	}
+	return latencyOperations(ctx, e)
+}
+
+// ProxyLatencyCheck runs the latency operations through a single proxy. The DB and the
+// collections are created by the cluster latency check: they are never created through a proxy,
+// so a missing one fails the check.
+func ProxyLatencyCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+
+	ctx := context.Background()
+	if err := useMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+	return latencyOperations(ctx, e)
+}
 
+// latencyOperations: RW collection insert/search/delete. Then search-only on latency RO. When the
+// collections are partitioned, the RW items of a check are all in one partition (rotating between
+// checks) and every RO search is restricted to the partition of the searched item, the latency
+// being reported per partition.
+func latencyOperations(ctx context.Context, e *MilvusEndpoint) error {
 	// RW path
 	{
 		col := e.Config.MonitoringCollectionLatencyRW
-		if err := ensureCollection(ctx, e, col, entity.ClStrong); err != nil {
-			return errors.Wrap(err, "ensure latency RW collection")
-		}
-
 		now := time.Now().UnixNano()
+		partitions := e.Config.Partitions
+		partition := partitions.of(now)
+		// Ids of the same partition
+		stride := int64(1)
+		if partitions.enabled() {
+			stride = int64(partitions.Count)
+		}
 		insertCount := e.Config.LatencyRWInsertPerCheck
 		ids := make([]int64, insertCount)
-		vecs := make([][]float32, insertCount)
+		vecs := make([]entity.Vector, insertCount)
 		keys := make([]string, insertCount)
 		vals := make([]string, insertCount)
 		for i := 0; i < insertCount; i++ {
-			ids[i] = now + int64(i)
-			vecs[i] = normalizeVector(generateRandomVector(DIMENSION))
+			ids[i] = now + int64(i)*stride
+			vecs[i] = e.Config.LatencyVector.randomVector()
 			keys[i] = e.Config.LatencyRWKeyPrefix + utils.RandomHex(20)
 			vals[i] = utils.RandomHex(INITIAL_VALUE_HEX_BYTES)
 		}
 
-		labels := []string{"insert", e.Name, e.Config.MonitoringDatabase, e.ClusterName, e.Name}
 		opInsert := func() error {
 			insertCtx, insertCancel := context.WithTimeout(ctx, e.Config.InsertTimeout)
 			defer insertCancel()
 
 			if _, err := e.Client.Insert(insertCtx,
 				milvusclient.NewColumnBasedInsertOption(col).
+					WithPartition(partitions.insertPartition(partition)).
 					WithInt64Column("id", ids).
 					WithVarcharColumn("key", keys).
 					WithVarcharColumn("value", vals).
-					WithFloatVectorColumn("vector", DIMENSION, vecs),
+					WithColumns(e.Config.LatencyVector.column(vecs)).
+					WithColumns(partitions.columns(ids)...),
 			); err != nil {
 				return err
 			}
 
 			return nil
 		}
-		if err := ObserveOpLatency(opInsert, labels); err != nil {
+		if err := ObserveOpLatency(opInsert, e.partitionOpLabels("insert", partition)); err != nil {
 			return errors.Wrap(err, "insert batch")
 		}
 
-		labels[0] = "search"
 		opSearch := func() error {
-			qvecs := make([]entity.Vector, len(vecs))
-			for i := range vecs {
-				qvecs[i] = entity.FloatVector(vecs[i])
-			}
-
 			searchCtx, searchCancel := context.WithTimeout(ctx, e.Config.SearchTimeout)
 			defer searchCancel()
 
 			rs, err := e.Client.Search(searchCtx,
-				milvusclient.NewSearchOption(col, TOP_K, qvecs).
+				milvusclient.NewSearchOption(col, e.Config.LatencyTopK, vecs).
 					WithANNSField("vector").
+					WithPartitions(partitions.searchPartitions(partition)...).
+					WithFilter(partitions.filter("", partition)).
 					WithOutputFields("id"))
 			if err != nil {
 				return err
@@ -442,11 +569,10 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 			}
 			return nil
 		}
-		if err := ObserveOpLatency(opSearch, labels); err != nil {
+		if err := ObserveOpLatency(opSearch, e.partitionOpLabels("search", partition)); err != nil {
 			return errors.Wrap(err, "search batch")
 		}
 
-		labels[0] = "delete"
 		opDelete := func() error {
 			deleteCtx, deleteCancel := context.WithTimeout(ctx, e.Config.DeleteTimeout)
 			defer deleteCancel()
@@ -464,7 +590,7 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 
 			return nil
 		}
-		if err := ObserveOpLatency(opDelete, labels); err != nil {
+		if err := ObserveOpLatency(opDelete, e.partitionOpLabels("delete", partition)); err != nil {
 			return errors.Wrap(err, "delete batch")
 		}
 	}
@@ -472,9 +598,7 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 	// RO search latency
 	{
 		col := e.Config.MonitoringCollectionLatencyRO
-		if err := ensureCollection(ctx, e, col, entity.DefaultConsistencyLevel); err != nil {
-			return errors.Wrap(err, "ensure latency RO collection")
-		}
+		partitions := e.Config.Partitions
 
 		sampleIDs := sampleUniqueInts(e.Config.LatencyRWInsertPerCheck, e.Config.InitItemsPerCollection)
 		q := fmt.Sprintf("id in [%s]", joinInts(sampleIDs))
@@ -494,19 +618,23 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 			return errors.New("latency RO: missing id or vector in query result")
 		}
 		idCol := idColI.(*mvcol.ColumnInt64)
-		vecCol := vecColI.(*mvcol.ColumnFloatVector)
 
-		searchLabels := []string{"search_ro", e.Name, e.Config.MonitoringDatabase, e.ClusterName, e.Name}
 		for i := 0; i < idCol.Len(); i++ {
 			id := idCol.Data()[i]
-			vec := vecCol.Data()[i]
+			partition := partitions.of(id)
+			vec, err := vectorAt(vecColI, i)
+			if err != nil {
+				return errors.Wrap(err, "latency RO: read vector")
+			}
 			opSearch := func() error {
 				searchRoCtx, searchRoCancel := context.WithTimeout(ctx, e.Config.SearchTimeout)
 				defer searchRoCancel()
 
 				rs, err := e.Client.Search(searchRoCtx,
-					milvusclient.NewSearchOption(col, TOP_K, []entity.Vector{entity.FloatVector(vec)}).
+					milvusclient.NewSearchOption(col, e.Config.LatencyTopK, []entity.Vector{vec}).
 						WithANNSField("vector").
+						WithPartitions(partitions.searchPartitions(partition)...).
+						WithFilter(partitions.filter("", partition)).
 						WithOutputFields("id"))
 				if err != nil {
 					return err
@@ -520,7 +648,7 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 				}
 				return nil
 			}
-			if err := ObserveOpLatency(opSearch, searchLabels); err != nil {
+			if err := ObserveOpLatency(opSearch, e.partitionOpLabels("search_ro", partition)); err != nil {
 				level.Warn(e.Logger).Log("msg", "latency RO search failed", "err", err)
 			}
 		}
@@ -540,16 +668,18 @@ func DurabilityPrepare(p topology.ProbeableEndpoint) error {
 	if err := ensureMonitoringDB(ctx, e); err != nil {
 		return err
 	}
-	if err := ensureCollection(ctx, e, e.Config.MonitoringCollectionDurability, entity.DefaultConsistencyLevel); err != nil {
+	if err := ensurePartitionedCollection(ctx, e, e.Config.MonitoringCollectionDurability, entity.DefaultConsistencyLevel, e.Config.DurabilityVector); err != nil {
 		return errors.Wrap(err, "ensure durability")
 	}
-	if err := initCollectionIfNeeded(ctx, e, e.Config.MonitoringCollectionDurability, e.Config.DurabilityKeyPrefix); err != nil {
+	if err := initCollectionIfNeeded(ctx, e, e.Config.MonitoringCollectionDurability, e.Config.DurabilityKeyPrefix, e.Config.DurabilityVector, e.Config.Partitions); err != nil {
 		return errors.Wrap(err, "init durability")
 	}
 	return nil
 }
 
-// DurabilityCheck validates pre-loaded durability records and updates metrics.
+// DurabilityCheck validates pre-loaded durability records and updates metrics. When the collection
+// is partitioned, the items are also reported by the partition metrics, in the partition of their
+// id.
 func DurabilityCheck(p topology.ProbeableEndpoint) error {
 	e, ok := p.(*MilvusEndpoint)
 	if !ok {
@@ -561,28 +691,181 @@ func DurabilityCheck(p topology.ProbeableEndpoint) error {
 	}
 
 	col := e.Config.MonitoringCollectionDurability
-	if err := ensureCollection(ctx, e, col, entity.DefaultConsistencyLevel); err != nil {
+	if err := ensurePartitionedCollection(ctx, e, col, entity.DefaultConsistencyLevel, e.Config.DurabilityVector); err != nil {
 		return errors.Wrap(err, "ensure durability collection")
 	}
 
-	qo := milvusclient.NewQueryOption(col).
-		WithFilter(fmt.Sprintf("id >= 0 && id < %d", e.Config.InitItemsPerCollection)).
-		WithOutputFields("id", "key", "value").
-		WithLimit(e.Config.InitItemsPerCollection)
+	// Sweep the items page by page (id ranges) to stay under the query result window of Milvus.
+	// The pages cover all partitions, the items are counted in the partition of their id.
+	total := e.Config.InitItemsPerCollection
+	partitions := e.Config.Partitions
+	sweep := newDurabilitySweep(partitions, total)
+	for base := 0; base < total; base += e.Config.DurabilityPageSize {
+		end := min(base+e.Config.DurabilityPageSize, total)
+		qr, err := queryDurabilityPage(ctx, e, col, base, end)
+		if err != nil {
+			return errors.Wrapf(err, "query durability items %d-%d", base, end)
+		}
+		if err := verifyDurabilityPage(e, col, qr, sweep); err != nil {
+			return err
+		}
+	}
+
+	if partitions.enabled() {
+		for _, partition := range partitions.partitions() {
+			// Only detects items in the wrong partition, which the sweep counts in the partition
+			// of their id
+			count, err := countDurabilityPartition(ctx, e, col, total, partition)
+			if err != nil {
+				return errors.Wrapf(err, "count durability items of %s", partitionName(partition))
+			}
+			if seen := sweep.seen[partition]; count != int64(seen) {
+				level.Warn(e.Logger).Log("msg", "durability items in the wrong partition", "collection", col, "partition", partitionName(partition), "count", count, "expected", seen)
+			}
+
+			partitionLabels := []string{partitionName(partition), e.Config.MonitoringDatabase, e.ClusterName, e.GetName()}
+			durabilityPartitionExpectedItems.WithLabelValues(partitionLabels...).Set(float64(sweep.expected[partition]))
+			durabilityPartitionFoundItems.WithLabelValues(partitionLabels...).Set(float64(sweep.found[partition]))
+			durabilityPartitionCorruptedItems.WithLabelValues(partitionLabels...).Set(float64(sweep.corrupted[partition]))
+			durabilityPartitionMissingItems.WithLabelValues(partitionLabels...).Set(float64(sweep.missing(partition)))
+		}
+	}
+
+	foundCount, corruptedCount, missingCount := sweep.totals()
+	if missingCount > 0 {
+		level.Warn(e.Logger).Log("msg", "durability missing items detected", "collection", col, "missing_count", missingCount)
+	}
+
+	labels := []string{e.Config.MonitoringDatabase, e.ClusterName, e.GetName()}
+	durabilityExpectedItems.WithLabelValues(labels...).Set(float64(total))
+	durabilityFoundItems.WithLabelValues(labels...).Set(float64(foundCount))
+	durabilityCorruptedItems.WithLabelValues(labels...).Set(float64(corruptedCount))
+	durabilityMissingItems.WithLabelValues(labels...).Set(float64(missingCount))
+
+	// Items served by the query nodes may not be persisted yet
+	segmentCtx, segmentCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+	defer segmentCancel()
+	segments, err := e.Client.GetPersistentSegmentInfo(segmentCtx, milvusclient.NewGetPersistentSegmentInfoOption(col))
+	if err != nil {
+		return errors.Wrap(err, "get durability persistent segments")
+	}
+	persisted, unpersisted := persistedRows(segments, int64(total)+1)
+	if unpersisted > 0 {
+		level.Warn(e.Logger).Log("msg", "durability items not persisted", "collection", col, "persisted_rows", persisted, "unpersisted_rows", unpersisted)
+	}
+	durabilityPersistedRows.WithLabelValues(labels...).Set(float64(persisted))
+	durabilityUnpersistedRows.WithLabelValues(labels...).Set(float64(unpersisted))
+
+	return nil
+}
+
+// persistedRows returns the number of rows of the flushed segments, and the number of expected
+// rows exceeding it. Rows deleted (overwritten by upserts) but not compacted yet are still counted
+// in the flushed segments, so the unpersisted rows are a lower bound.
+func persistedRows(segments []*entity.Segment, expected int64) (int64, int64) {
+	var persisted int64
+	for _, segment := range segments {
+		if segment.Flushed() {
+			persisted += segment.NumRows
+		}
+	}
+	return persisted, max(expected-persisted, 0)
+}
+
+// queryDurabilityPage returns the durability items (of all partitions) whose id is in [base, end).
+func queryDurabilityPage(ctx context.Context, e *MilvusEndpoint, col string, base, end int) (milvusclient.ResultSet, error) {
+	queryCtx, queryCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+	defer queryCancel()
+
+	return e.Client.Query(queryCtx, milvusclient.NewQueryOption(col).
+		WithFilter(fmt.Sprintf("id >= %d && id < %d", base, end)).
+		WithOutputFields("id", "key", "value", "vector").
+		WithLimit(end-base))
+}
 
+// countDurabilityPartition returns the number of durability items (ids in [0, total)) stored in
+// a partition.
+func countDurabilityPartition(ctx context.Context, e *MilvusEndpoint, col string, total int, partition int) (int64, error) {
 	queryCtx, queryCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
 	defer queryCancel()
 
-	qr, err := e.Client.Query(queryCtx, qo)
+	partitions := e.Config.Partitions
+	qr, err := e.Client.Query(queryCtx, milvusclient.NewQueryOption(col).
+		WithFilter(partitions.filter(fmt.Sprintf("id >= 0 && id < %d", total), partition)).
+		WithPartitions(partitions.searchPartitions(partition)...).
+		WithOutputFields("count(*)"))
 	if err != nil {
-		return errors.Wrap(err, "query durability items")
+		return 0, err
 	}
+	countCol, ok := qr.GetColumn("count(*)").(*mvcol.ColumnInt64)
+	if !ok || countCol.Len() != 1 {
+		return 0, errors.New("durability count query missing count(*) column")
+	}
+	return countCol.Data()[0], nil
+}
 
+// durabilitySweep counts the durability items found by a sweep in the partition of their id (-1
+// when partitioning is disabled).
+type durabilitySweep struct {
+	partitions PartitionConfig
+	seenIDs    map[int64]struct{}
+	expected   map[int]int
+	seen       map[int]int // found or corrupted
+	found      map[int]int
+	corrupted  map[int]int
+}
+
+func newDurabilitySweep(partitions PartitionConfig, total int) *durabilitySweep {
+	s := &durabilitySweep{
+		partitions: partitions,
+		seenIDs:    make(map[int64]struct{}, total),
+		expected:   make(map[int]int),
+		seen:       make(map[int]int),
+		found:      make(map[int]int),
+		corrupted:  make(map[int]int),
+	}
+	for id := 0; id < total; id++ {
+		s.expected[partitions.of(int64(id))]++
+	}
+	return s
+}
+
+// add records an expected item, once, and whether it is corrupted.
+func (s *durabilitySweep) add(id int64, corrupted bool) {
+	if _, ok := s.seenIDs[id]; ok {
+		return
+	}
+	s.seenIDs[id] = struct{}{}
+	partition := s.partitions.of(id)
+	s.seen[partition]++
+	if corrupted {
+		s.corrupted[partition]++
+	} else {
+		s.found[partition]++
+	}
+}
+
+func (s *durabilitySweep) missing(partition int) int {
+	return s.expected[partition] - s.seen[partition]
+}
+
+// totals returns the found, corrupted and missing items of all partitions.
+func (s *durabilitySweep) totals() (found, corrupted, missing int) {
+	for partition, expected := range s.expected {
+		found += s.found[partition]
+		corrupted += s.corrupted[partition]
+		missing += expected - s.seen[partition]
+	}
+	return found, corrupted, missing
+}
+
+func verifyDurabilityPage(e *MilvusEndpoint, col string, qr milvusclient.ResultSet, sweep *durabilitySweep) error {
 	idColI := qr.GetColumn("id")
 	keyColI := qr.GetColumn("key")
 	valColI := qr.GetColumn("value")
-	if idColI == nil || keyColI == nil || valColI == nil {
-		return errors.New("durability query missing id/key/value column")
+	vecColI := qr.GetColumn("vector")
+	if idColI == nil || keyColI == nil || valColI == nil || vecColI == nil {
+		return errors.New("durability query missing id/key/value/vector column")
 	}
 
 	idCol, ok := idColI.(*mvcol.ColumnInt64)
@@ -597,26 +880,19 @@ func DurabilityCheck(p topology.ProbeableEndpoint) error {
 	if !ok {
 		return errors.New("durability query value column type mismatch")
 	}
-
-	if keyCol.Len() != idCol.Len() || valCol.Len() != idCol.Len() {
-		return errors.Errorf("durability query column length mismatch id=%d key=%d value=%d", idCol.Len(), keyCol.Len(), valCol.Len())
+	if keyCol.Len() != idCol.Len() || valCol.Len() != idCol.Len() || vecColI.Len() != idCol.Len() {
+		return errors.Errorf("durability query column length mismatch id=%d key=%d value=%d vector=%d", idCol.Len(), keyCol.Len(), valCol.Len(), vecColI.Len())
 	}
 
-	expectedTotal := float64(e.Config.InitItemsPerCollection)
-	var foundCount float64
-	var corruptedCount float64
-	seenIDs := make(map[int64]struct{}, idCol.Len())
 	keyPrefix := e.Config.DurabilityKeyPrefix
 
 	for i := 0; i < idCol.Len(); i++ {
 		id := idCol.Data()[i]
 		key := keyCol.Data()[i]
 		val := valCol.Data()[i]
-
-		if id >= 0 && id < int64(e.Config.InitItemsPerCollection) {
-			seenIDs[id] = struct{}{}
-		} else {
-			level.Warn(e.Logger).Log("msg", "durability unexpected id range", "collection", col, "id", id, "key", key)
+		vec, err := vectorAt(vecColI, i)
+		if err != nil {
+			return errors.Wrap(err, "durability query vector column")
 		}
 
 		if !strings.HasPrefix(key, keyPrefix) {
@@ -624,23 +900,21 @@ func DurabilityCheck(p topology.ProbeableEndpoint) error {
 		}
 
 		expectedVal := hash(key)
-		if val != expectedVal {
-			corruptedCount++
+		corrupted := true
+		switch {
+		case val != expectedVal:
 			level.Warn(e.Logger).Log("msg", "durability data mismatch", "collection", col, "key", key, "expected", expectedVal, "actual", val)
-		} else {
-			foundCount++
+		case !vectorsMatch(vec, e.Config.DurabilityVector.deterministicVector(key)):
+			level.Warn(e.Logger).Log("msg", "durability vector mismatch", "collection", col, "key", key)
+		default:
+			corrupted = false
 		}
-	}
 
-	missingCount := e.Config.InitItemsPerCollection - len(seenIDs)
-	if missingCount > 0 {
-		level.Warn(e.Logger).Log("msg", "durability missing items detected", "collection", col, "missing_count", missingCount)
+		if id < 0 || id >= int64(e.Config.InitItemsPerCollection) {
+			level.Warn(e.Logger).Log("msg", "durability unexpected id range", "collection", col, "id", id, "key", key)
+			continue
+		}
+		sweep.add(id, corrupted)
 	}
-
-	labels := []string{e.Config.MonitoringDatabase, e.ClusterName, e.GetName()}
-	durabilityExpectedItems.WithLabelValues(labels...).Set(expectedTotal)
-	durabilityFoundItems.WithLabelValues(labels...).Set(foundCount)
-	durabilityCorruptedItems.WithLabelValues(labels...).Set(corruptedCount)
-
 	return nil
 }
@@ -0,0 +1,134 @@
+package milvus
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"gopkg.in/yaml.v2"
+)
+
+func durabilityPage(vector VectorConfig, prefix string, ids []int64, corrupt func(i int, value *string, vec *entity.Vector)) milvusclient.ResultSet {
+	keys := make([]string, len(ids))
+	values := make([]string, len(ids))
+	vecs := make([]entity.Vector, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf("%s%d", prefix, id)
+		values[i] = hash(keys[i])
+		vecs[i] = vector.deterministicVector(keys[i])
+		if corrupt != nil {
+			corrupt(i, &values[i], &vecs[i])
+		}
+	}
+	return milvusclient.ResultSet{Fields: milvusclient.DataSet{
+		mvcol.NewColumnInt64("id", ids),
+		mvcol.NewColumnVarChar("key", keys),
+		mvcol.NewColumnVarChar("value", values),
+		vector.column(vecs),
+	}}
+}
+
+func TestVerifyDurabilityPage(t *testing.T) {
+	for _, vectorType := range []string{vectorTypeFloat, vectorTypeFloat16, vectorTypeBinary, vectorTypeSparse} {
+		t.Run(vectorType, func(t *testing.T) {
+			e := &MilvusEndpoint{Logger: log.NewNopLogger(), Config: defaultMilvusEndpointConfig}
+			e.Config.InitItemsPerCollection = 10
+			if err := yaml.Unmarshal([]byte("{type: "+vectorType+", dimension: 128}"), &e.Config.DurabilityVector); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			vector := e.Config.DurabilityVector
+			prefix := e.Config.DurabilityKeyPrefix
+
+			sweep := newDurabilitySweep(e.Config.Partitions, e.Config.InitItemsPerCollection)
+			if err := verifyDurabilityPage(e, "col", durabilityPage(vector, prefix, []int64{0, 1, 2, 3}, nil), sweep); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if found, corrupted, _ := sweep.totals(); found != 4 || corrupted != 0 {
+				t.Fatalf("expected 4 valid items, got found=%d corrupted=%d", found, corrupted)
+			}
+
+			page := durabilityPage(vector, prefix, []int64{4, 5, 6, 42}, func(i int, value *string, vec *entity.Vector) {
+				switch i {
+				case 0:
+					*value = "corrupted"
+				case 1:
+					*vec = vector.deterministicVector("another key")
+				}
+			})
+			if err := verifyDurabilityPage(e, "col", page, sweep); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Corrupted items are still present, only 7, 8 and 9 are missing (42 is not expected)
+			if found, corrupted, missing := sweep.totals(); found != 5 || corrupted != 2 || missing != 3 {
+				t.Fatalf("expected 5 valid, 2 corrupted and 3 missing items, got found=%d corrupted=%d missing=%d", found, corrupted, missing)
+			}
+
+			page.Fields = page.Fields[:3]
+			if err := verifyDurabilityPage(e, "col", page, sweep); err == nil {
+				t.Fatal("expected an error without the vector column")
+			}
+		})
+	}
+}
+
+func TestDurabilitySweepPartitions(t *testing.T) {
+	sweep := newDurabilitySweep(PartitionConfig{Mode: partitionModeKey, Count: 3}, 10)
+	for _, id := range []int64{0, 1, 3, 4, 6, 9} {
+		sweep.add(id, id == 4)
+	}
+	// Items seen twice (e.g. overlapping pages) are counted once
+	sweep.add(0, false)
+
+	// Partition 0: 0, 3, 6, 9 - partition 1: 1, 4, 7 - partition 2: 2, 5, 8
+	tests := []struct {
+		partition                           int
+		expected, found, corrupted, missing int
+	}{
+		{0, 4, 4, 0, 0},
+		{1, 3, 1, 1, 1},
+		{2, 3, 0, 0, 3},
+	}
+	for _, tt := range tests {
+		if sweep.expected[tt.partition] != tt.expected || sweep.found[tt.partition] != tt.found ||
+			sweep.corrupted[tt.partition] != tt.corrupted || sweep.missing(tt.partition) != tt.missing {
+			t.Errorf("partition %d: expected %d/%d/%d/%d expected/found/corrupted/missing, got %d/%d/%d/%d", tt.partition,
+				tt.expected, tt.found, tt.corrupted, tt.missing,
+				sweep.expected[tt.partition], sweep.found[tt.partition], sweep.corrupted[tt.partition], sweep.missing(tt.partition))
+		}
+	}
+	if found, corrupted, missing := sweep.totals(); found != 5 || corrupted != 1 || missing != 4 {
+		t.Fatalf("expected 5 found, 1 corrupted and 4 missing items, got %d, %d and %d", found, corrupted, missing)
+	}
+}
+
+func TestDurabilityPageSizeConfig(t *testing.T) {
+	var conf MilvusEndpointConfig
+	if err := yaml.Unmarshal([]byte("{}"), &conf); err != nil || conf.DurabilityPageSize != 1000 {
+		t.Fatalf("expected the default page size, got %d (err=%v)", conf.DurabilityPageSize, err)
+	}
+	if err := yaml.Unmarshal([]byte("durability_page_size: 20000"), &conf); err == nil {
+		t.Fatal("expected an error with a page size over the query result window")
+	}
+}
+
+func TestPersistedRows(t *testing.T) {
+	segments := []*entity.Segment{
+		{ID: 1, NumRows: 600, State: commonpb.SegmentState_Flushed},
+		{ID: 2, NumRows: 300, State: commonpb.SegmentState_Sealed},
+		{ID: 3, NumRows: 100, State: commonpb.SegmentState_Growing},
+		{ID: 4, NumRows: 400, State: commonpb.SegmentState_Flushed},
+	}
+	persisted, unpersisted := persistedRows(segments, 1001)
+	if persisted != 1000 || unpersisted != 1 {
+		t.Fatalf("expected 1000 persisted and 1 unpersisted rows, got %d and %d", persisted, unpersisted)
+	}
+	// Overwritten rows not compacted yet
+	persisted, unpersisted = persistedRows(segments, 900)
+	if persisted != 1000 || unpersisted != 0 {
+		t.Fatalf("expected 1000 persisted and no unpersisted rows, got %d and %d", persisted, unpersisted)
+	}
+}
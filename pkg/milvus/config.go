@@ -1,10 +1,13 @@
 package milvus
 
 import (
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/criteo/blackbox-prober/pkg/discovery"
 	"github.com/criteo/blackbox-prober/pkg/scheduler"
+	"github.com/pkg/errors"
 )
 
 // Config used to configure the endpoint of Milvus
@@ -31,6 +34,48 @@ type MilvusEndpointConfig struct {
 	InitFlagKey             string `yaml:"init_flag_key,omitempty"`
 	InitItemsPerCollection  int    `yaml:"init_items_per_collection,omitempty"`
 	LatencyRWInsertPerCheck int    `yaml:"latency_rw_insert_per_check,omitempty"`
+	// Number of results of the latency searches (the first one must be the searched item)
+	LatencyTopK int `yaml:"latency_top_k,omitempty"`
+	// Number of items read per query by the durability check
+	DurabilityPageSize int `yaml:"durability_page_size,omitempty"`
+	// Janitor check: latency RW entities older than the threshold are deleted, batch_size at a time
+	LatencyRWLeakThreshold time.Duration `yaml:"latency_rw_leak_threshold,omitempty"`
+	JanitorBatchSize       int           `yaml:"janitor_batch_size,omitempty"`
+	// Partitioning of the latency and durability collections
+	Partitions PartitionConfig `yaml:"partitions,omitempty"`
+
+	// Recall check: one collection per index (<prefix><name>), searched with top_k results
+	MonitoringCollectionRecallPrefix string              `yaml:"monitoring_collection_recall_prefix,omitempty"`
+	RecallKeyPrefix                  string              `yaml:"recall_key_prefix,omitempty"`
+	RecallTopK                       int                 `yaml:"recall_top_k,omitempty"`
+	RecallQueriesPerCheck            int                 `yaml:"recall_queries_per_check,omitempty"`
+	RecallIndexes                    []RecallIndexConfig `yaml:"recall_indexes,omitempty"`
+
+	// Consistency check: inserted items are polled every interval until visible or timeout
+	MonitoringCollectionConsistency string        `yaml:"monitoring_collection_consistency,omitempty"`
+	ConsistencyKeyPrefix            string        `yaml:"consistency_key_prefix,omitempty"`
+	ConsistencyPollInterval         time.Duration `yaml:"consistency_poll_interval,omitempty"`
+	ConsistencyTimeout              time.Duration `yaml:"consistency_timeout,omitempty"`
+
+	// Search check: items have a `category` (id modulo search_categories) and a sparse vector
+	MonitoringCollectionSearch string `yaml:"monitoring_collection_search,omitempty"`
+	SearchKeyPrefix            string `yaml:"search_key_prefix,omitempty"`
+	SearchTopK                 int    `yaml:"search_top_k,omitempty"`
+	SearchCategories           int    `yaml:"search_categories,omitempty"`
+	SearchSparseDimension      int    `yaml:"search_sparse_dimension,omitempty"`
+
+	// Lifecycle check: temporary collections (<prefix><unix time>_<random>) of lifecycle_items
+	// items. Leftovers are dropped once older than lifecycle_leftover_age, so that the
+	// collections of a check running on another probe instance are not dropped
+	LifecycleCollectionPrefix string        `yaml:"lifecycle_collection_prefix,omitempty"`
+	LifecycleItems            int           `yaml:"lifecycle_items,omitempty"`
+	LifecycleLeftoverAge      time.Duration `yaml:"lifecycle_leftover_age,omitempty"`
+
+	// Vector schema of the collections of each check
+	LatencyVector    VectorConfig `yaml:"latency_vector,omitempty"`
+	DurabilityVector VectorConfig `yaml:"durability_vector,omitempty"`
+	RecallVector     VectorConfig `yaml:"recall_vector,omitempty"`
+	SearchVector     VectorConfig `yaml:"search_vector,omitempty"` // float or float16 only
 
 	// Timeouts
 	LoadTimeout           time.Duration `yaml:"load_timeout,omitempty"`
@@ -41,13 +86,39 @@ type MilvusEndpointConfig struct {
 	InitialFlushTimeout   time.Duration `yaml:"initial_flush_timeout,omitempty"`
 	IndexTimeout          time.Duration `yaml:"index_timeout,omitempty"`
 	CreateDatabaseTimeout time.Duration `yaml:"create_database_timeout,omitempty"`
+	// Create, release and drop of the lifecycle collections
+	LifecycleTimeout time.Duration `yaml:"lifecycle_timeout,omitempty"`
+	// Connection and list collections of the fresh client of the auth check
+	AuthCheckTimeout time.Duration `yaml:"auth_check_timeout,omitempty"`
 
 	// Client configuration for probe
 	MaxRetry   uint          `yaml:"max_retry,omitempty"`
 	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
 }
 
+// Index whose recall is measured by the recall check
+type RecallIndexConfig struct {
+	// Suffix of the collection and `index` label, defaults to the lowercased type
+	Name string `yaml:"name,omitempty"`
+	// Index type (HNSW, IVF_FLAT, IVF_SQ8, DISKANN...) and its build params (M, nlist...)
+	Type   string            `yaml:"type"`
+	Params map[string]string `yaml:"params,omitempty"`
+	// Search params (ef, nprobe...)
+	SearchParams map[string]interface{} `yaml:"search_params,omitempty"`
+}
+
+var recallIndexNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
 var (
+	defaultRecallIndexes = []RecallIndexConfig{
+		{
+			Name:         "hnsw",
+			Type:         "HNSW",
+			Params:       map[string]string{"M": "16", "efConstruction": "200"},
+			SearchParams: map[string]interface{}{"ef": 64},
+		},
+	}
+
 	defaultMilvusEndpointConfig = MilvusEndpointConfig{
 		UsernameEnv:                    "MILVUS_USERNAME",
 		PasswordEnv:                    "MILVUS_PASSWORD",
@@ -63,6 +134,37 @@ var (
 		InitFlagKey:             "init_flag",
 		InitItemsPerCollection:  10000,
 		LatencyRWInsertPerCheck: 10,
+		LatencyTopK:             1,
+		DurabilityPageSize:      1000,
+		LatencyRWLeakThreshold:  10 * time.Minute,
+		JanitorBatchSize:        1000,
+		Partitions:              defaultPartitionConfig,
+
+		MonitoringCollectionRecallPrefix: "monitoring_recall_",
+		RecallKeyPrefix:                  "recall_",
+		RecallTopK:                       10,
+		RecallQueriesPerCheck:            10,
+		RecallIndexes:                    defaultRecallIndexes,
+
+		MonitoringCollectionConsistency: "monitoring_consistency",
+		ConsistencyKeyPrefix:            "consistency_",
+		ConsistencyPollInterval:         100 * time.Millisecond,
+		ConsistencyTimeout:              30 * time.Second,
+
+		MonitoringCollectionSearch: "monitoring_search",
+		SearchKeyPrefix:            "search_",
+		SearchTopK:                 10,
+		SearchCategories:           10,
+		SearchSparseDimension:      1000,
+
+		LifecycleCollectionPrefix: "monitoring_lifecycle_",
+		LifecycleItems:            10,
+		LifecycleLeftoverAge:      time.Hour,
+
+		LatencyVector:    defaultVectorConfig,
+		DurabilityVector: defaultVectorConfig,
+		RecallVector:     defaultVectorConfig,
+		SearchVector:     defaultVectorConfig,
 
 		LoadTimeout:           120 * time.Second,
 		SearchTimeout:         120 * time.Second,
@@ -72,6 +174,8 @@ var (
 		InitialFlushTimeout:   300 * time.Second,
 		IndexTimeout:          600 * time.Second,
 		CreateDatabaseTimeout: 600 * time.Second,
+		LifecycleTimeout:      120 * time.Second,
+		AuthCheckTimeout:      15 * time.Second,
 	}
 )
 
@@ -83,6 +187,68 @@ func (c *MilvusEndpointConfig) UnmarshalYAML(unmarshal func(interface{}) error)
 	if err != nil {
 		return err
 	}
+	if strings.HasPrefix(c.LatencyInitKeyPrefix, c.LatencyRWKeyPrefix) || strings.HasPrefix(c.LatencyRWKeyPrefix, c.LatencyInitKeyPrefix) {
+		return errors.Errorf("latency_rw_key_prefix %q and latency_init_key_prefix %q must not be prefixes of each other", c.LatencyRWKeyPrefix, c.LatencyInitKeyPrefix)
+	}
+	if c.LatencyRWLeakThreshold <= 0 {
+		return errors.Errorf("latency_rw_leak_threshold must be positive, got %s", c.LatencyRWLeakThreshold)
+	}
+	if c.JanitorBatchSize <= 0 || c.JanitorBatchSize > MAX_QUERY_RESULT_WINDOW {
+		return errors.Errorf("janitor_batch_size must be between 1 and %d, got %d", MAX_QUERY_RESULT_WINDOW, c.JanitorBatchSize)
+	}
+	if c.DurabilityPageSize <= 0 || c.DurabilityPageSize > MAX_QUERY_RESULT_WINDOW {
+		return errors.Errorf("durability_page_size must be between 1 and %d, got %d", MAX_QUERY_RESULT_WINDOW, c.DurabilityPageSize)
+	}
+	if c.ConsistencyPollInterval <= 0 {
+		return errors.Errorf("consistency_poll_interval must be positive, got %s", c.ConsistencyPollInterval)
+	}
+	if c.SearchVector.Type != vectorTypeFloat && c.SearchVector.Type != vectorTypeFloat16 {
+		return errors.Errorf("search_vector type must be %s or %s, got %s", vectorTypeFloat, vectorTypeFloat16, c.SearchVector.Type)
+	}
+	if c.SearchTopK <= 0 || c.SearchTopK >= c.InitItemsPerCollection {
+		return errors.Errorf("search_top_k must be between 1 and init_items_per_collection (%d) excluded, got %d", c.InitItemsPerCollection, c.SearchTopK)
+	}
+	if c.SearchCategories <= 0 || c.SearchCategories > c.InitItemsPerCollection {
+		return errors.Errorf("search_categories must be between 1 and init_items_per_collection (%d), got %d", c.InitItemsPerCollection, c.SearchCategories)
+	}
+	if c.SearchSparseDimension <= 0 {
+		return errors.Errorf("search_sparse_dimension must be positive, got %d", c.SearchSparseDimension)
+	}
+	if c.LifecycleCollectionPrefix == "" {
+		return errors.New("lifecycle_collection_prefix must not be empty, every matching collection is dropped")
+	}
+	if c.LifecycleItems <= 0 {
+		return errors.Errorf("lifecycle_items must be positive, got %d", c.LifecycleItems)
+	}
+	if c.LifecycleLeftoverAge <= 0 {
+		return errors.Errorf("lifecycle_leftover_age must be positive, got %s", c.LifecycleLeftoverAge)
+	}
+	if c.LatencyTopK <= 0 {
+		return errors.Errorf("latency_top_k must be positive, got %d", c.LatencyTopK)
+	}
+	if c.RecallTopK <= 0 || c.RecallTopK > c.InitItemsPerCollection {
+		return errors.Errorf("recall_top_k must be between 1 and init_items_per_collection (%d), got %d", c.InitItemsPerCollection, c.RecallTopK)
+	}
+	if c.RecallQueriesPerCheck <= 0 {
+		return errors.Errorf("recall_queries_per_check must be positive, got %d", c.RecallQueriesPerCheck)
+	}
+	names := make(map[string]struct{}, len(c.RecallIndexes))
+	for i := range c.RecallIndexes {
+		index := &c.RecallIndexes[i]
+		if index.Type == "" {
+			return errors.Errorf("recall_indexes[%d]: type is required", i)
+		}
+		if index.Name == "" {
+			index.Name = strings.ToLower(index.Type)
+		}
+		if !recallIndexNameRegex.MatchString(index.Name) {
+			return errors.Errorf("recall_indexes[%d]: name %q must only contain letters, digits and underscores", i, index.Name)
+		}
+		if _, ok := names[index.Name]; ok {
+			return errors.Errorf("recall_indexes[%d]: duplicated name %q", i, index.Name)
+		}
+		names[index.Name] = struct{}{}
+	}
 	return nil
 }
 
@@ -98,4 +264,12 @@ type MilvusProbeConfig struct {
 type MilvusChecksConfigs struct {
 	LatencyCheckConfig    scheduler.CheckConfig `yaml:"latency_check,omitempty"`
 	DurabilityCheckConfig scheduler.CheckConfig `yaml:"durability_check,omitempty"`
+	// Latency check run on every proxy directly (node endpoints), besides the load balancer
+	ProxyLatencyCheckConfig scheduler.CheckConfig `yaml:"proxy_latency_check,omitempty"`
+	RecallCheckConfig       scheduler.CheckConfig `yaml:"recall_check,omitempty"`
+	ConsistencyCheckConfig  scheduler.CheckConfig `yaml:"consistency_check,omitempty"`
+	SearchCheckConfig       scheduler.CheckConfig `yaml:"search_check,omitempty"`
+	LifecycleCheckConfig    scheduler.CheckConfig `yaml:"lifecycle_check,omitempty"`
+	AuthCheckConfig         scheduler.CheckConfig `yaml:"auth_check,omitempty"`
+	JanitorCheckConfig      scheduler.CheckConfig `yaml:"janitor_check,omitempty"`
 }
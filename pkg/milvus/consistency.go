@@ -0,0 +1,169 @@
+package milvus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log/level"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var consistencyVisibilityDelay = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    MVSuffix + "_consistency_visibility_delay_seconds",
+	Help:    "Delay between the acknowledgment of an insert and its visibility by queries of a consistency level",
+	Buckets: []float64{.001, .005, .010, .025, .050, .100, .250, .500, 1, 2.5, 5, 10, 30, 60},
+}, []string{"consistency_level", "namespace", "cluster", "probe_endpoint"})
+
+var consistencyVisibilityTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: MVSuffix + "_consistency_visibility_timeouts_total",
+	Help: "Total number of inserts not visible by queries of a consistency level before consistency_timeout",
+}, []string{"consistency_level", "namespace", "cluster", "probe_endpoint"})
+
+// Consistency levels whose staleness is measured
+var stalenessConsistencyLevels = []entity.ConsistencyLevel{entity.ClBounded, entity.ClEventually}
+
+// consistencyMaxPollInterval caps the exponential backoff of the consistency check polls.
+const consistencyMaxPollInterval = 2 * time.Second
+
+// nextPollInterval doubles the interval between two polls, up to consistencyMaxPollInterval.
+func nextPollInterval(interval time.Duration) time.Duration {
+	if interval >= consistencyMaxPollInterval/2 {
+		return consistencyMaxPollInterval
+	}
+	return 2 * interval
+}
+
+// waitVisible calls visible until it returns true, and returns the time it took. The first
+// polls are interval apart, then the interval doubles at each poll (see nextPollInterval), so an
+// item which stays invisible does not flood the cluster with queries. Errors of visible are
+// retried until the timeout.
+func waitVisible(visible func() (bool, error), start time.Time, interval time.Duration, timeout time.Duration) (time.Duration, error) {
+	var lastErr error
+	for {
+		ok, err := visible()
+		if err == nil && ok {
+			return time.Since(start), nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+		if time.Since(start) >= timeout {
+			if lastErr != nil {
+				return 0, errors.Wrapf(lastErr, "not visible after %s", timeout)
+			}
+			return 0, errors.Errorf("not visible after %s", timeout)
+		}
+		time.Sleep(interval)
+		interval = nextPollInterval(interval)
+	}
+}
+
+// ConsistencyPrepare ensures the consistency collection exists.
+func ConsistencyPrepare(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+	if err := ensureCollection(ctx, e, e.Config.MonitoringCollectionConsistency, entity.ClBounded, e.Config.LatencyVector); err != nil {
+		return errors.Wrap(err, "ensure consistency")
+	}
+	return nil
+}
+
+// ConsistencyCheck inserts a timestamped entity, then polls it with bounded and eventually
+// consistent queries (concurrently) until it becomes visible, to measure how stale these reads
+// actually are. The entity is deleted at the end.
+func ConsistencyCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+
+	col := e.Config.MonitoringCollectionConsistency
+	if err := ensureCollection(ctx, e, col, entity.ClBounded, e.Config.LatencyVector); err != nil {
+		return errors.Wrap(err, "ensure consistency collection")
+	}
+
+	id := time.Now().UnixNano()
+	key := e.Config.ConsistencyKeyPrefix + utils.RandomHex(20)
+	{
+		insertCtx, insertCancel := context.WithTimeout(ctx, e.Config.InsertTimeout)
+		defer insertCancel()
+
+		if _, err := e.Client.Insert(insertCtx,
+			milvusclient.NewColumnBasedInsertOption(col).
+				WithInt64Column("id", []int64{id}).
+				WithVarcharColumn("key", []string{key}).
+				WithVarcharColumn("value", []string{strconv.FormatInt(id, 10)}).
+				WithColumns(e.Config.LatencyVector.column([]entity.Vector{e.Config.LatencyVector.randomVector()})),
+		); err != nil {
+			return errors.Wrap(err, "insert consistency item")
+		}
+	}
+	inserted := time.Now()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(stalenessConsistencyLevels))
+	for i, cl := range stalenessConsistencyLevels {
+		wg.Add(1)
+		go func(i int, cl entity.ConsistencyLevel) {
+			defer wg.Done()
+			labels := []string{strings.ToLower(cl.CommonConsistencyLevel().String()), e.Config.MonitoringDatabase, e.ClusterName, e.GetName()}
+			visible := func() (bool, error) {
+				queryCtx, queryCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+				defer queryCancel()
+
+				qr, err := e.Client.Query(queryCtx, milvusclient.NewQueryOption(col).
+					WithFilter(fmt.Sprintf("id == %d", id)).
+					WithOutputFields("id").
+					WithConsistencyLevel(cl))
+				if err != nil {
+					return false, err
+				}
+				return qr.ResultCount > 0, nil
+			}
+			delay, err := waitVisible(visible, inserted, e.Config.ConsistencyPollInterval, e.Config.ConsistencyTimeout)
+			if err != nil {
+				consistencyVisibilityTimeouts.WithLabelValues(labels...).Inc()
+				errs[i] = errors.Wrapf(err, "consistency level %s", labels[0])
+				return
+			}
+			consistencyVisibilityTimeouts.WithLabelValues(labels...).Add(0)
+			consistencyVisibilityDelay.WithLabelValues(labels...).Observe(delay.Seconds())
+			level.Debug(e.Logger).Log("msg", "consistency item visible", "consistency_level", labels[0], "delay", delay)
+		}(i, cl)
+	}
+	wg.Wait()
+
+	deleteCtx, deleteCancel := context.WithTimeout(ctx, e.Config.DeleteTimeout)
+	defer deleteCancel()
+	if _, err := e.Client.Delete(deleteCtx, milvusclient.NewDeleteOption(col).WithInt64IDs("id", []int64{id})); err != nil {
+		level.Warn(e.Logger).Log("msg", "failed to delete consistency item", "key", key, "err", err)
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package milvus
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitVisible(t *testing.T) {
+	calls := 0
+	visible := func() (bool, error) {
+		calls++
+		switch calls {
+		case 1:
+			return false, nil
+		case 2:
+			return false, errors.New("transient")
+		}
+		return true, nil
+	}
+	start := time.Now()
+	delay, err := waitVisible(visible, start, time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 polls, got %d", calls)
+	}
+	if delay < 2*time.Millisecond || delay > time.Since(start) {
+		t.Fatalf("unexpected delay %s", delay)
+	}
+}
+
+func TestWaitVisibleTimeout(t *testing.T) {
+	_, err := waitVisible(func() (bool, error) { return false, nil }, time.Now(), time.Millisecond, 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+	_, err = waitVisible(func() (bool, error) { return false, errors.New("unavailable") }, time.Now(), time.Millisecond, 10*time.Millisecond)
+	if err == nil || err.Error() != "not visible after 10ms: unavailable" {
+		t.Fatalf("expected the last error to be reported, got %v", err)
+	}
+}
+
+func TestNextPollInterval(t *testing.T) {
+	interval := 100 * time.Millisecond
+	var intervals []time.Duration
+	for i := 0; i < 7; i++ {
+		intervals = append(intervals, interval)
+		interval = nextPollInterval(interval)
+	}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond, 2 * time.Second, 2 * time.Second}
+	if !reflect.DeepEqual(intervals, expected) {
+		t.Fatalf("expected intervals %v, got %v", expected, intervals)
+	}
+}
@@ -1,14 +1,19 @@
 package milvus
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 
+	"github.com/criteo/blackbox-prober/pkg/common"
 	"github.com/criteo/blackbox-prober/pkg/discovery"
 	"github.com/criteo/blackbox-prober/pkg/topology"
 	"github.com/criteo/blackbox-prober/pkg/utils"
 	mv "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -23,6 +28,23 @@ func (conf *MilvusProbeConfig) buildAddress(tlsEnabled bool, addressUrl string)
 	return fmt.Sprintf("%s://%s", proto, addressUrl)
 }
 
+// proxyTLSConfig verifies the certificate of a proxy against the hostname of its cluster: proxies
+// are dialed by address, but serve the certificate of the load balancer.
+func proxyTLSConfig(clusterAddress string) *tls.Config {
+	serverName := clusterAddress
+	if u, err := url.Parse(clusterAddress); err == nil && u.Hostname() != "" {
+		serverName = u.Hostname()
+	}
+	return &tls.Config{ServerName: serverName}
+}
+
+// proxyDialOptions are the default dial options of the client, with the TLS config of the proxy
+// (the last transport credentials override the ones set by the client).
+func proxyDialOptions(clusterAddress string) []grpc.DialOption {
+	options := append([]grpc.DialOption{}, mv.DefaultGrpcOpts...)
+	return append(options, grpc.WithTransportCredentials(credentials.NewTLS(proxyTLSConfig(clusterAddress))))
+}
+
 func (conf *MilvusProbeConfig) generateClusterEndpointsFromEntry(logger log.Logger, entry discovery.ServiceEntry) ([]*MilvusEndpoint, error) {
 	authEnabled := conf.MilvusEndpointConfig.AuthEnabled
 	var (
@@ -79,6 +101,41 @@ func (conf *MilvusProbeConfig) generateClusterEndpointsFromEntry(logger log.Logg
 	return []*MilvusEndpoint{endpoint}, nil
 }
 
+// generateProxyEndpointsFromEntries builds one node endpoint per discovered proxy, connecting to
+// it directly (service address and port) instead of through the load balancer, so a single bad
+// proxy is visible. Credentials and client settings are the ones of the cluster endpoint, and TLS
+// certificates are verified against the hostname of the cluster.
+func (conf *MilvusProbeConfig) generateProxyEndpointsFromEntries(logger log.Logger, clusterEndpoint *MilvusEndpoint, entries []discovery.ServiceEntry) []*MilvusEndpoint {
+	endpoints := make([]*MilvusEndpoint, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Port == 0 {
+			level.Warn(logger).Log("msg", fmt.Sprintf("No port for proxy %s of cluster %s, skipping its node endpoint", entry.Address, clusterEndpoint.ClusterName))
+			continue
+		}
+		tlsEnabled := utils.Contains(entry.Tags, conf.MilvusEndpointConfig.TLSTag)
+		name := fmt.Sprintf("%s:%d", entry.Address, entry.Port)
+
+		clientConfig := clusterEndpoint.ClientConfig
+		clientConfig.Address = conf.buildAddress(tlsEnabled, name)
+		if tlsEnabled {
+			clientConfig.DialOptions = proxyDialOptions(clusterEndpoint.ClientConfig.Address)
+		}
+		endpoints = append(endpoints, &MilvusEndpoint{Name: name,
+			ClusterName:  clusterEndpoint.ClusterName,
+			ClusterLevel: false,
+			ClientConfig: clientConfig,
+			Config:       conf.MilvusEndpointConfig,
+			Logger:       log.With(logger, "endpoint_name", name),
+			NodeInfo: &common.ClusterNodeInfo{
+				NodeIP:   entry.Address,
+				PodName:  entry.PodName,
+				NodeFqdn: entry.NodeFqdn,
+			},
+		})
+	}
+	return endpoints
+}
+
 func (conf *MilvusProbeConfig) BuildTopology(logger log.Logger, entries []discovery.ServiceEntry) (topology.ClusterMap, error) {
 	clusterMap := topology.NewClusterMap()
 	clusterEntries := conf.DiscoveryConfig.GroupNodesByCluster(logger, entries)
@@ -92,6 +149,13 @@ func (conf *MilvusProbeConfig) BuildTopology(logger log.Logger, entries []discov
 			level.Debug(logger).Log("msg", "Adding cluster", "cluster", endpoint.Name, "address", endpoint.ClientConfig.Address)
 
 			cluster := topology.NewCluster(endpoint)
+			// Proxy endpoints are only useful if a check runs on them
+			if conf.MilvusChecksConfigs.ProxyLatencyCheckConfig.Enable {
+				for _, proxy := range conf.generateProxyEndpointsFromEntries(logger, endpoint, clusterGroup) {
+					level.Debug(logger).Log("msg", "Adding proxy", "cluster", endpoint.Name, "address", proxy.ClientConfig.Address)
+					cluster.AddEndpoint(proxy)
+				}
+			}
 			clusterMap.AppendCluster(cluster)
 		}
 
@@ -3,11 +3,15 @@ package milvus
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/criteo/blackbox-prober/pkg/discovery"
+	"github.com/criteo/blackbox-prober/pkg/topology"
 	"github.com/go-kit/log"
+	mv "github.com/milvus-io/milvus/client/v2/milvusclient"
 )
 
 func TestMilvusBuildAddress(t *testing.T) {
@@ -143,7 +147,7 @@ func TestGenerateClusterEndpointsFromEntry(t *testing.T) {
 				t.Fatalf("expected retry backoff %s, got %s", conf.MilvusEndpointConfig.MaxBackoff, endpoint.ClientConfig.RetryRateLimit.MaxBackoff)
 			}
 
-			if endpoint.Config != conf.MilvusEndpointConfig {
+			if !reflect.DeepEqual(endpoint.Config, conf.MilvusEndpointConfig) {
 				t.Fatalf("expected endpoint config to match MilvusEndpointConfig")
 			}
 		})
@@ -252,3 +256,97 @@ func TestGenerateClusterEndpointsFromEntryMissingClusterMeta(t *testing.T) {
 		t.Fatalf("unexpected error message: %v", err)
 	}
 }
+
+func TestProxyTLSConfig(t *testing.T) {
+	for address, expected := range map[string]string{
+		"https://milvus.foo.bar":       "milvus.foo.bar",
+		"https://milvus.foo.bar:19530": "milvus.foo.bar",
+		"milvus.foo.bar":               "milvus.foo.bar",
+	} {
+		if got := proxyTLSConfig(address).ServerName; got != expected {
+			t.Errorf("%s: expected server name %s, got %s", address, expected, got)
+		}
+	}
+}
+
+func TestBuildTopologyProxyEndpoints(t *testing.T) {
+	entries := []discovery.ServiceEntry{
+		{
+			Service: "milvus-proxy",
+			Address: "10.0.0.1",
+			Port:    19530,
+			PodName: "milvus-proxy-0",
+			Tags:    []string{"tls"},
+			Meta:    map[string]string{"address_meta": "milvus.foo.bar", "CLUSTER": "milvuss99"},
+		},
+		{
+			Service: "milvus-proxy",
+			Address: "10.0.0.2",
+			Port:    19531,
+			Meta:    map[string]string{"address_meta": "milvus.foo.bar", "CLUSTER": "milvuss99"},
+		},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Enabled=%t", enabled), func(t *testing.T) {
+			conf := MilvusProbeConfig{
+				DiscoveryConfig:      discovery.GenericDiscoveryConfig{MetaClusterKey: "CLUSTER"},
+				MilvusEndpointConfig: MilvusEndpointConfig{TLSTag: "tls", AddressMetaKey: "address_meta", MaxRetry: 3},
+			}
+			conf.MilvusChecksConfigs.ProxyLatencyCheckConfig.Enable = enabled
+
+			clusterMap, err := conf.BuildTopology(log.NewNopLogger(), entries)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(clusterMap.Clusters) != 1 {
+				t.Fatalf("expected a single cluster, got %v", clusterMap.Clusters)
+			}
+			var cluster topology.Cluster
+			for _, c := range clusterMap.Clusters {
+				cluster = c
+			}
+			if cluster.ClusterEndpoint.(*MilvusEndpoint).ClientConfig.Address != "https://milvus.foo.bar" {
+				t.Fatalf("expected the cluster endpoint to go through the load balancer")
+			}
+			if !enabled {
+				if len(cluster.NodeEndpoints) != 0 {
+					t.Fatalf("expected no proxy endpoint, got %d", len(cluster.NodeEndpoints))
+				}
+				return
+			}
+
+			expected := map[string]struct{ address, id string }{
+				"10.0.0.1:19530": {"https://10.0.0.1:19530", "milvus-proxy-0"},
+				"10.0.0.2:19531": {"http://10.0.0.2:19531", "10.0.0.2:19531"},
+			}
+			if len(cluster.NodeEndpoints) != len(expected) {
+				t.Fatalf("expected %d proxy endpoints, got %d", len(expected), len(cluster.NodeEndpoints))
+			}
+			for _, n := range cluster.NodeEndpoints {
+				proxy := n.(*MilvusEndpoint)
+				want, ok := expected[proxy.Name]
+				if !ok {
+					t.Fatalf("unexpected proxy endpoint %s", proxy.Name)
+				}
+				if proxy.IsCluster() || proxy.ClusterName != "milvuss99" {
+					t.Fatalf("expected %s to be a node of milvuss99", proxy.Name)
+				}
+				if proxy.ClientConfig.Address != want.address {
+					t.Fatalf("expected address %s, got %s", want.address, proxy.ClientConfig.Address)
+				}
+				// TLS proxies override the transport credentials of the client
+				tlsEnabled := strings.HasPrefix(want.address, "https://")
+				if got := len(proxy.ClientConfig.DialOptions); (tlsEnabled && got != len(mv.DefaultGrpcOpts)+1) || (!tlsEnabled && got != 0) {
+					t.Fatalf("unexpected dial options on %s: %d", proxy.Name, got)
+				}
+				if proxy.ClientConfig.RetryRateLimit == nil || proxy.ClientConfig.RetryRateLimit.MaxRetry != 3 {
+					t.Fatalf("expected client settings of the cluster endpoint on %s", proxy.Name)
+				}
+				if id := proxy.opLabels("insert")[4]; id != want.id {
+					t.Fatalf("expected id label %s, got %s", want.id, id)
+				}
+			}
+		})
+	}
+}
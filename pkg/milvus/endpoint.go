@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/criteo/blackbox-prober/pkg/common"
 	"github.com/go-kit/log"
 
 	mv "github.com/milvus-io/milvus/client/v2/milvusclient"
@@ -18,6 +19,15 @@ type MilvusEndpoint struct {
 	ClientConfig mv.ClientConfig
 	Config       MilvusEndpointConfig
 	Logger       log.Logger
+
+	// Proxy reached directly by a node endpoint (nil for the cluster endpoint, which goes
+	// through the load balancer)
+	NodeInfo *common.ClusterNodeInfo
+
+	// Vectors of the items of the recall and search collections, computed once
+	recallVectors       vectorDataset
+	searchVectors       vectorDataset
+	searchSparseVectors vectorDataset
 }
 
 func (e *MilvusEndpoint) GetHash() string {
@@ -32,6 +42,16 @@ func (e *MilvusEndpoint) IsCluster() bool {
 	return e.ClusterLevel
 }
 
+// opLabels returns the op_latency labels of an operation, outside of any partition. Proxy
+// endpoints are identified by the pod name of the proxy when it is known.
+func (e *MilvusEndpoint) opLabels(operation string) []string {
+	id := e.Name
+	if e.NodeInfo != nil && e.NodeInfo.PodName != "" {
+		id = e.NodeInfo.PodName
+	}
+	return []string{operation, e.Name, e.Config.MonitoringDatabase, e.ClusterName, id, ""}
+}
+
 func (e *MilvusEndpoint) Connect() error {
 	// TODO: maybe make timeout configurable? For now hardcoding to 15s should be quite okay
 	context, cancel := context.WithTimeout(context.Background(), time.Duration(time.Second*15))
@@ -44,10 +64,6 @@ func (e *MilvusEndpoint) Connect() error {
 	return nil
 }
 
-func (e *MilvusEndpoint) Refresh() error {
-	return nil
-}
-
 func (e *MilvusEndpoint) Close() error {
 	if e != nil && e.Client != nil {
 		e.Client.Close(context.Background()) // no timeout on close
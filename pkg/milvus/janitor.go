@@ -0,0 +1,130 @@
+package milvus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/go-kit/log/level"
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var latencyRWLeakedEntities = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_latency_rw_leaked_entities",
+	Help: "Number of entities left in the latency RW collection by failed latency checks, found by the last janitor check",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+var latencyRWLeakedEntitiesRemoved = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: MVSuffix + "_latency_rw_leaked_entities_removed_total",
+	Help: "Total number of leaked entities deleted from the latency RW collection by the janitor check",
+}, []string{"namespace", "cluster", "probe_endpoint"})
+
+// leakedIDs returns the ids of the entities inserted by latency checks (key with the RW prefix)
+// among the result of a janitor query.
+func leakedIDs(qr milvusclient.ResultSet, keyPrefix string) ([]int64, error) {
+	idColI := qr.GetColumn("id")
+	keyColI := qr.GetColumn("key")
+	if idColI == nil || keyColI == nil {
+		return nil, errors.New("janitor query missing id/key column")
+	}
+	idCol, ok := idColI.(*mvcol.ColumnInt64)
+	if !ok {
+		return nil, errors.New("janitor query id column type mismatch")
+	}
+	keyCol, ok := keyColI.(*mvcol.ColumnVarChar)
+	if !ok {
+		return nil, errors.New("janitor query key column type mismatch")
+	}
+	if keyCol.Len() != idCol.Len() {
+		return nil, errors.Errorf("janitor query column length mismatch id=%d key=%d", idCol.Len(), keyCol.Len())
+	}
+
+	ids := make([]int64, 0, idCol.Len())
+	for i, id := range idCol.Data() {
+		// LIKE wildcards may match more than the prefix
+		if strings.HasPrefix(keyCol.Data()[i], keyPrefix) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// janitorFilter selects the entities inserted by latency checks before the threshold (ns). The ids
+// of the init dataset (0 to init_items_per_collection excluded) are never selected, whatever its
+// key prefix.
+func janitorFilter(conf *MilvusEndpointConfig, threshold int64) string {
+	return fmt.Sprintf(`key like "%s%%" && id >= %d && id < %d`, conf.LatencyRWKeyPrefix, conf.InitItemsPerCollection, threshold)
+}
+
+// JanitorCheck deletes the entities left in the latency RW collection by latency checks which
+// failed between their insert and their delete. The ids of these entities are their insertion
+// timestamp (ns): the ones older than latency_rw_leak_threshold are considered leaked.
+func JanitorCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+
+	col := e.Config.MonitoringCollectionLatencyRW
+	if err := ensurePartitionedCollection(ctx, e, col, entity.ClStrong, e.Config.LatencyVector); err != nil {
+		return errors.Wrap(err, "ensure latency RW collection")
+	}
+
+	labels := []string{e.Config.MonitoringDatabase, e.ClusterName, e.GetName()}
+	threshold := time.Now().Add(-e.Config.LatencyRWLeakThreshold).UnixNano()
+	filter := janitorFilter(&e.Config, threshold)
+	var found, removed int
+	defer func() {
+		latencyRWLeakedEntities.WithLabelValues(labels...).Set(float64(found))
+		latencyRWLeakedEntitiesRemoved.WithLabelValues(labels...).Add(float64(removed))
+	}()
+
+	// Deleted entities are not returned anymore by the next (strongly consistent) query
+	for {
+		queryCtx, queryCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+		qr, err := e.Client.Query(queryCtx, milvusclient.NewQueryOption(col).
+			WithFilter(filter).
+			WithOutputFields("id", "key").
+			WithConsistencyLevel(entity.ClStrong).
+			WithLimit(e.Config.JanitorBatchSize))
+		queryCancel()
+		if err != nil {
+			return errors.Wrap(err, "query leaked entities")
+		}
+		ids, err := leakedIDs(qr, e.Config.LatencyRWKeyPrefix)
+		if err != nil {
+			return err
+		}
+		found += len(ids)
+		if len(ids) == 0 {
+			break
+		}
+
+		deleteCtx, deleteCancel := context.WithTimeout(ctx, e.Config.DeleteTimeout)
+		_, err = e.Client.Delete(deleteCtx, milvusclient.NewDeleteOption(col).WithInt64IDs("id", ids))
+		deleteCancel()
+		if err != nil {
+			return errors.Wrap(err, "delete leaked entities")
+		}
+		removed += len(ids)
+		if qr.ResultCount < e.Config.JanitorBatchSize {
+			break
+		}
+	}
+
+	if found > 0 {
+		level.Warn(e.Logger).Log("msg", "Deleted leaked latency RW entities", "collection", col, "count", removed)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package milvus
+
+import (
+	"reflect"
+	"testing"
+
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLeakedIDs(t *testing.T) {
+	qr := milvusclient.ResultSet{Fields: milvusclient.DataSet{
+		mvcol.NewColumnInt64("id", []int64{10, 11, 12}),
+		mvcol.NewColumnVarChar("key", []string{"latency_rw_0a", "latencyXrw_0b", "latency_rw_0c"}),
+	}}
+	ids, err := leakedIDs(qr, "latency_rw_")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int64{10, 12}) {
+		t.Fatalf("expected the ids of the keys with the prefix, got %v", ids)
+	}
+
+	qr.Fields = qr.Fields[:1]
+	if _, err := leakedIDs(qr, "latency_rw_"); err == nil {
+		t.Fatal("expected an error without the key column")
+	}
+}
+
+func TestJanitorConfig(t *testing.T) {
+	var conf MilvusEndpointConfig
+	if err := yaml.Unmarshal([]byte("{}"), &conf); err != nil || conf.JanitorBatchSize != 1000 {
+		t.Fatalf("expected the default batch size, got %d (err=%v)", conf.JanitorBatchSize, err)
+	}
+	if err := yaml.Unmarshal([]byte("janitor_batch_size: 20000"), &conf); err == nil {
+		t.Fatal("expected an error with a batch size over the query result window")
+	}
+	if err := yaml.Unmarshal([]byte("latency_rw_leak_threshold: 0s"), &conf); err == nil {
+		t.Fatal("expected an error without threshold")
+	}
+	if err := yaml.Unmarshal([]byte("latency_rw_key_prefix: latency_\nlatency_init_key_prefix: latency_init_"), &conf); err == nil {
+		t.Fatal("expected an error with an init key prefix starting with the RW one")
+	}
+}
+
+func TestJanitorFilter(t *testing.T) {
+	conf := MilvusEndpointConfig{LatencyRWKeyPrefix: "latency_rw_", InitItemsPerCollection: 100}
+	expected := `key like "latency_rw_%" && id >= 100 && id < 42`
+	if filter := janitorFilter(&conf, 42); filter != expected {
+		t.Fatalf("expected %s, got %s", expected, filter)
+	}
+}
@@ -0,0 +1,208 @@
+package milvus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/criteo/blackbox-prober/pkg/utils"
+	"github.com/go-kit/log/level"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pkg/errors"
+)
+
+// lifecycleCollectionName returns the name of a temporary collection created at now. The creation
+// time is part of the name, so that leftovers can be told apart from the collections of running
+// checks.
+func lifecycleCollectionName(prefix string, now time.Time) string {
+	return fmt.Sprintf("%s%d_%s", prefix, now.Unix(), utils.RandomHex(8))
+}
+
+// lifecycleLeftovers returns the temporary collections left by previous lifecycle checks: the
+// ones created more than maxAge before now. Collections with the prefix but without a creation
+// time are not dropped, as they cannot be attributed to a lifecycle check.
+func lifecycleLeftovers(names []string, prefix string, now time.Time, maxAge time.Duration) []string {
+	var leftovers []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		created, _, found := strings.Cut(strings.TrimPrefix(name, prefix), "_")
+		ts, err := strconv.ParseInt(created, 10, 64)
+		if !found || err != nil {
+			continue
+		}
+		if now.Sub(time.Unix(ts, 0)) > maxAge {
+			leftovers = append(leftovers, name)
+		}
+	}
+	return leftovers
+}
+
+// cleanupLifecycleCollections drops the temporary collections of previous lifecycle checks, which
+// failed or were interrupted before dropping them.
+func cleanupLifecycleCollections(ctx context.Context, e *MilvusEndpoint) error {
+	listCtx, listCancel := context.WithTimeout(ctx, e.Config.LifecycleTimeout)
+	defer listCancel()
+
+	names, err := e.Client.ListCollections(listCtx, milvusclient.NewListCollectionOption())
+	if err != nil {
+		return errors.Wrap(err, "list collections")
+	}
+	for _, name := range lifecycleLeftovers(names, e.Config.LifecycleCollectionPrefix, time.Now(), e.Config.LifecycleLeftoverAge) {
+		level.Info(e.Logger).Log("msg", "Dropping leftover lifecycle collection", "collection", name)
+		if err := dropLifecycleCollection(ctx, e, name); err != nil {
+			return errors.Wrapf(err, "drop leftover collection %s", name)
+		}
+	}
+	return nil
+}
+
+// LifecyclePrepare (and LifecycleTeardown) drop the temporary collections left by previous runs.
+func LifecyclePrepare(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+	return cleanupLifecycleCollections(ctx, e)
+}
+
+func LifecycleTeardown(p topology.ProbeableEndpoint) error {
+	return LifecyclePrepare(p)
+}
+
+// LifecycleCheck goes through the whole life of a small temporary collection: create, index,
+// load, insert, search, release and drop. Coordinator problems surface as failures of these
+// phases while the existing loaded collections keep serving. The latency and failures of each
+// phase are reported as lifecycle_<phase> operations.
+func LifecycleCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+	return runLifecycle(ctx, e, lifecycleCollectionName(e.Config.LifecycleCollectionPrefix, time.Now()))
+}
+
+// runLifecycle runs the phases of the life of the collection in order, and stops at the first
+// failure. The collection is dropped if the check did not get to drop it.
+func runLifecycle(ctx context.Context, e *MilvusEndpoint, col string) error {
+	dropped := false
+	defer func() {
+		// Do not leak the collection if a phase failed, leftovers are also dropped by the next prepare
+		if !dropped {
+			if err := dropLifecycleCollection(ctx, e, col); err != nil {
+				level.Warn(e.Logger).Log("msg", "failed to drop lifecycle collection", "collection", col, "err", err)
+			}
+		}
+	}()
+
+	for _, phase := range lifecyclePhases(ctx, e, col) {
+		if err := ObserveOpLatency(phase.run, e.opLabels("lifecycle_"+phase.name)); err != nil {
+			return errors.Wrapf(err, "lifecycle %s of %s", phase.name, col)
+		}
+		dropped = phase.name == "drop"
+	}
+	level.Debug(e.Logger).Log("msg", "lifecycle check succeeded", "collection", col)
+	return nil
+}
+
+type lifecyclePhase struct {
+	name string
+	run  func() error
+}
+
+// The phases and the drop of the lifecycle collections are indirected through package variables
+// so unit tests can mock them without a live cluster.
+var (
+	dropLifecycleCollection = func(ctx context.Context, e *MilvusEndpoint, col string) error {
+		dropCtx, dropCancel := context.WithTimeout(ctx, e.Config.LifecycleTimeout)
+		defer dropCancel()
+		return e.Client.DropCollection(dropCtx, milvusclient.NewDropCollectionOption(col))
+	}
+
+	// lifecyclePhases returns the phases of the life of the collection, the last one drops it.
+	lifecyclePhases = func(ctx context.Context, e *MilvusEndpoint, col string) []lifecyclePhase {
+		vector := e.Config.LatencyVector
+		count := e.Config.LifecycleItems
+		ids := make([]int64, count)
+		keys := make([]string, count)
+		vals := make([]string, count)
+		vecs := make([]entity.Vector, count)
+		for i := 0; i < count; i++ {
+			ids[i] = int64(i)
+			keys[i] = fmt.Sprintf("%s%d", col, i)
+			vals[i] = hash(keys[i])
+			vecs[i] = vector.deterministicVector(keys[i])
+		}
+
+		return []lifecyclePhase{
+			{"create", func() error {
+				createCtx, createCancel := context.WithTimeout(ctx, e.Config.LifecycleTimeout)
+				defer createCancel()
+				return e.Client.CreateCollection(createCtx, milvusclient.NewCreateCollectionOption(col, monitoringSchema(col, vector)).
+					WithConsistencyLevel(entity.ClStrong))
+			}},
+			{"index", func() error {
+				indexCtx, indexCancel := context.WithTimeout(ctx, e.Config.IndexTimeout)
+				defer indexCancel()
+				task, err := e.Client.CreateIndex(indexCtx, milvusclient.NewCreateIndexOption(col, "vector", vector.exactIndex()))
+				if err != nil {
+					return err
+				}
+				return task.Await(indexCtx)
+			}},
+			{"load", func() error {
+				loadCtx, loadCancel := context.WithTimeout(ctx, e.Config.LoadTimeout)
+				defer loadCancel()
+				task, err := e.Client.LoadCollection(loadCtx, milvusclient.NewLoadCollectionOption(col))
+				if err != nil {
+					return err
+				}
+				return task.Await(loadCtx)
+			}},
+			{"insert", func() error {
+				insertCtx, insertCancel := context.WithTimeout(ctx, e.Config.InsertTimeout)
+				defer insertCancel()
+				_, err := e.Client.Insert(insertCtx, milvusclient.NewColumnBasedInsertOption(col).
+					WithInt64Column("id", ids).
+					WithVarcharColumn("key", keys).
+					WithVarcharColumn("value", vals).
+					WithColumns(vector.column(vecs)))
+				return err
+			}},
+			{"search", func() error {
+				target := count - 1
+				found, err := searchOne(ctx, e, milvusclient.NewSearchOption(col, 1, []entity.Vector{vecs[target]}).
+					WithANNSField("vector"))
+				if err != nil {
+					return err
+				}
+				if len(found) == 0 || found[0] != ids[target] {
+					return errors.Errorf("top-1 mismatch: got %v want %d", found, ids[target])
+				}
+				return nil
+			}},
+			{"release", func() error {
+				releaseCtx, releaseCancel := context.WithTimeout(ctx, e.Config.LifecycleTimeout)
+				defer releaseCancel()
+				return e.Client.ReleaseCollection(releaseCtx, milvusclient.NewReleaseCollectionOption(col))
+			}},
+			{"drop", func() error {
+				return dropLifecycleCollection(ctx, e, col)
+			}},
+		}
+	}
+)
@@ -0,0 +1,133 @@
+package milvus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLifecycleCollectionName(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	name := lifecycleCollectionName("monitoring_lifecycle_", now)
+	if !strings.HasPrefix(name, "monitoring_lifecycle_1700000000_") {
+		t.Fatalf("expected the creation time in %s", name)
+	}
+	// A collection just created is never a leftover, an old one is
+	if got := lifecycleLeftovers([]string{name}, "monitoring_lifecycle_", now, time.Hour); len(got) != 0 {
+		t.Errorf("expected no leftover, got %v", got)
+	}
+	if got := lifecycleLeftovers([]string{name}, "monitoring_lifecycle_", now.Add(2*time.Hour), time.Hour); !reflect.DeepEqual(got, []string{name}) {
+		t.Errorf("expected %s to be a leftover, got %v", name, got)
+	}
+}
+
+func TestLifecycleLeftovers(t *testing.T) {
+	now := time.Unix(1700010000, 0)
+	names := []string{
+		"monitoring_latency",
+		"monitoring_lifecycle_1700000000_0a1b", // 10000s old
+		"monitoring_lifecycle_1700009000_ff",   // 1000s old
+		"monitoring_lifecycle_1700010100_ff",   // created later (clock skew between probes)
+		"monitoring_lifecycle_0a1b",            // no creation time
+		"monitoring_lifecycle_17000_",          // no random suffix but a creation time
+		"lifecycle_1700000000_0a1b",
+	}
+	got := lifecycleLeftovers(names, "monitoring_lifecycle_", now, time.Hour)
+	want := []string{"monitoring_lifecycle_1700000000_0a1b", "monitoring_lifecycle_17000_"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lifecycleLeftovers: got %v want %v", got, want)
+	}
+	if got := lifecycleLeftovers(names, "other_", now, time.Hour); len(got) != 0 {
+		t.Errorf("lifecycleLeftovers: got %v want none", got)
+	}
+}
+
+func TestRunLifecycle(t *testing.T) {
+	e := &MilvusEndpoint{Name: fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()), Config: defaultMilvusEndpointConfig, Logger: log.NewNopLogger()}
+	failures := func(phase string) float64 {
+		return testutil.ToFloat64(opFailuresTotal.WithLabelValues(e.opLabels("lifecycle_" + phase)...))
+	}
+
+	origPhases, origDrop := lifecyclePhases, dropLifecycleCollection
+	defer func() { lifecyclePhases, dropLifecycleCollection = origPhases, origDrop }()
+
+	var ran, drops []string
+	var failing string
+	var dropErr error
+	dropLifecycleCollection = func(_ context.Context, _ *MilvusEndpoint, col string) error {
+		drops = append(drops, col)
+		return dropErr
+	}
+	lifecyclePhases = func(ctx context.Context, e *MilvusEndpoint, col string) []lifecyclePhase {
+		phases := []lifecyclePhase{}
+		for _, name := range []string{"create", "index", "load", "insert", "search", "release"} {
+			phases = append(phases, lifecyclePhase{name, func() error {
+				ran = append(ran, name)
+				if name == failing {
+					return errors.New("coordinator unavailable")
+				}
+				return nil
+			}})
+		}
+		return append(phases, lifecyclePhase{"drop", func() error {
+			ran = append(ran, "drop")
+			return dropLifecycleCollection(ctx, e, col)
+		}})
+	}
+
+	// All phases run in order, the collection is dropped once by the last one
+	if err := runLifecycle(context.Background(), e, "col_0"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if want := []string{"create", "index", "load", "insert", "search", "release", "drop"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("expected phases %v, got %v", want, ran)
+	}
+	if !reflect.DeepEqual(drops, []string{"col_0"}) {
+		t.Errorf("expected a single drop of col_0, got %v", drops)
+	}
+
+	// A failed phase stops the check, and the collection is dropped anyway
+	ran, drops, failing = nil, nil, "load"
+	err := runLifecycle(context.Background(), e, "col_1")
+	if err == nil || !strings.Contains(err.Error(), "lifecycle load of col_1") {
+		t.Errorf("expected the load phase to fail, got %v", err)
+	}
+	if want := []string{"create", "index", "load"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("expected phases %v, got %v", want, ran)
+	}
+	if !reflect.DeepEqual(drops, []string{"col_1"}) {
+		t.Errorf("expected the deferred drop of col_1, got %v", drops)
+	}
+	if failures("load") != 1 || failures("insert") != 0 {
+		t.Errorf("expected a single load failure, got %v load and %v insert failures", failures("load"), failures("insert"))
+	}
+
+	// A failed drop phase is retried by the deferred drop
+	ran, drops, failing, dropErr = nil, nil, "", errors.New("collection busy")
+	if err := runLifecycle(context.Background(), e, "col_2"); err == nil || !strings.Contains(err.Error(), "lifecycle drop of col_2") {
+		t.Errorf("expected the drop phase to fail, got %v", err)
+	}
+	if !reflect.DeepEqual(drops, []string{"col_2", "col_2"}) {
+		t.Errorf("expected the drop to be retried, got %v", drops)
+	}
+}
+
+func TestLifecycleConfig(t *testing.T) {
+	for _, raw := range []string{
+		"lifecycle_collection_prefix: \"\"",
+		"lifecycle_leftover_age: 0s",
+	} {
+		var conf MilvusEndpointConfig
+		if err := yaml.Unmarshal([]byte(raw), &conf); err == nil {
+			t.Fatalf("expected an error for %q", raw)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package milvus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	mvindex "github.com/milvus-io/milvus/client/v2/index"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pkg/errors"
+)
+
+// Partitioning modes of the latency and durability collections
+const (
+	// Every item is in the default partition
+	partitionModeNone = "none"
+	// Items have a `partition` partition key field, as multi-tenant collections
+	partitionModeKey = "partition_key"
+	// Items are inserted in explicitly created partitions
+	partitionModeExplicit = "partitions"
+)
+
+// Partitioning of the latency and durability collections. Items are spread across count
+// partitions (id modulo count), named partition_<n>: the value of the partition key field or the
+// name of the explicit partition.
+type PartitionConfig struct {
+	// none, partition_key or partitions
+	Mode  string `yaml:"mode,omitempty"`
+	Count int    `yaml:"count,omitempty"`
+}
+
+var (
+	defaultPartitionConfig = PartitionConfig{
+		Mode:  partitionModeNone,
+		Count: 4,
+	}
+
+	// Collections of the other checks are not partitioned
+	noPartitions = PartitionConfig{Mode: partitionModeNone}
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *PartitionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = defaultPartitionConfig
+	type plain PartitionConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	switch c.Mode {
+	case partitionModeNone, partitionModeKey, partitionModeExplicit:
+	default:
+		return errors.Errorf("partition mode must be %s, %s or %s, got %q", partitionModeNone, partitionModeKey, partitionModeExplicit, c.Mode)
+	}
+	if c.Count <= 0 {
+		return errors.Errorf("partition count must be positive, got %d", c.Count)
+	}
+	return nil
+}
+
+func (c PartitionConfig) enabled() bool {
+	return c.Mode == partitionModeKey || c.Mode == partitionModeExplicit
+}
+
+// partitions returns the partitions to go through: every partition, or only the default one
+// (-1) when partitioning is disabled.
+func (c PartitionConfig) partitions() []int {
+	if !c.enabled() {
+		return []int{-1}
+	}
+	partitions := make([]int, c.Count)
+	for i := range partitions {
+		partitions[i] = i
+	}
+	return partitions
+}
+
+// of returns the partition of an item, -1 when partitioning is disabled.
+func (c PartitionConfig) of(id int64) int {
+	if !c.enabled() {
+		return -1
+	}
+	return int(((id % int64(c.Count)) + int64(c.Count)) % int64(c.Count))
+}
+
+func partitionName(partition int) string {
+	return fmt.Sprintf("partition_%d", partition)
+}
+
+// schema adds the partition key field to a monitoring schema when needed.
+func (c PartitionConfig) schema(schema *entity.Schema) *entity.Schema {
+	if c.Mode != partitionModeKey {
+		return schema
+	}
+	return schema.WithField(entity.NewField().WithName("partition").WithDataType(entity.FieldTypeVarChar).
+		WithMaxLength(MAX_VARCHAR_LEN).WithIsPartitionKey(true))
+}
+
+// columns returns the partition key column of the given items, if any.
+func (c PartitionConfig) columns(ids []int64) []mvcol.Column {
+	if c.Mode != partitionModeKey {
+		return nil
+	}
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = partitionName(c.of(id))
+	}
+	return []mvcol.Column{mvcol.NewColumnVarChar("partition", values)}
+}
+
+// insertPartition returns the partition to insert the items of a partition in, "" for the
+// default one (the partition key routes the items itself).
+func (c PartitionConfig) insertPartition(partition int) string {
+	if c.Mode != partitionModeExplicit || partition < 0 {
+		return ""
+	}
+	return partitionName(partition)
+}
+
+// searchPartitions returns the partitions a read of a partition is restricted to, nil for all.
+func (c PartitionConfig) searchPartitions(partition int) []string {
+	if c.Mode != partitionModeExplicit || partition < 0 {
+		return nil
+	}
+	return []string{partitionName(partition)}
+}
+
+// filter restricts a filter expression to the items of a partition with the partition key.
+func (c PartitionConfig) filter(expr string, partition int) string {
+	if c.Mode != partitionModeKey || partition < 0 {
+		return expr
+	}
+	restriction := fmt.Sprintf(`partition == "%s"`, partitionName(partition))
+	if expr == "" {
+		return restriction
+	}
+	return fmt.Sprintf("(%s) && %s", expr, restriction)
+}
+
+// groupByPartition splits item indexes by partition, in order of first appearance.
+func (c PartitionConfig) groupByPartition(ids []int64) ([]int, map[int][]int) {
+	var order []int
+	groups := make(map[int][]int)
+	for i, id := range ids {
+		p := c.of(id)
+		if _, ok := groups[p]; !ok {
+			order = append(order, p)
+		}
+		groups[p] = append(groups[p], i)
+	}
+	return order, groups
+}
+
+// partitionOpLabels returns the labels of an operation on a partition: the partition label is
+// partition_<n> when partitioning is enabled, empty otherwise.
+func (e *MilvusEndpoint) partitionOpLabels(operation string, partition int) []string {
+	labels := e.opLabels(operation)
+	if partition >= 0 {
+		labels[len(labels)-1] = partitionName(partition)
+	}
+	return labels
+}
+
+// ensurePartitionedCollection is ensureCollection for the latency and durability collections,
+// partitioned according to the partitions config.
+func ensurePartitionedCollection(ctx context.Context, e *MilvusEndpoint, collectionName string, cl entity.ConsistencyLevel, vector VectorConfig) error {
+	partitions := e.Config.Partitions
+	schema := partitions.schema(monitoringSchema(collectionName, vector))
+	if err := ensureCollectionWithSchema(ctx, e, collectionName, cl, schema, map[string]mvindex.Index{"vector": vector.exactIndex()}); err != nil {
+		return err
+	}
+	if partitions.Mode != partitionModeExplicit {
+		return nil
+	}
+
+	existing, err := e.Client.ListPartitions(ctx, milvusclient.NewListPartitionOption(collectionName))
+	if err != nil {
+		return errors.Wrap(err, "failed to list partitions")
+	}
+	has := make(map[string]struct{}, len(existing))
+	for _, name := range existing {
+		has[name] = struct{}{}
+	}
+	var created []string
+	for _, p := range partitions.partitions() {
+		name := partitionName(p)
+		if _, ok := has[name]; ok {
+			continue
+		}
+		if err := e.Client.CreatePartition(ctx, milvusclient.NewCreatePartitionOption(collectionName, name)); err != nil {
+			return errors.Wrapf(err, "failed to create partition %s", name)
+		}
+		created = append(created, name)
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	loadCtx, loadCancel := context.WithTimeout(ctx, e.Config.LoadTimeout)
+	defer loadCancel()
+	loadTask, err := e.Client.LoadPartitions(loadCtx, milvusclient.NewLoadPartitionsOption(collectionName, created...))
+	if err != nil {
+		return errors.Wrap(err, "failed to load partitions")
+	}
+	if err := loadTask.Await(loadCtx); err != nil {
+		return errors.Wrap(err, "failed to await partitions load task")
+	}
+	level.Info(e.Logger).Log("msg", "Created partitions", "collection", collectionName, "partitions", strings.Join(created, ","))
+	return nil
+}
@@ -0,0 +1,96 @@
+package milvus
+
+import (
+	"reflect"
+	"testing"
+
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPartitionConfig(t *testing.T) {
+	var conf MilvusEndpointConfig
+	if err := yaml.Unmarshal([]byte("{}"), &conf); err != nil || conf.Partitions.enabled() {
+		t.Fatalf("expected partitioning to be disabled by default, got %+v (err=%v)", conf.Partitions, err)
+	}
+	if err := yaml.Unmarshal([]byte("partitions: {mode: tenants}"), &conf); err == nil {
+		t.Fatal("expected an error with an unknown mode")
+	}
+	if err := yaml.Unmarshal([]byte("partitions: {mode: partitions, count: 0}"), &conf); err == nil {
+		t.Fatal("expected an error with no partitions")
+	}
+	if err := yaml.Unmarshal([]byte("partitions: {mode: partitions}"), &conf); err != nil || conf.Partitions.Count != 4 {
+		t.Fatalf("expected the default count, got %+v (err=%v)", conf.Partitions, err)
+	}
+}
+
+func TestPartitionConfigNone(t *testing.T) {
+	c := defaultPartitionConfig
+	if got := c.partitions(); !reflect.DeepEqual(got, []int{-1}) {
+		t.Fatalf("expected only the default partition, got %v", got)
+	}
+	if c.of(7) != -1 || c.insertPartition(-1) != "" || c.searchPartitions(-1) != nil || c.columns([]int64{1}) != nil {
+		t.Fatal("expected no partitioning")
+	}
+	if got := c.filter("id == 1", -1); got != "id == 1" {
+		t.Fatalf("expected the filter to be unchanged, got %s", got)
+	}
+	schema := c.schema(monitoringSchema("col", defaultVectorConfig))
+	if len(schema.Fields) != 4 {
+		t.Fatalf("expected the monitoring schema, got %d fields", len(schema.Fields))
+	}
+}
+
+func TestPartitionConfigKey(t *testing.T) {
+	c := PartitionConfig{Mode: partitionModeKey, Count: 3}
+	if got := c.partitions(); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("expected 3 partitions, got %v", got)
+	}
+	if c.of(7) != 1 || c.insertPartition(1) != "" || c.searchPartitions(1) != nil {
+		t.Fatal("expected items routed by the partition key")
+	}
+	if got := c.filter("id >= 0 && id < 10", 2); got != `(id >= 0 && id < 10) && partition == "partition_2"` {
+		t.Fatalf("unexpected filter %s", got)
+	}
+	if got := c.filter("", 2); got != `partition == "partition_2"` {
+		t.Fatalf("unexpected filter %s", got)
+	}
+
+	schema := c.schema(monitoringSchema("col", defaultVectorConfig))
+	field := schema.Fields[len(schema.Fields)-1]
+	if field.Name != "partition" || !field.IsPartitionKey || field.DataType != entity.FieldTypeVarChar {
+		t.Fatalf("expected a partition key field, got %+v", field)
+	}
+	columns := c.columns([]int64{0, 4, 5})
+	if len(columns) != 1 || !reflect.DeepEqual(columns[0].(*mvcol.ColumnVarChar).Data(), []string{"partition_0", "partition_1", "partition_2"}) {
+		t.Fatalf("unexpected partition columns %v", columns)
+	}
+}
+
+func TestPartitionConfigExplicit(t *testing.T) {
+	c := PartitionConfig{Mode: partitionModeExplicit, Count: 2}
+	if c.insertPartition(1) != "partition_1" || !reflect.DeepEqual(c.searchPartitions(0), []string{"partition_0"}) {
+		t.Fatal("expected items in explicit partitions")
+	}
+	if c.columns([]int64{1}) != nil || c.filter("id == 1", 1) != "id == 1" {
+		t.Fatal("expected no partition key")
+	}
+
+	order, groups := c.groupByPartition([]int64{3, 4, 5, 6})
+	if !reflect.DeepEqual(order, []int{1, 0}) || !reflect.DeepEqual(groups, map[int][]int{1: {0, 2}, 0: {1, 3}}) {
+		t.Fatalf("unexpected groups %v %v", order, groups)
+	}
+}
+
+func TestPartitionOpLabels(t *testing.T) {
+	e := &MilvusEndpoint{Name: "milvus:19530", ClusterName: "cluster", Config: MilvusEndpointConfig{MonitoringDatabase: "monitoring"}}
+	expected := []string{"insert", "milvus:19530", "monitoring", "cluster", "milvus:19530", "partition_3"}
+	if got := e.partitionOpLabels("insert", 3); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	expected[5] = ""
+	if got := e.partitionOpLabels("insert", -1); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v without partitioning, got %v", expected, got)
+	}
+}
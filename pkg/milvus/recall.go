@@ -0,0 +1,209 @@
+package milvus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/go-kit/log/level"
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	mvindex "github.com/milvus-io/milvus/client/v2/index"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var searchRecall = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_search_recall",
+	Help: "Mean recall@k of the searches on the recall collection of an index (share of the true top k found in the top k results)",
+}, []string{"index", "index_type", "k", "namespace", "cluster", "probe_endpoint"})
+
+func recallCollection(e *MilvusEndpoint, index RecallIndexConfig) string {
+	return e.Config.MonitoringCollectionRecallPrefix + index.Name
+}
+
+// buildIndex returns the index to create on the vector field of a recall collection.
+func (index RecallIndexConfig) buildIndex(vector VectorConfig) mvindex.Index {
+	params := make(map[string]string, len(index.Params)+2)
+	for k, v := range index.Params {
+		params[k] = v
+	}
+	params[mvindex.IndexTypeKey] = index.Type
+	params[mvindex.MetricTypeKey] = vector.MetricType
+	return mvindex.NewGenericIndex("", params)
+}
+
+func (index RecallIndexConfig) annParam() mvindex.AnnParam {
+	ap := mvindex.NewCustomAnnParam()
+	for k, v := range index.SearchParams {
+		ap.WithExtraParam(k, v)
+	}
+	return ap
+}
+
+// recallDataset returns the vectors of the items of the recall collections, indexed by id.
+func (e *MilvusEndpoint) recallDataset() []entity.Vector {
+	return e.recallVectors.get(e, e.Config.RecallVector, e.Config.RecallKeyPrefix)
+}
+
+// groundTruth returns the ids of the k closest vectors of the dataset to the query, by brute
+// force, and the similarity of the k-th one.
+func groundTruth(vector VectorConfig, dataset []entity.Vector, query entity.Vector, k int) ([]int64, float64) {
+	ids := make([]int64, len(dataset))
+	for i := range dataset {
+		ids[i] = int64(i)
+	}
+	return groundTruthAmong(vector, dataset, ids, query, k)
+}
+
+// groundTruthAmong is groundTruth restricted to the candidate ids.
+func groundTruthAmong(vector VectorConfig, dataset []entity.Vector, candidates []int64, query entity.Vector, k int) ([]int64, float64) {
+	scores := make(map[int64]float64, len(candidates))
+	ids := make([]int64, len(candidates))
+	for i, id := range candidates {
+		scores[id] = vector.similarity(dataset[id], query)
+		ids[i] = id
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return scores[ids[i]] > scores[ids[j]]
+	})
+	if k > len(ids) {
+		k = len(ids)
+	}
+	if k == 0 {
+		return nil, 0
+	}
+	return ids[:k], scores[ids[k-1]]
+}
+
+// recallAtK returns the share of the true top k found in the results. As ties are ordered
+// arbitrarily (frequent with binary vectors), a result as close to the query as the k-th true
+// neighbour counts as found.
+func recallAtK(truth []int64, kthScore float64, results []int64, score func(id int64) float64) float64 {
+	if len(truth) == 0 {
+		return 1
+	}
+	var found int
+	seen := make(map[int64]struct{}, len(results))
+	for _, id := range results {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		if score(id) >= kthScore-VECTOR_TOLERANCE {
+			found++
+		}
+	}
+	return math.Min(float64(found)/float64(len(truth)), 1)
+}
+
+// RecallPrepare ensures the recall collections exist, with their index, and pushes their items.
+func RecallPrepare(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+	for _, index := range e.Config.RecallIndexes {
+		col := recallCollection(e, index)
+		if err := ensureCollectionWithIndex(ctx, e, col, entity.DefaultConsistencyLevel, e.Config.RecallVector, index.buildIndex(e.Config.RecallVector)); err != nil {
+			return errors.Wrapf(err, "ensure %s", col)
+		}
+		if err := initCollectionIfNeeded(ctx, e, col, e.Config.RecallKeyPrefix, e.Config.RecallVector, noPartitions); err != nil {
+			return errors.Wrapf(err, "init recall %s", col)
+		}
+	}
+	return nil
+}
+
+// RecallCheck searches random vectors on the collection of every configured index and compares
+// the top k results to the ground truth computed locally from the deterministic vectors, to
+// detect recall degradation of approximate indexes.
+func RecallCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+
+	dataset := e.recallDataset()
+	queries := make([]entity.Vector, e.Config.RecallQueriesPerCheck)
+	for i := range queries {
+		queries[i] = e.Config.RecallVector.randomVector()
+	}
+
+	var firstErr error
+	for _, index := range e.Config.RecallIndexes {
+		recall, err := recallCheckIndex(ctx, e, index, dataset, queries)
+		if err != nil {
+			level.Error(e.Logger).Log("msg", "recall check failed", "index", index.Name, "err", err)
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "recall check of index %s", index.Name)
+			}
+			continue
+		}
+		level.Debug(e.Logger).Log("msg", "recall measured", "index", index.Name, "recall", recall)
+		searchRecall.WithLabelValues(index.Name, index.Type, strconv.Itoa(e.Config.RecallTopK),
+			e.Config.MonitoringDatabase, e.ClusterName, e.GetName()).Set(recall)
+	}
+	return firstErr
+}
+
+func recallCheckIndex(ctx context.Context, e *MilvusEndpoint, index RecallIndexConfig, dataset []entity.Vector, queries []entity.Vector) (float64, error) {
+	vector := e.Config.RecallVector
+	col := recallCollection(e, index)
+	if err := ensureCollectionWithIndex(ctx, e, col, entity.DefaultConsistencyLevel, vector, index.buildIndex(vector)); err != nil {
+		return 0, errors.Wrapf(err, "ensure %s", col)
+	}
+
+	var rs []milvusclient.ResultSet
+	opSearch := func() error {
+		searchCtx, searchCancel := context.WithTimeout(ctx, e.Config.SearchTimeout)
+		defer searchCancel()
+
+		var err error
+		rs, err = e.Client.Search(searchCtx,
+			milvusclient.NewSearchOption(col, e.Config.RecallTopK, queries).
+				WithANNSField("vector").
+				WithAnnParam(index.annParam()))
+		return err
+	}
+	if err := ObserveOpLatency(opSearch, e.opLabels("search_recall_"+index.Name)); err != nil {
+		return 0, errors.Wrap(err, "search batch")
+	}
+	if len(rs) != len(queries) {
+		return 0, errors.Errorf("search result length mismatch: got %d want %d", len(rs), len(queries))
+	}
+
+	var total float64
+	for i := range rs {
+		var results []int64
+		if rs[i].IDs != nil {
+			idCol, ok := rs[i].IDs.(*mvcol.ColumnInt64)
+			if !ok {
+				return 0, errors.Errorf("unexpected id column for i=%d", i)
+			}
+			results = idCol.Data()
+		}
+		truth, kthScore := groundTruth(vector, dataset, queries[i], e.Config.RecallTopK)
+		total += recallAtK(truth, kthScore, results, func(id int64) float64 {
+			if id < 0 || id >= int64(len(dataset)) {
+				return math.Inf(-1)
+			}
+			return vector.similarity(dataset[id], queries[i])
+		})
+	}
+	return total / float64(len(rs)), nil
+}
@@ -0,0 +1,97 @@
+package milvus
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/milvus-io/milvus/client/v2/entity"
+	mvindex "github.com/milvus-io/milvus/client/v2/index"
+	"gopkg.in/yaml.v2"
+)
+
+func TestGroundTruth(t *testing.T) {
+	vector := defaultVectorConfig
+	dataset := []entity.Vector{
+		entity.FloatVector(normalizeVector([]float32{1, 0})),
+		entity.FloatVector(normalizeVector([]float32{0, 1})),
+		entity.FloatVector(normalizeVector([]float32{1, 1})),
+		entity.FloatVector(normalizeVector([]float32{-1, 0})),
+	}
+	got, kthScore := groundTruth(vector, dataset, entity.FloatVector(normalizeVector([]float32{1, 0.1})), 2)
+	if !reflect.DeepEqual(got, []int64{0, 2}) {
+		t.Fatalf("expected [0 2], got %v", got)
+	}
+	if expected := vector.similarity(dataset[2], entity.FloatVector(normalizeVector([]float32{1, 0.1}))); kthScore != expected {
+		t.Fatalf("expected the score of the 2nd neighbour %v, got %v", expected, kthScore)
+	}
+	if got, _ := groundTruth(vector, dataset, dataset[1], 10); len(got) != len(dataset) || got[0] != 1 {
+		t.Fatalf("expected every id starting with 1, got %v", got)
+	}
+}
+
+func TestRecallAtK(t *testing.T) {
+	// Scores of the dataset: ids 0 to 3 are the true top 4, 4 is tied with the 4th one
+	scores := map[int64]float64{0: 10, 1: 9, 2: 8, 3: 7, 4: 7, 5: 1}
+	score := func(id int64) float64 { return scores[id] }
+
+	tests := []struct {
+		name     string
+		results  []int64
+		expected float64
+	}{
+		{"AllFound", []int64{3, 2, 1, 0}, 1},
+		{"HalfFound", []int64{0, 1, 5, 6}, 0.5},
+		{"TiesCount", []int64{0, 1, 2, 4}, 1},
+		{"DuplicatesCountOnce", []int64{0, 0, 0, 0}, 0.25},
+		{"NoResult", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recallAtK([]int64{0, 1, 2, 3}, 7, tt.results, score); got != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecallDataset(t *testing.T) {
+	e := &MilvusEndpoint{Config: defaultMilvusEndpointConfig}
+	e.Config.InitItemsPerCollection = 5
+	dataset := e.recallDataset()
+	if len(dataset) != 6 {
+		t.Fatalf("expected the items and the init flag, got %d vectors", len(dataset))
+	}
+	if !vectorsMatch(dataset[3], e.Config.RecallVector.deterministicVector("recall_3")) {
+		t.Fatal("expected the vector of id 3 to be derived from its key")
+	}
+}
+
+func TestRecallIndexConfig(t *testing.T) {
+	var conf MilvusEndpointConfig
+	if err := yaml.Unmarshal([]byte("recall_indexes: [{type: IVF_FLAT, params: {nlist: '128'}, search_params: {nprobe: 16}}]"), &conf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	index := conf.RecallIndexes[0]
+	if index.Name != "ivf_flat" {
+		t.Fatalf("expected the name to default to the lowercased type, got %q", index.Name)
+	}
+	params := index.buildIndex(conf.RecallVector).Params()
+	if params[mvindex.IndexTypeKey] != "IVF_FLAT" || params[mvindex.MetricTypeKey] != "COSINE" || params["nlist"] != "128" {
+		t.Fatalf("unexpected index params %v", params)
+	}
+	if got := index.annParam().Params()["nprobe"]; got != 16 {
+		t.Fatalf("expected nprobe 16, got %v", got)
+	}
+
+	invalid := []string{
+		"recall_indexes: [{name: hnsw}]",
+		"recall_indexes: [{type: HNSW}, {type: hnsw}]",
+		"recall_indexes: [{type: HNSW, name: 'bad-name'}]",
+		"recall_top_k: 0",
+	}
+	for _, raw := range invalid {
+		if err := yaml.Unmarshal([]byte(raw), &conf); err == nil {
+			t.Fatalf("expected an error for %q", raw)
+		}
+	}
+}
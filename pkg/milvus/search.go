@@ -0,0 +1,334 @@
+package milvus
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/criteo/blackbox-prober/pkg/topology"
+	"github.com/go-kit/log/level"
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	mvindex "github.com/milvus-io/milvus/client/v2/index"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pkg/errors"
+)
+
+// Vectors of the `sparse_vector` field of the search collection, used by the hybrid search
+func searchSparseVector(e *MilvusEndpoint) VectorConfig {
+	return VectorConfig{Type: vectorTypeSparse, Dimension: e.Config.SearchSparseDimension, MetricType: string(entity.IP)}
+}
+
+// searchCategory returns the `category` scalar field of an item of the search collection.
+func searchCategory(e *MilvusEndpoint, id int64) int64 {
+	return id % int64(e.Config.SearchCategories)
+}
+
+// searchSchema adds a scalar `category` field, used by filters and grouping, and a sparse vector
+// field, used by the hybrid search, to the monitoring schema.
+func searchSchema(e *MilvusEndpoint) (*entity.Schema, map[string]mvindex.Index) {
+	sparse := searchSparseVector(e)
+	schema := monitoringSchema(e.Config.MonitoringCollectionSearch, e.Config.SearchVector).
+		WithField(entity.NewField().WithName("category").WithDataType(entity.FieldTypeInt64)).
+		WithField(sparse.field().WithName("sparse_vector"))
+	return schema, map[string]mvindex.Index{
+		"vector":        e.Config.SearchVector.exactIndex(),
+		"sparse_vector": sparse.exactIndex(),
+	}
+}
+
+func (e *MilvusEndpoint) searchDataset() ([]entity.Vector, []entity.Vector) {
+	return e.searchVectors.get(e, e.Config.SearchVector, e.Config.SearchKeyPrefix),
+		e.searchSparseVectors.get(e, searchSparseVector(e), e.Config.SearchKeyPrefix)
+}
+
+func ensureSearchCollection(ctx context.Context, e *MilvusEndpoint) error {
+	schema, indexes := searchSchema(e)
+	return ensureCollectionWithSchema(ctx, e, e.Config.MonitoringCollectionSearch, entity.DefaultConsistencyLevel, schema, indexes)
+}
+
+// SearchPrepare ensures the search collection exists and pushes its items.
+func SearchPrepare(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+	col := e.Config.MonitoringCollectionSearch
+	if err := ensureSearchCollection(ctx, e); err != nil {
+		return errors.Wrapf(err, "ensure %s", col)
+	}
+	sparse := searchSparseVector(e)
+	err := initCollectionWithColumnsIfNeeded(ctx, e, col, e.Config.SearchKeyPrefix, noPartitions, func(ids []int64, keys []string) []mvcol.Column {
+		categories := make([]int64, len(ids))
+		vecs := make([]entity.Vector, len(keys))
+		sparseVecs := make([]entity.Vector, len(keys))
+		for i := range ids {
+			categories[i] = searchCategory(e, ids[i])
+			vecs[i] = e.Config.SearchVector.deterministicVector(keys[i])
+			sparseVecs[i] = sparse.deterministicVector(keys[i])
+		}
+		return []mvcol.Column{
+			mvcol.NewColumnInt64("category", categories),
+			e.Config.SearchVector.column(vecs),
+			sparse.namedColumn("sparse_vector", sparseVecs),
+		}
+	})
+	if err != nil {
+		return errors.Wrapf(err, "init search %s", col)
+	}
+	return nil
+}
+
+// SearchCheck runs the search types of the production traffic on the search collection:
+// expression-filtered search, range search, grouping search and hybrid (dense+sparse) search
+// with reranking. The results are validated against the ones computed locally from the
+// deterministic vectors (the indexes are exact), and the latency is reported per search type.
+func SearchCheck(p topology.ProbeableEndpoint) error {
+	e, ok := p.(*MilvusEndpoint)
+	if !ok {
+		return fmt.Errorf("error: given endpoint is not a milvus endpoint")
+	}
+	ctx := context.Background()
+	if err := ensureMonitoringDB(ctx, e); err != nil {
+		return err
+	}
+	if err := ensureSearchCollection(ctx, e); err != nil {
+		return errors.Wrap(err, "ensure search collection")
+	}
+
+	searches := []struct {
+		operation string
+		search    func(ctx context.Context, e *MilvusEndpoint) error
+	}{
+		{"search_filtered", filteredSearch},
+		{"search_range", rangeSearch},
+		{"search_grouping", groupingSearch},
+		{"search_hybrid", hybridSearch},
+	}
+	var firstErr error
+	for _, s := range searches {
+		err := ObserveOpLatency(func() error { return s.search(ctx, e) }, e.opLabels(s.operation))
+		if err != nil {
+			level.Error(e.Logger).Log("msg", "search failed", "operation", s.operation, "err", err)
+			if firstErr == nil {
+				firstErr = errors.Wrap(err, s.operation)
+			}
+		}
+	}
+	return firstErr
+}
+
+func searchIDs(rs milvusclient.ResultSet) ([]int64, error) {
+	if rs.IDs == nil {
+		return nil, nil
+	}
+	idCol, ok := rs.IDs.(*mvcol.ColumnInt64)
+	if !ok {
+		return nil, errors.New("unexpected id column")
+	}
+	return idCol.Data(), nil
+}
+
+func searchOne(ctx context.Context, e *MilvusEndpoint, opt milvusclient.SearchOption) ([]int64, error) {
+	searchCtx, searchCancel := context.WithTimeout(ctx, e.Config.SearchTimeout)
+	defer searchCancel()
+
+	rs, err := e.Client.Search(searchCtx, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) != 1 {
+		return nil, errors.Errorf("search result length mismatch: got %d want 1", len(rs))
+	}
+	return searchIDs(rs[0])
+}
+
+// filteredSearch searches a random vector among the items of a random category, and expects
+// the true top k of that category.
+func filteredSearch(ctx context.Context, e *MilvusEndpoint) error {
+	vector := e.Config.SearchVector
+	dataset, _ := e.searchDataset()
+	query := vector.randomVector()
+	category := int64(rand.Intn(e.Config.SearchCategories))
+
+	ids, err := searchOne(ctx, e, milvusclient.NewSearchOption(e.Config.MonitoringCollectionSearch, e.Config.SearchTopK, []entity.Vector{query}).
+		WithANNSField("vector").
+		WithFilter(fmt.Sprintf("category == %d", category)))
+	if err != nil {
+		return err
+	}
+	return validateFilteredSearch(e, dataset, query, category, ids)
+}
+
+// validateFilteredSearch checks that the results of the filtered search of the query are the
+// true top k among the items of the category.
+func validateFilteredSearch(e *MilvusEndpoint, dataset []entity.Vector, query entity.Vector, category int64, ids []int64) error {
+	vector := e.Config.SearchVector
+	candidates := make([]int64, 0, len(dataset)/e.Config.SearchCategories+1)
+	for id := range dataset {
+		if searchCategory(e, int64(id)) == category {
+			candidates = append(candidates, int64(id))
+		}
+	}
+	for _, id := range ids {
+		if id < 0 || id >= int64(len(dataset)) || searchCategory(e, id) != category {
+			return errors.Errorf("result %d does not match the filter category == %d", id, category)
+		}
+	}
+	truth, kthScore := groundTruthAmong(vector, dataset, candidates, query, e.Config.SearchTopK)
+	recall := recallAtK(truth, kthScore, ids, func(id int64) float64 {
+		return vector.similarity(dataset[id], query)
+	})
+	if recall < 1 {
+		return errors.Errorf("filtered search returned %.0f%% of the expected results", recall*100)
+	}
+	return nil
+}
+
+// rangeSearch searches a random vector with a radius between its k-th and (k+1)-th true
+// neighbours, and expects exactly the true top k.
+func rangeSearch(ctx context.Context, e *MilvusEndpoint) error {
+	vector := e.Config.SearchVector
+	dataset, _ := e.searchDataset()
+	query := vector.randomVector()
+	k := e.Config.SearchTopK
+
+	radius, neighbours, err := rangeSearchRadius(vector, dataset, query, k)
+	if err != nil {
+		return err
+	}
+	ap := mvindex.NewCustomAnnParam()
+	ap.WithRadius(radius)
+
+	ids, err := searchOne(ctx, e, milvusclient.NewSearchOption(e.Config.MonitoringCollectionSearch, 2*k, []entity.Vector{query}).
+		WithANNSField("vector").
+		WithAnnParam(ap))
+	if err != nil {
+		return err
+	}
+	return validateRangeSearch(neighbours, ids)
+}
+
+// rangeSearchRadius returns the radius of the range search of the query, halfway between its
+// k-th and (k+1)-th true neighbours, and the true top k inside that radius.
+func rangeSearchRadius(vector VectorConfig, dataset []entity.Vector, query entity.Vector, k int) (float64, []int64, error) {
+	neighbours, _ := groundTruth(vector, dataset, query, k+1)
+	if len(neighbours) <= k {
+		return 0, nil, errors.Errorf("range search needs more than %d items", k)
+	}
+	// Similarity halfway between the k-th and (k+1)-th neighbours
+	boundary := (vector.similarity(dataset[neighbours[k-1]], query) + vector.similarity(dataset[neighbours[k]], query)) / 2
+	if vector.metricType() == entity.L2 {
+		// L2 radius is an upper bound of the (squared) distance, which is -similarity
+		return -boundary, neighbours[:k], nil
+	}
+	// IP and COSINE radius is a lower bound of the similarity
+	return boundary, neighbours[:k], nil
+}
+
+// validateRangeSearch checks that the results of the range search are exactly the expected items.
+func validateRangeSearch(expectedIDs []int64, ids []int64) error {
+	expected := make(map[int64]struct{}, len(expectedIDs))
+	for _, id := range expectedIDs {
+		expected[id] = struct{}{}
+	}
+	for _, id := range ids {
+		if _, ok := expected[id]; !ok {
+			return errors.Errorf("result %d is out of the range", id)
+		}
+		delete(expected, id)
+	}
+	if len(expected) > 0 {
+		return errors.Errorf("%d items in the range are missing from the results", len(expected))
+	}
+	return nil
+}
+
+// groupingSearch searches a random vector grouped by category, and expects the closest item of
+// every category.
+func groupingSearch(ctx context.Context, e *MilvusEndpoint) error {
+	vector := e.Config.SearchVector
+	dataset, _ := e.searchDataset()
+	query := vector.randomVector()
+
+	ids, err := searchOne(ctx, e, milvusclient.NewSearchOption(e.Config.MonitoringCollectionSearch, e.Config.SearchCategories, []entity.Vector{query}).
+		WithANNSField("vector").
+		WithGroupByField("category"))
+	if err != nil {
+		return err
+	}
+	return validateGroupingSearch(e, dataset, query, ids)
+}
+
+// validateGroupingSearch checks that the results of the grouping search of the query are the
+// closest item of every category, once each.
+func validateGroupingSearch(e *MilvusEndpoint, dataset []entity.Vector, query entity.Vector, ids []int64) error {
+	vector := e.Config.SearchVector
+	best := make(map[int64]float64, e.Config.SearchCategories)
+	for id := range dataset {
+		category := searchCategory(e, int64(id))
+		score := vector.similarity(dataset[id], query)
+		if current, ok := best[category]; !ok || score > current {
+			best[category] = score
+		}
+	}
+	for _, id := range ids {
+		if id < 0 || id >= int64(len(dataset)) {
+			return errors.Errorf("unexpected result %d", id)
+		}
+		category := searchCategory(e, id)
+		score, ok := best[category]
+		if !ok {
+			return errors.Errorf("category %d returned twice", category)
+		}
+		if vector.similarity(dataset[id], query) < score-VECTOR_TOLERANCE {
+			return errors.Errorf("result %d is not the closest item of category %d", id, category)
+		}
+		delete(best, category)
+	}
+	if len(best) > 0 {
+		return errors.Errorf("%d categories are missing from the results", len(best))
+	}
+	return nil
+}
+
+// hybridSearch searches the dense and sparse vectors of a random item, reranked with RRF, and
+// expects that item first as it is the closest for both requests.
+func hybridSearch(ctx context.Context, e *MilvusEndpoint) error {
+	dataset, sparseDataset := e.searchDataset()
+	target := rand.Intn(e.Config.InitItemsPerCollection)
+	k := e.Config.SearchTopK
+
+	searchCtx, searchCancel := context.WithTimeout(ctx, e.Config.SearchTimeout)
+	defer searchCancel()
+
+	rs, err := e.Client.HybridSearch(searchCtx, milvusclient.NewHybridSearchOption(e.Config.MonitoringCollectionSearch, k,
+		milvusclient.NewAnnRequest("vector", k, dataset[target]),
+		milvusclient.NewAnnRequest("sparse_vector", k, sparseDataset[target]),
+	).WithReranker(milvusclient.NewRRFReranker()))
+	if err != nil {
+		return err
+	}
+	if len(rs) != 1 {
+		return errors.Errorf("search result length mismatch: got %d want 1", len(rs))
+	}
+	ids, err := searchIDs(rs[0])
+	if err != nil {
+		return err
+	}
+	return validateHybridSearch(int64(target), ids)
+}
+
+// validateHybridSearch checks that the searched item comes first in the results of the hybrid
+// search.
+func validateHybridSearch(target int64, ids []int64) error {
+	if len(ids) == 0 || ids[0] != target {
+		return errors.Errorf("top-1 mismatch: got %v want %d", ids, target)
+	}
+	return nil
+}
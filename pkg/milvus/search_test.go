@@ -0,0 +1,202 @@
+package milvus
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/milvus-io/milvus/client/v2/entity"
+	mvindex "github.com/milvus-io/milvus/client/v2/index"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSearchSchema(t *testing.T) {
+	e := &MilvusEndpoint{Config: defaultMilvusEndpointConfig}
+	schema, indexes := searchSchema(e)
+
+	fields := make(map[string]entity.FieldType)
+	for _, field := range schema.Fields {
+		fields[field.Name] = field.DataType
+	}
+	expected := map[string]entity.FieldType{
+		"id":            entity.FieldTypeInt64,
+		"key":           entity.FieldTypeVarChar,
+		"value":         entity.FieldTypeVarChar,
+		"vector":        entity.FieldTypeFloatVector,
+		"category":      entity.FieldTypeInt64,
+		"sparse_vector": entity.FieldTypeSparseVector,
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected fields %v, got %v", expected, fields)
+	}
+	if got := indexes["sparse_vector"].Params()[mvindex.IndexTypeKey]; got != string(mvindex.SparseInverted) {
+		t.Fatalf("expected a sparse inverted index on sparse_vector, got %s", got)
+	}
+	if got := indexes["vector"].Params()[mvindex.IndexTypeKey]; got != string(mvindex.Flat) {
+		t.Fatalf("expected a FLAT index on vector, got %s", got)
+	}
+}
+
+func TestGroundTruthAmong(t *testing.T) {
+	vector := defaultVectorConfig
+	dataset := []entity.Vector{
+		entity.FloatVector(normalizeVector([]float32{1, 0})),
+		entity.FloatVector(normalizeVector([]float32{0, 1})),
+		entity.FloatVector(normalizeVector([]float32{1, 1})),
+		entity.FloatVector(normalizeVector([]float32{1, 0.1})),
+	}
+	got, _ := groundTruthAmong(vector, dataset, []int64{1, 2}, dataset[0], 1)
+	if !reflect.DeepEqual(got, []int64{2}) {
+		t.Fatalf("expected the closest candidate [2], got %v", got)
+	}
+}
+
+func TestSearchConfig(t *testing.T) {
+	for _, raw := range []string{
+		"search_vector: {type: binary, dimension: 64}",
+		"search_top_k: 10000",
+		"search_categories: 0",
+	} {
+		var conf MilvusEndpointConfig
+		if err := yaml.Unmarshal([]byte(raw), &conf); err == nil {
+			t.Fatalf("expected an error for %q", raw)
+		}
+	}
+}
+
+// searchTestEndpoint searches 2 dimensions L2 vectors in 2 categories (even and odd ids), with a
+// top 2.
+func searchTestEndpoint() *MilvusEndpoint {
+	e := &MilvusEndpoint{Config: defaultMilvusEndpointConfig}
+	e.Config.SearchVector = VectorConfig{Type: vectorTypeFloat, Dimension: 2, MetricType: string(entity.L2)}
+	e.Config.SearchCategories = 2
+	e.Config.SearchTopK = 2
+	return e
+}
+
+// lineDataset returns the points (0, 0), (1, 0), ... (n-1, 0): the item i is at a squared
+// distance i² of the origin.
+func lineDataset(n int) []entity.Vector {
+	dataset := make([]entity.Vector, n)
+	for i := range dataset {
+		dataset[i] = entity.FloatVector([]float32{float32(i), 0})
+	}
+	return dataset
+}
+
+func checkSearchError(t *testing.T, name string, err error, expected string) {
+	t.Helper()
+	if expected == "" && err != nil {
+		t.Errorf("%s: expected nil error, got %v", name, err)
+	}
+	if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+		t.Errorf("%s: expected error %q, got %v", name, expected, err)
+	}
+}
+
+func TestValidateFilteredSearch(t *testing.T) {
+	e := searchTestEndpoint()
+	dataset := lineDataset(6)
+	origin := entity.FloatVector([]float32{0, 0})
+
+	// The top 2 of the odd items are 1 and 3
+	for name, tc := range map[string]struct {
+		ids []int64
+		err string
+	}{
+		"top k":           {[]int64{1, 3}, ""},
+		"any order":       {[]int64{3, 1}, ""},
+		"other category":  {[]int64{0, 1}, "result 0 does not match the filter category == 1"},
+		"unknown item":    {[]int64{1, 7}, "result 7 does not match the filter"},
+		"not the closest": {[]int64{1, 5}, "filtered search returned 50% of the expected results"},
+		"missing results": {[]int64{}, "filtered search returned 0%"},
+	} {
+		checkSearchError(t, name, validateFilteredSearch(e, dataset, origin, 1, tc.ids), tc.err)
+	}
+}
+
+func TestRangeSearchRadius(t *testing.T) {
+	dataset := lineDataset(6)
+	for name, tc := range map[string]struct {
+		vector     VectorConfig
+		query      entity.Vector
+		radius     float64
+		neighbours []int64
+	}{
+		// Squared distances 0, 1, 4: the radius is an upper bound of the distance, between 1 and 4
+		"L2": {VectorConfig{Type: vectorTypeFloat, Dimension: 2, MetricType: string(entity.L2)}, entity.FloatVector([]float32{0, 0}), 2.5, []int64{0, 1}},
+		// Inner products 5, 4, 3: the radius is a lower bound of the similarity, between 4 and 3
+		"IP": {VectorConfig{Type: vectorTypeFloat, Dimension: 2, MetricType: string(entity.IP)}, entity.FloatVector([]float32{1, 0}), 3.5, []int64{5, 4}},
+	} {
+		radius, neighbours, err := rangeSearchRadius(tc.vector, dataset, tc.query, 2)
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %v", name, err)
+		}
+		if math.Abs(radius-tc.radius) > 1e-6 || !reflect.DeepEqual(neighbours, tc.neighbours) {
+			t.Errorf("%s: expected radius %v with %v, got %v with %v", name, tc.radius, tc.neighbours, radius, neighbours)
+		}
+	}
+
+	// COSINE: items at 0, 30, 60 and 90 degrees from the query
+	cosine := VectorConfig{Type: vectorTypeFloat, Dimension: 2, MetricType: string(entity.COSINE)}
+	angles := []entity.Vector{}
+	for _, degrees := range []float64{90, 0, 60, 30} {
+		rad := degrees * math.Pi / 180
+		angles = append(angles, entity.FloatVector([]float32{float32(math.Cos(rad)), float32(math.Sin(rad))}))
+	}
+	radius, neighbours, err := rangeSearchRadius(cosine, angles, entity.FloatVector([]float32{1, 0}), 2)
+	if err != nil {
+		t.Fatalf("COSINE: expected nil error, got %v", err)
+	}
+	// Halfway between cos(30°) and cos(60°), positive as a lower bound of the similarity
+	if expected := (math.Cos(math.Pi/6) + 0.5) / 2; math.Abs(radius-expected) > 1e-6 || !reflect.DeepEqual(neighbours, []int64{1, 3}) {
+		t.Errorf("COSINE: expected radius %v with [1 3], got %v with %v", expected, radius, neighbours)
+	}
+
+	if _, _, err := rangeSearchRadius(cosine, angles, entity.FloatVector([]float32{1, 0}), 4); err == nil {
+		t.Errorf("expected an error without an item out of the range")
+	}
+}
+
+func TestValidateRangeSearch(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ids []int64
+		err string
+	}{
+		"in range":     {[]int64{0, 1}, ""},
+		"any order":    {[]int64{1, 0}, ""},
+		"out of range": {[]int64{0, 1, 2}, "result 2 is out of the range"},
+		"duplicate":    {[]int64{0, 0, 1}, "result 0 is out of the range"},
+		"missing":      {[]int64{1}, "1 items in the range are missing"},
+	} {
+		checkSearchError(t, name, validateRangeSearch([]int64{0, 1}, tc.ids), tc.err)
+	}
+}
+
+func TestValidateGroupingSearch(t *testing.T) {
+	e := searchTestEndpoint()
+	dataset := lineDataset(6)
+	origin := entity.FloatVector([]float32{0, 0})
+
+	// The closest items of the categories are 0 and 1
+	for name, tc := range map[string]struct {
+		ids []int64
+		err string
+	}{
+		"closest of each category": {[]int64{0, 1}, ""},
+		"any order":                {[]int64{1, 0}, ""},
+		"not the closest":          {[]int64{2, 1}, "result 2 is not the closest item of category 0"},
+		"category twice":           {[]int64{0, 1, 3}, "category 1 returned twice"},
+		"missing category":         {[]int64{0}, "1 categories are missing"},
+		"unknown item":             {[]int64{0, 7}, "unexpected result 7"},
+	} {
+		checkSearchError(t, name, validateGroupingSearch(e, dataset, origin, tc.ids), tc.err)
+	}
+}
+
+func TestValidateHybridSearch(t *testing.T) {
+	checkSearchError(t, "target first", validateHybridSearch(3, []int64{3, 1}), "")
+	checkSearchError(t, "target second", validateHybridSearch(3, []int64{1, 3}), "top-1 mismatch: got [1 3] want 3")
+	checkSearchError(t, "no result", validateHybridSearch(3, nil), "top-1 mismatch")
+}
@@ -0,0 +1,251 @@
+package milvus
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	milvusclient "github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/metricsinfo"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var serverInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_server_info",
+	Help: "Version of the Milvus server reached by the probe endpoint (always 1)",
+}, []string{"version", "cluster", "probe_endpoint"})
+
+var clusterHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_cluster_healthy",
+	Help: "Whether Milvus reports the cluster as healthy (1) or not (0)",
+}, []string{"cluster", "probe_endpoint"})
+
+var componentHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_component_healthy",
+	Help: "Whether a Milvus component (root coord, query node, data node...) of the system topology reports no error (1) or an error (0)",
+}, []string{"role", "component", "cluster", "probe_endpoint"})
+
+var collectionLoadedReplicas = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: MVSuffix + "_collection_loaded_replicas",
+	Help: "Number of loaded replicas of a monitoring collection",
+}, []string{"collection", "namespace", "cluster", "probe_endpoint"})
+
+// componentHealth is the health of a component in the system topology of Milvus.
+type componentHealth struct {
+	Role        string
+	Name        string
+	Healthy     bool
+	ErrorReason string
+}
+
+// Subset of the components infos of the system_info metrics (metricsinfo.BaseComponentInfos)
+type systemTopology struct {
+	NodesInfo []struct {
+		Infos struct {
+			Name        string `json:"name"`
+			Type        string `json:"type"`
+			HasError    bool   `json:"has_error"`
+			ErrorReason string `json:"error_reason"`
+		} `json:"infos"`
+	} `json:"nodes_info"`
+}
+
+// parseComponentHealth returns the health of the components of the system_info metrics. The role
+// of a component is its type, or its name without the node id suffix for older versions.
+func parseComponentHealth(response string) ([]componentHealth, error) {
+	var topology systemTopology
+	if err := json.Unmarshal([]byte(response), &topology); err != nil {
+		return nil, errors.Wrap(err, "parse system topology")
+	}
+	components := make([]componentHealth, 0, len(topology.NodesInfo))
+	for _, node := range topology.NodesInfo {
+		infos := node.Infos
+		if infos.Name == "" {
+			continue
+		}
+		role := strings.ToLower(infos.Type)
+		if role == "" {
+			role = strings.TrimRight(infos.Name, "0123456789")
+		}
+		components = append(components, componentHealth{
+			Role:        role,
+			Name:        infos.Name,
+			Healthy:     !infos.HasError,
+			ErrorReason: infos.ErrorReason,
+		})
+	}
+	return components, nil
+}
+
+// monitoringCollections returns the names of the collections used by the checks.
+func (e *MilvusEndpoint) monitoringCollections() []string {
+	collections := []string{
+		e.Config.MonitoringCollectionLatencyRW,
+		e.Config.MonitoringCollectionLatencyRO,
+		e.Config.MonitoringCollectionDurability,
+		e.Config.MonitoringCollectionConsistency,
+		e.Config.MonitoringCollectionSearch,
+	}
+	for _, index := range e.Config.RecallIndexes {
+		collections = append(collections, recallCollection(e, index))
+	}
+	return collections
+}
+
+// Refresh exports the version of the server reached by the endpoint. Cluster endpoints also
+// export the health of the cluster and of its components, and the number of loaded replicas of
+// the monitoring collections.
+func (e *MilvusEndpoint) Refresh() error {
+	if e.Client == nil {
+		return nil
+	}
+	ctx := context.Background()
+
+	type refresh struct {
+		name    string
+		refresh func(ctx context.Context) error
+	}
+	refreshes := []refresh{{"server version", e.refreshServerVersion}}
+	if e.ClusterLevel {
+		refreshes = append(refreshes,
+			refresh{"cluster health", e.refreshClusterHealth},
+			refresh{"component health", e.refreshComponentHealth},
+			refresh{"loaded replicas", e.refreshLoadedReplicas},
+		)
+	}
+
+	var firstErr error
+	for _, r := range refreshes {
+		if err := r.refresh(ctx); err != nil {
+			level.Error(e.Logger).Log("msg", "Failed to refresh "+r.name, "err", err)
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "refresh %s", r.name)
+			}
+		}
+	}
+	return firstErr
+}
+
+func (e *MilvusEndpoint) refreshServerVersion(ctx context.Context) error {
+	versionCtx, versionCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+	defer versionCancel()
+
+	version, err := e.Client.GetServerVersion(versionCtx, milvusclient.NewGetServerVersionOption())
+	if err != nil {
+		return err
+	}
+	serverInfo.DeletePartialMatch(prometheus.Labels{"cluster": e.ClusterName, "probe_endpoint": e.GetName()})
+	serverInfo.WithLabelValues(version, e.ClusterName, e.GetName()).Set(1)
+	return nil
+}
+
+func (e *MilvusEndpoint) refreshClusterHealth(ctx context.Context) error {
+	healthCtx, healthCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+	defer healthCancel()
+
+	resp, err := e.Client.GetService().CheckHealth(healthCtx, &milvuspb.CheckHealthRequest{})
+	if err := merr.CheckRPCCall(resp, err); err != nil {
+		return err
+	}
+	healthy := 0.
+	if resp.GetIsHealthy() {
+		healthy = 1
+	} else {
+		level.Warn(e.Logger).Log("msg", "Milvus reports the cluster as unhealthy", "reasons", strings.Join(resp.GetReasons(), "; "))
+	}
+	clusterHealthy.WithLabelValues(e.ClusterName, e.GetName()).Set(healthy)
+	return nil
+}
+
+func (e *MilvusEndpoint) refreshComponentHealth(ctx context.Context) error {
+	metricsCtx, metricsCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+	defer metricsCancel()
+
+	req, err := metricsinfo.ConstructRequestByMetricType(metricsinfo.SystemInfoMetrics)
+	if err != nil {
+		return err
+	}
+	resp, err := e.Client.GetService().GetMetrics(metricsCtx, req)
+	if err := merr.CheckRPCCall(resp, err); err != nil {
+		return err
+	}
+	components, err := parseComponentHealth(resp.GetResponse())
+	if err != nil {
+		return err
+	}
+
+	// Components are replaced, so removed nodes do not keep exporting their last known state
+	componentHealthy.DeletePartialMatch(prometheus.Labels{"cluster": e.ClusterName, "probe_endpoint": e.GetName()})
+	for _, component := range components {
+		healthy := 0.
+		if component.Healthy {
+			healthy = 1
+		} else {
+			level.Warn(e.Logger).Log("msg", "Milvus component reports an error", "component", component.Name, "reason", component.ErrorReason)
+		}
+		componentHealthy.WithLabelValues(component.Role, component.Name, e.ClusterName, e.GetName()).Set(healthy)
+	}
+	return nil
+}
+
+// replicasNotLoaded tells whether a DescribeReplica error means that the collection has no loaded
+// replica, rather than a failure to get them.
+func replicasNotLoaded(err error) bool {
+	switch merr.Code(err) {
+	case merr.Code(merr.ErrCollectionNotLoaded), merr.Code(merr.ErrReplicaNotFound):
+		return true
+	}
+	return false
+}
+
+// refreshLoadedReplicas does not create the monitoring database or collections, which is left to
+// the checks: missing ones are not exported.
+func (e *MilvusEndpoint) refreshLoadedReplicas(ctx context.Context) error {
+	if err := useMonitoringDB(ctx, e); err != nil {
+		if merr.Code(err) == merr.Code(merr.ErrDatabaseNotFound) {
+			collectionLoadedReplicas.DeletePartialMatch(prometheus.Labels{"cluster": e.ClusterName, "probe_endpoint": e.GetName()})
+			return nil
+		}
+		return err
+	}
+	listCtx, listCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+	defer listCancel()
+
+	existing, err := e.Client.ListCollections(listCtx, milvusclient.NewListCollectionOption())
+	if err != nil {
+		return errors.Wrap(err, "list collections")
+	}
+	has := make(map[string]struct{}, len(existing))
+	for _, name := range existing {
+		has[name] = struct{}{}
+	}
+
+	// Collections of disabled checks do not exist
+	// Collections failing to be described are not exported either, rather than as not loaded
+	collectionLoadedReplicas.DeletePartialMatch(prometheus.Labels{"cluster": e.ClusterName, "probe_endpoint": e.GetName()})
+	var firstErr error
+	for _, col := range e.monitoringCollections() {
+		if _, ok := has[col]; !ok {
+			continue
+		}
+		replicaCtx, replicaCancel := context.WithTimeout(ctx, e.Config.QueryTimeout)
+		replicas, err := e.Client.DescribeReplica(replicaCtx, milvusclient.NewDescribeReplicaOption(col))
+		replicaCancel()
+		if err != nil {
+			if !replicasNotLoaded(err) {
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "describe replicas of %s", col)
+				}
+				continue
+			}
+			replicas = nil
+		}
+		collectionLoadedReplicas.WithLabelValues(col, e.Config.MonitoringDatabase, e.ClusterName, e.GetName()).Set(float64(len(replicas)))
+	}
+	return firstErr
+}
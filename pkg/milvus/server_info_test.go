@@ -0,0 +1,62 @@
+package milvus
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseComponentHealth(t *testing.T) {
+	response := `{"nodes_info": [
+		{"identifier": 1, "connected": [], "infos": {"name": "proxy1", "type": "proxy", "has_error": false}},
+		{"identifier": 2, "connected": [], "infos": {"name": "querynode12", "has_error": true, "error_reason": "out of memory"}},
+		{"identifier": 3, "connected": [], "infos": {"name": "datanode3", "type": "DataNode", "has_error": false}},
+		{"identifier": 4, "connected": [], "infos": {}}
+	]}`
+	components, err := parseComponentHealth(response)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []componentHealth{
+		{Role: "proxy", Name: "proxy1", Healthy: true},
+		{Role: "querynode", Name: "querynode12", Healthy: false, ErrorReason: "out of memory"},
+		{Role: "datanode", Name: "datanode3", Healthy: true},
+	}
+	if !reflect.DeepEqual(components, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, components)
+	}
+
+	if _, err := parseComponentHealth("not json"); err == nil {
+		t.Fatal("expected an error with an invalid response")
+	}
+}
+
+func TestMonitoringCollections(t *testing.T) {
+	e := &MilvusEndpoint{Config: defaultMilvusEndpointConfig}
+	expected := []string{"monitoring_latency_rw", "monitoring_latency_ro", "monitoring_durability", "monitoring_consistency", "monitoring_search", "monitoring_recall_hnsw"}
+	if got := e.monitoringCollections(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestReplicasNotLoaded(t *testing.T) {
+	tests := []struct {
+		err       error
+		notLoaded bool
+	}{
+		{merr.WrapErrCollectionNotLoaded("monitoring_latency_rw"), true},
+		{errors.Wrap(merr.WrapErrReplicaNotFound(1), "describe"), true},
+		{merr.WrapErrServiceUnavailable("querycoord down"), false},
+		{status.Error(codes.Unavailable, "connection refused"), false},
+		{errors.New("context deadline exceeded"), false},
+	}
+	for _, tt := range tests {
+		if got := replicasNotLoaded(tt.err); got != tt.notLoaded {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.notLoaded, got)
+		}
+	}
+}
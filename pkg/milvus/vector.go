@@ -0,0 +1,321 @@
+package milvus
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+
+	mvcol "github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	mvindex "github.com/milvus-io/milvus/client/v2/index"
+	"github.com/pkg/errors"
+)
+
+// Vector types of the `vector` field of the monitoring collections
+const (
+	vectorTypeFloat   = "float"
+	vectorTypeFloat16 = "float16"
+	vectorTypeBinary  = "binary"
+	vectorTypeSparse  = "sparse"
+)
+
+// Schema of the `vector` field of a monitoring collection, and how its data is generated
+type VectorConfig struct {
+	// float, float16, binary or sparse
+	Type string `yaml:"type,omitempty"`
+	// Number of dimensions (bits for binary vectors, index space for sparse vectors)
+	Dimension int `yaml:"dimension,omitempty"`
+	// L2, IP or COSINE for float vectors, HAMMING or JACCARD for binary vectors, IP for sparse
+	// vectors. Defaults to COSINE, HAMMING and IP respectively.
+	MetricType string `yaml:"metric_type,omitempty"`
+}
+
+var (
+	defaultVectorConfig = VectorConfig{
+		Type:       vectorTypeFloat,
+		Dimension:  100,
+		MetricType: string(entity.COSINE),
+	}
+
+	vectorMetricTypes = map[string][]entity.MetricType{
+		vectorTypeFloat:   {entity.COSINE, entity.L2, entity.IP},
+		vectorTypeFloat16: {entity.COSINE, entity.L2, entity.IP},
+		vectorTypeBinary:  {entity.HAMMING, entity.JACCARD},
+		vectorTypeSparse:  {entity.IP},
+	}
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *VectorConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = defaultVectorConfig
+	c.MetricType = ""
+	type plain VectorConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	metrics, ok := vectorMetricTypes[c.Type]
+	if !ok {
+		return errors.Errorf("vector type must be %s, %s, %s or %s, got %q", vectorTypeFloat, vectorTypeFloat16, vectorTypeBinary, vectorTypeSparse, c.Type)
+	}
+	if c.MetricType == "" {
+		c.MetricType = string(metrics[0])
+	}
+	c.MetricType = strings.ToUpper(c.MetricType)
+	valid := false
+	for _, metric := range metrics {
+		valid = valid || c.MetricType == string(metric)
+	}
+	if !valid {
+		return errors.Errorf("metric type %s is not supported by %s vectors", c.MetricType, c.Type)
+	}
+	if c.Dimension <= 0 {
+		return errors.Errorf("vector dimension must be positive, got %d", c.Dimension)
+	}
+	if c.Type == vectorTypeBinary && c.Dimension%8 != 0 {
+		return errors.Errorf("binary vector dimension must be a multiple of 8, got %d", c.Dimension)
+	}
+	return nil
+}
+
+func (c VectorConfig) metricType() entity.MetricType {
+	return entity.MetricType(c.MetricType)
+}
+
+// field returns the `vector` field of the schema.
+func (c VectorConfig) field() *entity.Field {
+	field := entity.NewField().WithName("vector")
+	switch c.Type {
+	case vectorTypeFloat16:
+		return field.WithDataType(entity.FieldTypeFloat16Vector).WithDim(int64(c.Dimension))
+	case vectorTypeBinary:
+		return field.WithDataType(entity.FieldTypeBinaryVector).WithDim(int64(c.Dimension))
+	case vectorTypeSparse:
+		// Sparse vectors have no fixed dimension
+		return field.WithDataType(entity.FieldTypeSparseVector)
+	default:
+		return field.WithDataType(entity.FieldTypeFloatVector).WithDim(int64(c.Dimension))
+	}
+}
+
+// exactIndex returns the index used for exact searches on the `vector` field.
+func (c VectorConfig) exactIndex() mvindex.Index {
+	switch c.Type {
+	case vectorTypeBinary:
+		return mvindex.NewBinFlatIndex(c.metricType())
+	case vectorTypeSparse:
+		return mvindex.NewSparseInvertedIndex(c.metricType(), 0)
+	default:
+		return mvindex.NewFlatIndex(c.metricType())
+	}
+}
+
+// fromFloats converts arbitrary floats in [0, 1) (one per dimension) to a vector of the configured
+// type. Float vectors are normalized, binary vectors have the bits of the values >= 0.5 set and
+// sparse vectors keep the SPARSE_NON_ZEROS highest values, normalized.
+func (c VectorConfig) fromFloats(raw []float32) entity.Vector {
+	switch c.Type {
+	case vectorTypeFloat16:
+		return entity.FloatVector(normalizeVector(raw)).ToFloat16Vector()
+	case vectorTypeBinary:
+		vec := make(entity.BinaryVector, c.Dimension/8)
+		for i, v := range raw {
+			if v >= 0.5 {
+				vec[i/8] |= 1 << (i % 8)
+			}
+		}
+		return vec
+	case vectorTypeSparse:
+		positions := make([]uint32, len(raw))
+		for i := range positions {
+			positions[i] = uint32(i)
+		}
+		sort.SliceStable(positions, func(i, j int) bool {
+			return raw[positions[i]] > raw[positions[j]]
+		})
+		positions = positions[:min(SPARSE_NON_ZEROS, len(positions))]
+		values := make([]float32, len(positions))
+		for i, pos := range positions {
+			values[i] = raw[pos]
+		}
+		// Cannot fail: positions and values have the same length
+		vec, _ := entity.NewSliceSparseEmbedding(positions, normalizeVector(values))
+		return vec
+	default:
+		return entity.FloatVector(normalizeVector(raw))
+	}
+}
+
+func (c VectorConfig) randomVector() entity.Vector {
+	return c.fromFloats(generateRandomVector(c.Dimension))
+}
+
+func (c VectorConfig) deterministicVector(seed string) entity.Vector {
+	return c.fromFloats(generateDeterministicArbitraryVector(c.Dimension, seed))
+}
+
+// column returns the `vector` column holding the given vectors.
+func (c VectorConfig) column(vecs []entity.Vector) mvcol.Column {
+	return c.namedColumn("vector", vecs)
+}
+
+// namedColumn returns a column of the given name holding the given vectors.
+func (c VectorConfig) namedColumn(name string, vecs []entity.Vector) mvcol.Column {
+	switch c.Type {
+	case vectorTypeFloat16:
+		data := make([][]byte, len(vecs))
+		for i, vec := range vecs {
+			data[i] = vec.(entity.Float16Vector)
+		}
+		return mvcol.NewColumnFloat16Vector(name, c.Dimension, data)
+	case vectorTypeBinary:
+		data := make([][]byte, len(vecs))
+		for i, vec := range vecs {
+			data[i] = vec.(entity.BinaryVector)
+		}
+		return mvcol.NewColumnBinaryVector(name, c.Dimension, data)
+	case vectorTypeSparse:
+		data := make([]entity.SparseEmbedding, len(vecs))
+		for i, vec := range vecs {
+			data[i] = vec.(entity.SparseEmbedding)
+		}
+		return mvcol.NewColumnSparseVectors(name, data)
+	default:
+		data := make([][]float32, len(vecs))
+		for i, vec := range vecs {
+			data[i] = vec.(entity.FloatVector)
+		}
+		return mvcol.NewColumnFloatVector(name, c.Dimension, data)
+	}
+}
+
+// vectorAt returns the i-th vector of a `vector` column returned by Milvus.
+func vectorAt(col mvcol.Column, i int) (entity.Vector, error) {
+	value, err := col.Get(i)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case entity.Vector:
+		return v, nil
+	case []float32:
+		return entity.FloatVector(v), nil
+	}
+	return nil, errors.Errorf("unexpected vector type %T in column %s", value, col.Name())
+}
+
+// vectorsMatch compares a stored vector to the expected one. Float components are compared with
+// a tolerance for rounding, other types byte for byte.
+func vectorsMatch(actual, expected entity.Vector) bool {
+	a, ok := actual.(entity.FloatVector)
+	if !ok {
+		return actual.FieldType() == expected.FieldType() && bytes.Equal(actual.Serialize(), expected.Serialize())
+	}
+	b, ok := expected.(entity.FloatVector)
+	if !ok || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > VECTOR_TOLERANCE {
+			return false
+		}
+	}
+	return true
+}
+
+// similarity returns a score which is higher for closer vectors, according to the metric type.
+func (c VectorConfig) similarity(a, b entity.Vector) float64 {
+	switch a := a.(type) {
+	case entity.BinaryVector:
+		b := b.(entity.BinaryVector)
+		var common, differ, union int
+		for i := range a {
+			common += bits.OnesCount8(a[i] & b[i])
+			differ += bits.OnesCount8(a[i] ^ b[i])
+			union += bits.OnesCount8(a[i] | b[i])
+		}
+		if c.metricType() == entity.JACCARD {
+			if union == 0 {
+				return 1
+			}
+			return float64(common) / float64(union)
+		}
+		return -float64(differ)
+	case entity.SparseEmbedding:
+		// Only IP is supported, positions are sorted
+		b := b.(entity.SparseEmbedding)
+		var score float64
+		for i, j := 0, 0; i < a.Len() && j < b.Len(); {
+			posA, valA, _ := a.Get(i)
+			posB, valB, _ := b.Get(j)
+			switch {
+			case posA < posB:
+				i++
+			case posA > posB:
+				j++
+			default:
+				score += float64(valA) * float64(valB)
+				i++
+				j++
+			}
+		}
+		return score
+	}
+
+	fa, fb := asFloats(a), asFloats(b)
+	var dot, normA, normB, dist float64
+	for i := range fa {
+		dot += float64(fa[i]) * float64(fb[i])
+		normA += float64(fa[i]) * float64(fa[i])
+		normB += float64(fb[i]) * float64(fb[i])
+		d := float64(fa[i] - fb[i])
+		dist += d * d
+	}
+	switch c.metricType() {
+	case entity.L2:
+		return -dist
+	case entity.COSINE:
+		if normA == 0 || normB == 0 {
+			return 0
+		}
+		return dot / math.Sqrt(normA*normB)
+	default:
+		return dot
+	}
+}
+
+func asFloats(v entity.Vector) []float32 {
+	switch v := v.(type) {
+	case entity.Float16Vector:
+		return v.ToFloat32Vector()
+	case entity.FloatVector:
+		return v
+	}
+	return nil
+}
+
+// vectorDataset caches the vectors of the items pushed by initCollectionIfNeeded in a monitoring
+// collection, including the init flag item, indexed by id.
+type vectorDataset struct {
+	lock    sync.Mutex
+	vectors []entity.Vector
+}
+
+func (d *vectorDataset) get(e *MilvusEndpoint, vector VectorConfig, keyPrefix string) []entity.Vector {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.vectors) != e.Config.InitItemsPerCollection+1 {
+		vectors := make([]entity.Vector, e.Config.InitItemsPerCollection+1)
+		for i := 0; i < e.Config.InitItemsPerCollection; i++ {
+			vectors[i] = vector.deterministicVector(fmt.Sprintf("%s%d", keyPrefix, i))
+		}
+		flagKey := fmt.Sprintf("%s%s", keyPrefix, e.Config.InitFlagKey)
+		vectors[e.Config.InitItemsPerCollection] = vector.deterministicVector(flagKey)
+		d.vectors = vectors
+	}
+	return d.vectors
+}
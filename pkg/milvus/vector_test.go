@@ -0,0 +1,76 @@
+package milvus
+
+import (
+	"testing"
+
+	"github.com/milvus-io/milvus/client/v2/entity"
+	mvindex "github.com/milvus-io/milvus/client/v2/index"
+	"gopkg.in/yaml.v2"
+)
+
+func TestVectorConfig(t *testing.T) {
+	tests := []struct {
+		raw        string
+		fieldType  entity.FieldType
+		metricType string
+		indexType  mvindex.IndexType
+	}{
+		{"{}", entity.FieldTypeFloatVector, "COSINE", mvindex.Flat},
+		{"{type: float16, metric_type: l2}", entity.FieldTypeFloat16Vector, "L2", mvindex.Flat},
+		{"{type: binary, dimension: 64}", entity.FieldTypeBinaryVector, "HAMMING", mvindex.BinFlat},
+		{"{type: sparse, dimension: 1000}", entity.FieldTypeSparseVector, "IP", mvindex.SparseInverted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			var vector VectorConfig
+			if err := yaml.Unmarshal([]byte(tt.raw), &vector); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if vector.field().DataType != tt.fieldType {
+				t.Fatalf("expected field type %v, got %v", tt.fieldType, vector.field().DataType)
+			}
+			if vector.MetricType != tt.metricType {
+				t.Fatalf("expected metric type %s, got %s", tt.metricType, vector.MetricType)
+			}
+			if got := vector.exactIndex().Params()[mvindex.IndexTypeKey]; got != string(tt.indexType) {
+				t.Fatalf("expected index %s, got %s", tt.indexType, got)
+			}
+
+			// Generated vectors are deterministic and fit in the column of the schema
+			vec := vector.deterministicVector("key")
+			if !vectorsMatch(vec, vector.deterministicVector("key")) || vectorsMatch(vec, vector.deterministicVector("other")) {
+				t.Fatal("expected deterministic vectors to only depend on their seed")
+			}
+			if vector.column([]entity.Vector{vec, vector.randomVector()}).Len() != 2 {
+				t.Fatal("expected a column of 2 vectors")
+			}
+			// A vector is the closest to itself
+			if vector.similarity(vec, vec) < vector.similarity(vec, vector.randomVector()) {
+				t.Fatal("expected a vector to be the closest to itself")
+			}
+		})
+	}
+
+	for _, raw := range []string{
+		"{type: double}",
+		"{type: binary, dimension: 100}",
+		"{type: sparse, metric_type: L2}",
+		"{dimension: -1}",
+	} {
+		var vector VectorConfig
+		if err := yaml.Unmarshal([]byte(raw), &vector); err == nil {
+			t.Fatalf("expected an error for %s", raw)
+		}
+	}
+}
+
+func TestSparseVector(t *testing.T) {
+	vector := VectorConfig{Type: vectorTypeSparse, Dimension: 1000, MetricType: "IP"}
+	vec := vector.deterministicVector("key").(entity.SparseEmbedding)
+	if vec.Len() != SPARSE_NON_ZEROS {
+		t.Fatalf("expected %d non-zero values, got %d", SPARSE_NON_ZEROS, vec.Len())
+	}
+	if score := vector.similarity(vec, vec); score < 1-VECTOR_TOLERANCE || score > 1+VECTOR_TOLERANCE {
+		t.Fatalf("expected normalized sparse vectors, got a self similarity of %v", score)
+	}
+}
@@ -1,7 +1,12 @@
 package opensearch
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,18 +24,15 @@ var (
 )
 
 const (
-	LATENCY_INDEX_NAME         = ".monitoring_latency"
-	LATENCY_INDEX_NUM_SHARDS   = 1
-	LATENCY_INDEX_NUM_REPLICAS = 1
-	LATENCY_DOCUMENT_ID_PREFIX = "latency_document_1_"
-	LATENCY_DOCUMENT_CONTENT   = "While the exact amount of text data in a kilobyte (KB) or megabyte (MB) can vary depending on the nature of a document, a kilobyte can hold about half of a page of text, while a megabyte holds about 500 pages of text."
-
-	DURABILITY_INDEX_NAME         = ".monitoring_durability"
-	DURABILITY_INDEX_NUM_SHARDS   = 1
-	DURABILITY_INDEX_NUM_REPLICAS = 1
-	DURABILITY_DOCUMENT_ID_PREFIX = "durability_document_1_"
-	DURABILITY_DOCUMENT_COUNT     = 10000
-	DURABILITY_DOCUMENT_CONTENT   = "While the exact amount of text data in a kilobyte (KB) or megabyte (MB) can vary depending on the nature of a document, a kilobyte can hold about half of a page of text, while a megabyte holds about 500 pages of text."
+	// Repeated (and truncated) to the configured document size
+	DOCUMENT_CONTENT_PATTERN = "While the exact amount of text data in a kilobyte (KB) or megabyte (MB) can vary depending on the nature of a document, a kilobyte can hold about half of a page of text, while a megabyte holds about 500 pages of text."
+
+	// Maximum number of documents returned by a search (index.max_result_window)
+	MAX_RESULT_WINDOW = 10000
+
+	// Format of the durability documents, recorded in the flag document: the content of v2
+	// documents is derived from their id
+	durabilityDocumentFormat = 2
 )
 
 var opLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
@@ -59,6 +61,11 @@ var opDurabilityCorruptedItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Help: "Total number of corrupted items in the durability index",
 }, []string{"cluster"})
 
+var opDurabilityMissingItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: OSSuffix + "_durability_missing_items",
+	Help: "Total number of expected items not found in the durability index",
+}, []string{"cluster"})
+
 var indexHealth = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Name: OSSuffix + "_index_health_status",
 	Help: "Health status of the latency index (green is 0, yellow is 1 and red is 2)",
@@ -127,13 +134,17 @@ func LatencyPrepare(p topology.ProbeableEndpoint) error {
 	clusterErrorsCount.WithLabelValues(e.ClusterName).Set(0)
 
 	// Check if latency index exists, create it if it does not
-	exists, err := e.checkIndexExists(LATENCY_INDEX_NAME)
+	exists, err := e.checkIndexExists(e.Config.LatencyIndex.Name)
 	if err != nil {
 		return errorHandler(fmt.Errorf("error checking if latency index exists: %v", err), e.ClusterName)
 	}
 	if !exists {
-		level.Info(e.Logger).Log("msg", fmt.Sprintf("Latency index %s does not exist, creating it", LATENCY_INDEX_NAME))
-		err = e.createIndex(LATENCY_INDEX_NAME, LATENCY_INDEX_NUM_SHARDS, LATENCY_INDEX_NUM_REPLICAS)
+		level.Info(e.Logger).Log("msg", fmt.Sprintf("Latency index %s does not exist, creating it", e.Config.LatencyIndex.Name))
+		shards, err := e.indexShards(e.Config.LatencyIndex)
+		if err != nil {
+			return errorHandler(fmt.Errorf("error getting latency index shard count: %v", err), e.ClusterName)
+		}
+		err = e.createIndex(e.Config.LatencyIndex.Name, shards, e.Config.LatencyIndex.Replicas)
 		if err != nil {
 			return errorHandler(fmt.Errorf("error creating latency index: %v", err), e.ClusterName)
 		}
@@ -149,12 +160,13 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 	}
 
 	// CRAFT DOCUMENT ID
-	documentID := LATENCY_DOCUMENT_ID_PREFIX + uuid.New().String()
+	documentID := e.Config.LatencyIndex.DocumentIDPrefix + uuid.New().String()
+	content := documentContent(e.Config.LatencyIndex.DocumentSize)
 
 	// CREATE DOCUMENT
-	labels := []string{"index", e.Name, e.ClusterName, LATENCY_INDEX_NAME}
+	labels := []string{"index", e.Name, e.ClusterName, e.Config.LatencyIndex.Name}
 	opPut := func() error {
-		return e.insertDocument(LATENCY_INDEX_NAME, documentID, LATENCY_DOCUMENT_CONTENT)
+		return e.insertDocument(e.Config.LatencyIndex.Name, documentID, content)
 	}
 
 	err := ObserveOpLatency(opPut, labels)
@@ -164,13 +176,13 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 	level.Debug(e.Logger).Log("msg", fmt.Sprintf("document created: %s", documentID))
 
 	// GET DOCUMENT
-	labels = []string{"get", e.Name, e.ClusterName, LATENCY_INDEX_NAME}
+	labels = []string{"get", e.Name, e.ClusterName, e.Config.LatencyIndex.Name}
 	opGet := func() error {
-		content, err := e.getDocument(LATENCY_INDEX_NAME, documentID)
+		got, err := e.getDocument(e.Config.LatencyIndex.Name, documentID)
 		if err != nil {
 			return err
 		}
-		if content != LATENCY_DOCUMENT_CONTENT {
+		if got != content {
 			return fmt.Errorf("retrieved document content does not match expected content")
 		}
 
@@ -184,9 +196,9 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 	}
 
 	// COUNT DOCUMENTS
-	labels = []string{"count", e.Name, e.ClusterName, LATENCY_INDEX_NAME}
+	labels = []string{"count", e.Name, e.ClusterName, e.Config.LatencyIndex.Name}
 	opCount := func() error {
-		count, err := e.countDocuments(LATENCY_INDEX_NAME)
+		count, err := e.countDocuments(e.Config.LatencyIndex.Name)
 		if err != nil {
 			return err
 		}
@@ -204,9 +216,9 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 	}
 
 	// DELETE DOCUMENT
-	labels = []string{"delete", e.Name, e.ClusterName, LATENCY_INDEX_NAME}
+	labels = []string{"delete", e.Name, e.ClusterName, e.Config.LatencyIndex.Name}
 	opDelete := func() error {
-		return e.deleteDocument(LATENCY_INDEX_NAME, documentID)
+		return e.deleteDocument(e.Config.LatencyIndex.Name, documentID)
 	}
 
 	err = ObserveOpLatency(opDelete, labels)
@@ -216,14 +228,14 @@ func LatencyCheck(p topology.ProbeableEndpoint) error {
 	level.Debug(e.Logger).Log("msg", fmt.Sprintf("document delete: %s", documentID))
 
 	// INDEX HEALTH
-	health, err := e.getIndexHealth(LATENCY_INDEX_NAME)
+	health, err := e.getIndexHealth(e.Config.LatencyIndex.Name)
 	if err != nil {
 		return errorHandler(fmt.Errorf("failed to get index health for %s: %s", e.Name, err), e.ClusterName)
 	}
-	indexHealth.WithLabelValues(e.ClusterName, LATENCY_INDEX_NAME).Set(health)
+	indexHealth.WithLabelValues(e.ClusterName, e.Config.LatencyIndex.Name).Set(health)
 
 	// CAT HEALTH
-	labels = []string{"cat_health", e.Name, e.ClusterName, LATENCY_INDEX_NAME}
+	labels = []string{"cat_health", e.Name, e.ClusterName, e.Config.LatencyIndex.Name}
 	opCat := func() error {
 		return e.catHealth()
 	}
@@ -247,28 +259,58 @@ func DurabilityPrepare(p topology.ProbeableEndpoint) error {
 	clusterLock.Lock()
 	defer clusterLock.Unlock()
 
+	index := e.Config.DurabilityIndex
+
 	// Check if durability index exists, create it if it does not
-	exists, err := e.checkIndexExists(DURABILITY_INDEX_NAME)
+	exists, err := e.checkIndexExists(index.Name)
 	if err != nil {
 		return errorHandler(fmt.Errorf("error checking if durability index exists: %v", err), e.ClusterName)
 	}
 	if !exists {
-		level.Info(e.Logger).Log("msg", fmt.Sprintf("Durability index %s does not exist, creating it", DURABILITY_INDEX_NAME))
-		err = e.createIndex(DURABILITY_INDEX_NAME, DURABILITY_INDEX_NUM_SHARDS, DURABILITY_INDEX_NUM_REPLICAS)
+		level.Info(e.Logger).Log("msg", fmt.Sprintf("Durability index %s does not exist, creating it", index.Name))
+		shards, err := e.indexShards(index)
 		if err != nil {
-			return errorHandler(fmt.Errorf("error creating durability index: %v", err), e.ClusterName)
+			return errorHandler(fmt.Errorf("error getting durability index shard count: %v", err), e.ClusterName)
 		}
-
-		// Create all the durability documents
-		err = e.insertDocumentBulk(DURABILITY_INDEX_NAME, DURABILITY_DOCUMENT_COUNT, DURABILITY_DOCUMENT_ID_PREFIX, DURABILITY_DOCUMENT_CONTENT)
+		err = e.createIndex(index.Name, shards, index.Replicas)
 		if err != nil {
-			return errorHandler(fmt.Errorf("error creating durability documents: %v", err), e.ClusterName)
+			return errorHandler(fmt.Errorf("error creating durability index: %v", err), e.ClusterName)
 		}
+		return errorHandler(pushDurabilityDocuments(e), e.ClusterName)
+	}
+
+	// The documents of an existing index are only pushed again when the flag tells they were
+	// pushed with another format or settings (no flag: fixed content of the first version).
+	// Missing or corrupted documents are left as is, for the check to report them.
+	flagID := durabilityFlagID(index.DocumentIDPrefix)
+	flag, err := e.getDocument(index.Name, flagID)
+	if err != nil && !errors.Is(err, errDocumentNotFound) {
+		return errorHandler(fmt.Errorf("error reading durability flag: %v", err), e.ClusterName)
+	}
+	if expected := durabilityFlagValue(e.Config.DurabilityDocumentCount, index.DocumentSize); flag != expected {
+		level.Info(e.Logger).Log("msg", fmt.Sprintf("Durability flag %s is '%s', expected '%s': pushing all durability documents", flagID, flag, expected))
+		return errorHandler(pushDurabilityDocuments(e), e.ClusterName)
 	}
 
 	return nil
 }
 
+// pushDurabilityDocuments pushes all the durability documents, then the flag recording it.
+func pushDurabilityDocuments(e *OpenSearchEndpoint) error {
+	index := e.Config.DurabilityIndex
+	err := e.insertDocumentBulk(index.Name, e.Config.DurabilityDocumentCount, index.DocumentIDPrefix, func(documentID string) string {
+		return durabilityDocumentContent(documentID, index.DocumentSize)
+	})
+	if err != nil {
+		return fmt.Errorf("error creating durability documents: %v", err)
+	}
+	err = e.indexDocument(index.Name, durabilityFlagID(index.DocumentIDPrefix), durabilityFlagValue(e.Config.DurabilityDocumentCount, index.DocumentSize))
+	if err != nil {
+		return fmt.Errorf("error creating durability flag: %v", err)
+	}
+	return nil
+}
+
 func DurabilityCheck(p topology.ProbeableEndpoint) error {
 	e, ok := p.(*OpenSearchEndpoint)
 	if !ok {
@@ -278,39 +320,121 @@ func DurabilityCheck(p topology.ProbeableEndpoint) error {
 	// Prepare metrics labels
 	labels := []string{e.ClusterName}
 
-	// Get all documents
-	files, err := e.getAllIndexDocuments(DURABILITY_INDEX_NAME)
+	// Sweep all documents
+	index := e.Config.DurabilityIndex
+	sweep := newDurabilitySweep(index.DocumentIDPrefix, e.Config.DurabilityDocumentCount, index.DocumentSize)
+	err := e.scrollIndexDocuments(index.Name, e.Config.DurabilityPageSize, e.Config.DurabilityScrollKeepAlive, func(documentID string, content string) {
+		if sweep.add(documentID, content) {
+			level.Error(e.Logger).Log("msg", fmt.Sprintf("corrupted document detected on document %s: '%s'!='%s'", documentID, content, durabilityDocumentContent(documentID, index.DocumentSize)))
+		}
+	})
 	if err != nil {
 		return errorHandler(fmt.Errorf("error retrieving durability documents: %v", err), e.ClusterName)
 	}
 
-	// Init coorrupted items metric to 0
-	opDurabilityCorruptedItems.WithLabelValues(labels...).Set(0)
-
-	// Iterate over retrieved documents and check their content
-	for id, content := range files {
-		expectedContent := []byte(DURABILITY_DOCUMENT_CONTENT)
-		if string(content) != string(expectedContent) {
-			level.Error(e.Logger).Log("msg", fmt.Sprintf("corrupted document detected on document %s: '%s'!='%s'", id, content, expectedContent))
-			opDurabilityCorruptedItems.WithLabelValues(labels...).Inc()
-		}
+	if missing := sweep.missing(); missing > 0 {
+		level.Error(e.Logger).Log("msg", fmt.Sprintf("%d durability documents missing, first ones: %s", missing, strings.Join(sweep.missingIDs(10), ",")))
 	}
 
+	// Update metrics
+	opDurabilityExpectedItems.WithLabelValues(labels...).Set(float64(e.Config.DurabilityDocumentCount))
+	opDurabilityFoundItems.WithLabelValues(labels...).Set(float64(sweep.found))
+	opDurabilityMissingItems.WithLabelValues(labels...).Set(float64(sweep.missing()))
+	opDurabilityCorruptedItems.WithLabelValues(labels...).Set(float64(sweep.corrupted))
+
 	// INDEX HEALTH
-	health, err := e.getIndexHealth(DURABILITY_INDEX_NAME)
+	health, err := e.getIndexHealth(index.Name)
 	if err != nil {
 		return errorHandler(fmt.Errorf("failed to get index health for %s: %s", e.Name, err), e.ClusterName)
 	}
-	indexHealth.WithLabelValues(e.ClusterName, DURABILITY_INDEX_NAME).Set(health)
-
-	// Update metrics
-	opDurabilityExpectedItems.WithLabelValues(labels...).Set(float64(DURABILITY_DOCUMENT_COUNT))
-	opDurabilityFoundItems.WithLabelValues(labels...).Set(float64(len(files)))
+	indexHealth.WithLabelValues(e.ClusterName, index.Name).Set(health)
 
-	// Check all durability documents
 	return nil
 }
 
+// documentContent returns the content of the monitoring documents: the content pattern repeated
+// and truncated to size bytes.
+func documentContent(size int) string {
+	repeat := size/len(DOCUMENT_CONTENT_PATTERN) + 1
+	return strings.Repeat(DOCUMENT_CONTENT_PATTERN, repeat)[:size]
+}
+
+// durabilityDocumentID returns the id of the n-th durability document (starting at 1).
+func durabilityDocumentID(prefix string, n int) string {
+	return fmt.Sprintf("%s-%d", prefix, n)
+}
+
+// durabilityFlagID returns the id of the flag document, which is not a durability document.
+func durabilityFlagID(prefix string) string {
+	return prefix + "-flag"
+}
+
+// durabilityFlagValue is the content of the flag document once all the durability documents have
+// been pushed (format:document_count:document_size). Documents of the first format had a fixed
+// content and no flag.
+func durabilityFlagValue(count int, size int) string {
+	return fmt.Sprintf("v%d:%d:%d", durabilityDocumentFormat, count, size)
+}
+
+// durabilityDocumentContent returns the content of a durability document, derived from its id so
+// that a document replaced by another one is detected: the sha256 of the id followed by the
+// content pattern, truncated to size bytes.
+func durabilityDocumentContent(documentID string, size int) string {
+	sum := sha256.Sum256([]byte(documentID))
+	return (hex.EncodeToString(sum[:]) + " " + documentContent(size))[:size]
+}
+
+// durabilitySweep tracks the expected durability documents found by a sweep of the index.
+type durabilitySweep struct {
+	prefix    string
+	size      int
+	seen      []bool
+	found     int
+	corrupted int
+}
+
+func newDurabilitySweep(prefix string, count int, size int) *durabilitySweep {
+	return &durabilitySweep{prefix: prefix, size: size, seen: make([]bool, count)}
+}
+
+// add records a document of the index and returns whether it is corrupted. Documents which are
+// not expected (other prefix, beyond the document count) are ignored.
+func (s *durabilitySweep) add(documentID string, content string) bool {
+	suffix, ok := strings.CutPrefix(documentID, s.prefix+"-")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n < 1 || n > len(s.seen) || s.seen[n-1] {
+		return false
+	}
+	s.seen[n-1] = true
+	s.found++
+	if content != durabilityDocumentContent(documentID, s.size) {
+		s.corrupted++
+		return true
+	}
+	return false
+}
+
+func (s *durabilitySweep) missing() int {
+	return len(s.seen) - s.found
+}
+
+// missingIDs returns the ids of at most limit missing documents.
+func (s *durabilitySweep) missingIDs(limit int) []string {
+	ids := []string{}
+	for i, seen := range s.seen {
+		if len(ids) >= limit {
+			break
+		}
+		if !seen {
+			ids = append(ids, durabilityDocumentID(s.prefix, i+1))
+		}
+	}
+	return ids
+}
+
 // errorHandler increments the cluster error count metric if an error is present and returns the error.
 func errorHandler(err error, clusterName string) error {
 	if err != nil {
@@ -2,9 +2,13 @@ package opensearch
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/criteo/blackbox-prober/pkg/common"
 	"github.com/go-kit/log"
@@ -38,6 +42,17 @@ func newTestEndpoint(t *testing.T, server *httptest.Server, nodeInfoCache map[st
 
 // catNodesMux returns an http.Handler that serves /_cat/nodes with the given node names.
 func catNodesMux(t *testing.T, nodeNames []string) http.Handler {
+	t.Helper()
+	roles := make([]string, len(nodeNames))
+	for i := range roles {
+		roles[i] = "dimr"
+	}
+	return catNodesWithRolesMux(t, nodeNames, roles)
+}
+
+// catNodesWithRolesMux returns an http.Handler that serves /_cat/nodes with the given node names
+// and abbreviated roles.
+func catNodesWithRolesMux(t *testing.T, nodeNames []string, roles []string) http.Handler {
 	t.Helper()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/_cat/nodes", func(w http.ResponseWriter, r *http.Request) {
@@ -45,10 +60,11 @@ func catNodesMux(t *testing.T, nodeNames []string) http.Handler {
 			Name string `json:"name"`
 			IP   string `json:"ip"`
 			Port int    `json:"port,string"`
+			Role string `json:"node.role"`
 		}
 		nodes := make([]node, len(nodeNames))
 		for i, n := range nodeNames {
-			nodes[i] = node{Name: n, IP: "10.0.0.1", Port: 9200}
+			nodes[i] = node{Name: n, IP: "10.0.0.1", Port: 9200, Role: roles[i]}
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(nodes)
@@ -212,3 +228,266 @@ func (f *fakeEndpoint) IsCluster() bool { return false }
 func (f *fakeEndpoint) Connect() error  { return nil }
 func (f *fakeEndpoint) Refresh() error  { return nil }
 func (f *fakeEndpoint) Close() error    { return nil }
+
+func TestIndexShardsPerDataNode(t *testing.T) {
+	server := httptest.NewServer(catNodesWithRolesMux(t, []string{"master-1", "data-1", "data-2", "data-3"}, []string{"m", "di", "d", "dimr"}))
+	defer server.Close()
+	e := newTestEndpoint(t, server, nil)
+
+	index := MonitoringIndexConfig{Name: ".monitoring_latency", Shards: 2}
+	if shards, err := e.indexShards(index); err != nil || shards != 2 {
+		t.Errorf("expected the configured 2 shards, got %d (err=%v)", shards, err)
+	}
+	index.ShardPerDataNode = true
+	if shards, err := e.indexShards(index); err != nil || shards != 3 {
+		t.Errorf("expected one shard per data node (3), got %d (err=%v)", shards, err)
+	}
+}
+
+func TestIndexShardsNoDataNode(t *testing.T) {
+	server := httptest.NewServer(catNodesWithRolesMux(t, []string{"master-1"}, []string{"m"}))
+	defer server.Close()
+	e := newTestEndpoint(t, server, nil)
+
+	if _, err := e.indexShards(MonitoringIndexConfig{Name: ".monitoring_latency", ShardPerDataNode: true}); err == nil {
+		t.Error("expected an error without data node")
+	}
+}
+
+func TestDurabilityDocumentContent(t *testing.T) {
+	content := durabilityDocumentContent(durabilityDocumentID("prefix", 1), 217)
+	if len(content) != 217 {
+		t.Errorf("expected 217 bytes, got %d", len(content))
+	}
+	if content == durabilityDocumentContent(durabilityDocumentID("prefix", 2), 217) {
+		t.Error("expected documents to have different contents")
+	}
+	if content != durabilityDocumentContent(durabilityDocumentID("prefix", 1), 217) {
+		t.Error("expected the content of a document to be deterministic")
+	}
+}
+
+func TestDurabilitySweep(t *testing.T) {
+	sweep := newDurabilitySweep("prefix", 5, 100)
+	add := func(n int, content string) bool {
+		return sweep.add(durabilityDocumentID("prefix", n), content)
+	}
+
+	if add(1, durabilityDocumentContent(durabilityDocumentID("prefix", 1), 100)) {
+		t.Error("expected document 1 to be valid")
+	}
+	// Document 2 replaced by document 3
+	if !add(2, durabilityDocumentContent(durabilityDocumentID("prefix", 3), 100)) {
+		t.Error("expected document 2 to be corrupted")
+	}
+	// Unexpected documents are ignored
+	sweep.add(durabilityDocumentID("other", 4), "")
+	add(6, "")
+	add(1, "")
+
+	if sweep.found != 2 || sweep.corrupted != 1 || sweep.missing() != 3 {
+		t.Errorf("expected 2 found, 1 corrupted and 3 missing, got %d, %d and %d", sweep.found, sweep.corrupted, sweep.missing())
+	}
+	if ids := strings.Join(sweep.missingIDs(2), ","); ids != "prefix-3,prefix-4" {
+		t.Errorf("unexpected missing ids %s", ids)
+	}
+}
+
+// scrollMux returns an http.Handler that serves the documents of an index by scroll pages.
+func scrollMux(t *testing.T, index string, documentIDs []string, pageSize int) http.Handler {
+	t.Helper()
+	page := func(w http.ResponseWriter, n int) {
+		type hit struct {
+			ID     string            `json:"_id"`
+			Source map[string]string `json:"_source"`
+		}
+		hits := []hit{}
+		for i := n * pageSize; i < len(documentIDs) && i < (n+1)*pageSize; i++ {
+			hits = append(hits, hit{ID: documentIDs[i], Source: map[string]string{"content": documentIDs[i]}})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"_scroll_id": fmt.Sprintf("scroll-%d", n+1),
+			"hits":       map[string]any{"hits": hits},
+		})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+index+"/_search", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scroll") == "" {
+			t.Error("expected a scroll search")
+		}
+		page(w, 0)
+	})
+	mux.HandleFunc("/_search/scroll", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ScrollID string `json:"scroll_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var n int
+		fmt.Sscanf(body.ScrollID, "scroll-%d", &n)
+		page(w, n)
+	})
+	mux.HandleFunc("/_search/scroll/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"succeeded":true,"num_freed":1}`))
+	})
+	return mux
+}
+
+func TestScrollIndexDocuments(t *testing.T) {
+	var documentIDs []string
+	for i := 1; i <= 25; i++ {
+		documentIDs = append(documentIDs, durabilityDocumentID("prefix", i))
+	}
+	server := httptest.NewServer(scrollMux(t, ".monitoring_durability", documentIDs, 10))
+	defer server.Close()
+	e := newTestEndpoint(t, server, nil)
+
+	seen := map[string]bool{}
+	err := e.scrollIndexDocuments(".monitoring_durability", 10, time.Minute, func(documentID string, content string) {
+		if content != documentID {
+			t.Errorf("unexpected content %q for document %s", content, documentID)
+		}
+		seen[documentID] = true
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != 25 {
+		t.Errorf("expected the 25 documents over several pages, got %d", len(seen))
+	}
+}
+
+// durabilityIndexServer serves a durability index (exists, create, get, index and bulk) backed by
+// a map of document contents.
+type durabilityIndexServer struct {
+	t         *testing.T
+	index     string
+	exists    bool
+	documents map[string]string
+	failGet   bool
+}
+
+func (s *durabilityIndexServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.TrimPrefix(r.URL.Path, "/"+s.index)
+	switch {
+	case path == "" && r.Method == http.MethodHead:
+		if !s.exists {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case path == "" && r.Method == http.MethodPut:
+		s.exists = true
+		w.Write([]byte(`{"acknowledged":true}`))
+	case strings.HasPrefix(path, "/_doc/") && r.Method == http.MethodGet:
+		id := strings.TrimPrefix(path, "/_doc/")
+		content, ok := s.documents[id]
+		switch {
+		case s.failGet:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"internal error","status":500}`))
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"_index": s.index, "_id": id, "found": false})
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"_index": s.index, "_id": id, "found": true, "_source": map[string]string{"content": content}})
+		}
+	case strings.HasPrefix(path, "/_doc/"):
+		var doc struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&doc)
+		id := strings.TrimPrefix(path, "/_doc/")
+		s.documents[id] = doc.Content
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"_index": s.index, "_id": id, "result": "created"})
+	case path == "/_bulk":
+		items := []map[string]any{}
+		decoder := json.NewDecoder(r.Body)
+		for decoder.More() {
+			var meta map[string]struct {
+				ID string `json:"_id"`
+			}
+			var doc struct {
+				Content string `json:"content"`
+			}
+			if err := decoder.Decode(&meta); err != nil {
+				s.t.Errorf("invalid bulk request: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := decoder.Decode(&doc); err != nil {
+				s.t.Errorf("invalid bulk request: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.documents[meta["index"].ID] = doc.Content
+			items = append(items, map[string]any{"index": map[string]any{"_id": meta["index"].ID, "status": 201}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"errors": false, "items": items})
+	default:
+		s.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestDurabilityPrepare(t *testing.T) {
+	conf := defaultOpenSearchEndpointConfig
+	conf.DurabilityDocumentCount = 3
+	index := conf.DurabilityIndex
+	flagID := durabilityFlagID(index.DocumentIDPrefix)
+	flag := durabilityFlagValue(conf.DurabilityDocumentCount, index.DocumentSize)
+	pushed := func() map[string]string {
+		documents := map[string]string{flagID: flag}
+		for i := 1; i <= conf.DurabilityDocumentCount; i++ {
+			id := durabilityDocumentID(index.DocumentIDPrefix, i)
+			documents[id] = durabilityDocumentContent(id, index.DocumentSize)
+		}
+		return documents
+	}
+	// Documents of the first format: fixed content, no flag
+	legacy := map[string]string{}
+	for i := 1; i <= conf.DurabilityDocumentCount; i++ {
+		legacy[durabilityDocumentID(index.DocumentIDPrefix, i)] = documentContent(index.DocumentSize)
+	}
+	// Data loss on an index already pushed
+	lost := pushed()
+	delete(lost, durabilityDocumentID(index.DocumentIDPrefix, 3))
+	lost[durabilityDocumentID(index.DocumentIDPrefix, 1)] = "corrupted"
+
+	tests := []struct {
+		name      string
+		exists    bool
+		documents map[string]string
+		failGet   bool
+		expected  map[string]string
+		err       bool
+	}{
+		{name: "new index", expected: pushed()},
+		{name: "already pushed", exists: true, documents: pushed(), expected: pushed()},
+		{name: "first format", exists: true, documents: legacy, expected: pushed()},
+		{name: "data loss", exists: true, documents: lost, expected: lost},
+		{name: "flag read failure", exists: true, documents: legacy, failGet: true, expected: legacy, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documents := map[string]string{}
+			for id, content := range tt.documents {
+				documents[id] = content
+			}
+			fake := &durabilityIndexServer{t: t, index: index.Name, exists: tt.exists, documents: documents, failGet: tt.failGet}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			e := newTestEndpoint(t, server, nil)
+			e.Config = conf
+
+			err := DurabilityPrepare(e)
+			if tt.err != (err != nil) {
+				t.Fatalf("expected error: %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(fake.documents, tt.expected) {
+				t.Errorf("unexpected documents after prepare: %v", fake.documents)
+			}
+		})
+	}
+}
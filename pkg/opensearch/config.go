@@ -1,8 +1,13 @@
 package opensearch
 
 import (
+	"crypto/sha256"
+	"regexp"
+	"time"
+
 	"github.com/criteo/blackbox-prober/pkg/discovery"
 	"github.com/criteo/blackbox-prober/pkg/scheduler"
+	"github.com/pkg/errors"
 )
 
 // Config used to configure the endpoint of OpenSearch
@@ -19,8 +24,32 @@ type OpenSearchEndpointConfig struct {
 	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
 	// Metadata key to get the Hostname to use for TLS auth (only used if tlsTag is set)
 	AddressMetaKey string `yaml:"address_meta_key,omitempty"`
+	// Probe configuration
+	LatencyIndex            MonitoringIndexConfig `yaml:"latency_index,omitempty"`
+	DurabilityIndex         MonitoringIndexConfig `yaml:"durability_index,omitempty"`
+	DurabilityDocumentCount int                   `yaml:"durability_document_count,omitempty"`
+	// Number of documents per page of the durability sweep
+	DurabilityPageSize int `yaml:"durability_page_size,omitempty"`
+	// Time the scroll of the durability sweep is kept alive between two pages
+	DurabilityScrollKeepAlive time.Duration `yaml:"durability_scroll_keep_alive,omitempty"`
+}
+
+// Settings of a monitoring index and of its documents
+type MonitoringIndexConfig struct {
+	Name     string `yaml:"name,omitempty"`
+	Shards   int    `yaml:"shards,omitempty"`
+	Replicas int    `yaml:"replicas"`
+	// Create the index with one primary shard per data node (shards is ignored), so every node
+	// holds monitored data
+	ShardPerDataNode bool   `yaml:"shard_per_data_node,omitempty"`
+	DocumentIDPrefix string `yaml:"document_id_prefix,omitempty"`
+	// Size of the content of the documents in bytes
+	DocumentSize int `yaml:"document_size,omitempty"`
 }
 
+// Lowercase, no special characters (\ / * ? " < > | , # : space), not starting with - _ +
+var indexNameRegex = regexp.MustCompile(`^[a-z0-9.][a-z0-9._-]*$`)
+
 var (
 	defaultOpenSearchEndpointConfig = OpenSearchEndpointConfig{
 		AuthEnabled:        true,
@@ -28,6 +57,23 @@ var (
 		PasswordEnv:        "OPENSEARCH_PASSWORD",
 		TLSTag:             "tls",
 		InsecureSkipVerify: true,
+		LatencyIndex: MonitoringIndexConfig{
+			Name:             ".monitoring_latency",
+			Shards:           1,
+			Replicas:         1,
+			DocumentIDPrefix: "latency_document_1_",
+			DocumentSize:     len(DOCUMENT_CONTENT_PATTERN),
+		},
+		DurabilityIndex: MonitoringIndexConfig{
+			Name:             ".monitoring_durability",
+			Shards:           1,
+			Replicas:         1,
+			DocumentIDPrefix: "durability_document_1_",
+			DocumentSize:     len(DOCUMENT_CONTENT_PATTERN),
+		},
+		DurabilityDocumentCount:   10000,
+		DurabilityPageSize:        1000,
+		DurabilityScrollKeepAlive: time.Minute,
 	}
 )
 
@@ -39,6 +85,46 @@ func (c *OpenSearchEndpointConfig) UnmarshalYAML(unmarshal func(interface{}) err
 	if err != nil {
 		return err
 	}
+	if err := c.LatencyIndex.validate(); err != nil {
+		return errors.Wrap(err, "latency_index")
+	}
+	if err := c.DurabilityIndex.validate(); err != nil {
+		return errors.Wrap(err, "durability_index")
+	}
+	if c.LatencyIndex.Name == c.DurabilityIndex.Name {
+		return errors.Errorf("latency and durability indices must be different, got %s for both", c.LatencyIndex.Name)
+	}
+	if c.DurabilityIndex.DocumentSize < sha256.Size*2 {
+		return errors.Errorf("durability_index document_size must be at least %d to hold the hash of the document id, got %d", sha256.Size*2, c.DurabilityIndex.DocumentSize)
+	}
+	if c.DurabilityDocumentCount <= 0 {
+		return errors.Errorf("durability_document_count must be positive, got %d", c.DurabilityDocumentCount)
+	}
+	if c.DurabilityPageSize <= 0 || c.DurabilityPageSize > MAX_RESULT_WINDOW {
+		return errors.Errorf("durability_page_size must be between 1 and %d, got %d", MAX_RESULT_WINDOW, c.DurabilityPageSize)
+	}
+	if c.DurabilityScrollKeepAlive <= 0 {
+		return errors.Errorf("durability_scroll_keep_alive must be positive, got %s", c.DurabilityScrollKeepAlive)
+	}
+	return nil
+}
+
+func (c MonitoringIndexConfig) validate() error {
+	if !indexNameRegex.MatchString(c.Name) {
+		return errors.Errorf("invalid index name %q", c.Name)
+	}
+	if c.Shards <= 0 && !c.ShardPerDataNode {
+		return errors.Errorf("shards must be positive, got %d", c.Shards)
+	}
+	if c.Replicas < 0 {
+		return errors.Errorf("replicas must not be negative, got %d", c.Replicas)
+	}
+	if c.DocumentIDPrefix == "" {
+		return errors.New("document_id_prefix must not be empty")
+	}
+	if c.DocumentSize <= 0 {
+		return errors.Errorf("document_size must be positive, got %d", c.DocumentSize)
+	}
 	return nil
 }
 
@@ -0,0 +1,72 @@
+package opensearch
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestOpenSearchEndpointConfigDefaults(t *testing.T) {
+	var conf OpenSearchEndpointConfig
+	if err := yaml.Unmarshal([]byte("{}"), &conf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conf.LatencyIndex.Name != ".monitoring_latency" || conf.DurabilityIndex.Name != ".monitoring_durability" {
+		t.Errorf("unexpected default index names %q and %q", conf.LatencyIndex.Name, conf.DurabilityIndex.Name)
+	}
+	if conf.DurabilityDocumentCount != 10000 {
+		t.Errorf("expected 10000 durability documents, got %d", conf.DurabilityDocumentCount)
+	}
+	// Documents created before the content was configurable are still valid
+	if documentContent(conf.DurabilityIndex.DocumentSize) != DOCUMENT_CONTENT_PATTERN {
+		t.Error("expected the default content to be the content pattern")
+	}
+}
+
+func TestOpenSearchEndpointConfigPartialIndex(t *testing.T) {
+	var conf OpenSearchEndpointConfig
+	err := yaml.Unmarshal([]byte("latency_index:\n  replicas: 0\n  shard_per_data_node: true\n  document_size: 4096"), &conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	index := conf.LatencyIndex
+	if index.Name != ".monitoring_latency" || index.DocumentIDPrefix != "latency_document_1_" {
+		t.Errorf("expected the unset fields to keep their defaults, got %+v", index)
+	}
+	if index.Replicas != 0 || !index.ShardPerDataNode || index.DocumentSize != 4096 {
+		t.Errorf("expected the set fields to be overridden, got %+v", index)
+	}
+}
+
+func TestOpenSearchEndpointConfigValidation(t *testing.T) {
+	for _, config := range []string{
+		"latency_index: {name: Monitoring}",
+		"latency_index: {name: _monitoring}",
+		"durability_index: {name: .monitoring_latency}",
+		"latency_index: {shards: -1}",
+		"durability_index: {replicas: -1}",
+		"durability_index: {document_id_prefix: ''}",
+		"latency_index: {document_size: -1}",
+		"durability_index: {document_size: 32}",
+		"durability_document_count: -1",
+		"durability_page_size: 20000",
+		"durability_scroll_keep_alive: 0s",
+	} {
+		var conf OpenSearchEndpointConfig
+		if err := yaml.Unmarshal([]byte(config), &conf); err == nil {
+			t.Errorf("expected an error with %q", config)
+		}
+	}
+}
+
+func TestDocumentContent(t *testing.T) {
+	for _, size := range []int{1, len(DOCUMENT_CONTENT_PATTERN) - 1, len(DOCUMENT_CONTENT_PATTERN) + 1, 10000} {
+		content := documentContent(size)
+		if len(content) != size {
+			t.Errorf("expected %d bytes, got %d", size, len(content))
+		}
+		if content[:1] != DOCUMENT_CONTENT_PATTERN[:1] {
+			t.Errorf("expected content to start with the pattern")
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -198,7 +199,36 @@ func (e *OpenSearchEndpoint) insertDocument(indexName string, documentID string,
 	return nil
 }
 
-func (e *OpenSearchEndpoint) insertDocumentBulk(indexName string, documentCount int, documentIDPrefix string, documentContent string) error {
+// indexDocument creates or replaces the document with the given id.
+func (e *OpenSearchEndpoint) indexDocument(indexName string, documentID string, documentContent string) error {
+	ctx := context.Background()
+	doc := map[string]interface{}{
+		"content": documentContent,
+	}
+
+	jsonBody, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("error marshaling document: %v", err)
+	}
+
+	response, err := e.Client.Index(ctx, opensearchapi.IndexReq{
+		Index:      indexName,
+		DocumentID: documentID,
+		Body:       bytes.NewReader(jsonBody),
+	})
+	if err != nil {
+		return fmt.Errorf("error indexing document %s into index %s: %v", documentID, indexName, err)
+	}
+
+	statusCode := response.Inspect().Response.StatusCode
+	if statusCode != 200 && statusCode != 201 {
+		return fmt.Errorf("unexpected status code %d when indexing document %s into index %s", statusCode, documentID, indexName)
+	}
+
+	return nil
+}
+
+func (e *OpenSearchEndpoint) insertDocumentBulk(indexName string, documentCount int, documentIDPrefix string, documentContent func(documentID string) string) error {
 	ctx := context.Background()
 	indexer, err := opensearchutil.NewBulkIndexer(opensearchutil.BulkIndexerConfig{
 		Client:        e.Client,
@@ -212,9 +242,9 @@ func (e *OpenSearchEndpoint) insertDocumentBulk(indexName string, documentCount
 	}
 
 	for i := 0; i < documentCount; i++ {
-		documentID := fmt.Sprintf("%s-%d", documentIDPrefix, i+1)
+		documentID := durabilityDocumentID(documentIDPrefix, i+1)
 		doc := map[string]interface{}{
-			"content": documentContent,
+			"content": documentContent(documentID),
 			"ID":      documentID,
 		}
 
@@ -257,12 +287,18 @@ func (e *OpenSearchEndpoint) insertDocumentBulk(indexName string, documentCount
 	return nil
 }
 
+// errDocumentNotFound is returned (wrapped) by getDocument when the document does not exist.
+var errDocumentNotFound = errors.New("document not found")
+
 func (e *OpenSearchEndpoint) getDocument(indexName string, documentID string) (string, error) {
 	ctx := context.Background()
 	response, err := e.Client.Document.Get(ctx, opensearchapi.DocumentGetReq{
 		Index:      indexName,
 		DocumentID: documentID,
 	})
+	if response != nil && response.Inspect().Response != nil && response.Inspect().Response.StatusCode == 404 {
+		return "", fmt.Errorf("%w: %s in index %s", errDocumentNotFound, documentID, indexName)
+	}
 	if err != nil {
 		return "", fmt.Errorf("error getting document %s from index %s: %v", documentID, indexName, err)
 	}
@@ -289,46 +325,64 @@ func (e *OpenSearchEndpoint) getDocument(indexName string, documentID string) (s
 	return content, nil
 }
 
-func (e *OpenSearchEndpoint) getAllIndexDocuments(indexName string) (map[string][]byte, error) {
+// scrollIndexDocuments goes through all the documents of an index with a scroll, pageSize
+// documents at a time, and calls fn with the id and the content of each one.
+func (e *OpenSearchEndpoint) scrollIndexDocuments(indexName string, pageSize int, keepAlive time.Duration, fn func(documentID string, content string)) error {
 	ctx := context.Background()
-	query := `{"query":{"match_all":{}}}`
-	files := make(map[string][]byte)
-	maxObjects := 10000
+	// Sorting by _doc is the most efficient order for scrolls
+	query := `{"query":{"match_all":{}},"sort":["_doc"]}`
 
-	// Fetch all documents from the index
-	resp, err := e.Client.Search(ctx, &opensearchapi.SearchReq{
+	response, err := e.Client.Search(ctx, &opensearchapi.SearchReq{
 		Indices: []string{indexName},
 		Body:    strings.NewReader(query),
 		Params: opensearchapi.SearchParams{
-			Size: &maxObjects,
+			Size:   &pageSize,
+			Scroll: keepAlive,
 		},
 	})
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error searching documents of index %s: %v", indexName, err)
 	}
+	hits, scrollID := response.Hits.Hits, response.ScrollID
 
-	// Read and parse the response
-	type Hit struct {
-		ID     string         `json:"_id"`
-		Source map[string]any `json:"_source"`
-	}
-	type Hits struct {
-		Hits []Hit `json:"hits"`
-	}
-	type SearchResp struct {
-		Hits Hits `json:"hits"`
-	}
+	defer func() {
+		if scrollID == nil {
+			return
+		}
+		_, err := e.Client.Scroll.Delete(ctx, opensearchapi.ScrollDeleteReq{ScrollIDs: []string{*scrollID}})
+		if err != nil {
+			e.Logger.Log("msg", fmt.Sprintf("fail to clear scroll of index %s: %v", indexName, err))
+		}
+	}()
 
-	var sr SearchResp
-	if err := json.NewDecoder(resp.Inspect().Response.Body).Decode(&sr); err != nil {
-		return nil, err
-	}
+	for len(hits) > 0 {
+		for _, hit := range hits {
+			var source struct {
+				Content string `json:"content"`
+			}
+			if err := json.Unmarshal(hit.Source, &source); err != nil {
+				return fmt.Errorf("error decoding document %s: %v", hit.ID, err)
+			}
+			fn(hit.ID, source.Content)
+		}
 
-	for _, h := range sr.Hits.Hits {
-		files[h.ID] = []byte(h.Source["content"].(string))
+		if scrollID == nil {
+			return fmt.Errorf("no scroll id returned when searching documents of index %s", indexName)
+		}
+		next, err := e.Client.Scroll.Get(ctx, opensearchapi.ScrollGetReq{
+			ScrollID: *scrollID,
+			Params:   opensearchapi.ScrollGetParams{Scroll: keepAlive},
+		})
+		if err != nil {
+			return fmt.Errorf("error scrolling documents of index %s: %v", indexName, err)
+		}
+		hits = next.Hits.Hits
+		if next.ScrollID != nil {
+			scrollID = next.ScrollID
+		}
 	}
 
-	return files, nil
+	return nil
 }
 
 func (e *OpenSearchEndpoint) countDocuments(indexName string) (int64, error) {
@@ -406,3 +460,41 @@ func (e *OpenSearchEndpoint) catNodes() ([]string, error) {
 
 	return nodes, nil
 }
+
+// countDataNodes returns the number of nodes of the cluster with the data role ("d" in the
+// abbreviated roles of _cat/nodes).
+func (e *OpenSearchEndpoint) countDataNodes() (int, error) {
+	ctx := context.Background()
+	response, err := e.Client.Cat.Nodes(ctx, &opensearchapi.CatNodesReq{})
+	if err != nil {
+		return 0, fmt.Errorf("error getting cat nodes: %v", err)
+	}
+
+	if response.Inspect().Response.StatusCode != 200 {
+		return 0, fmt.Errorf("unexpected status code %d when getting cat node", response.Inspect().Response.StatusCode)
+	}
+
+	count := 0
+	for _, node := range response.Nodes {
+		if strings.Contains(node.Role, "d") {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// indexShards returns the number of primary shards to create a monitoring index with.
+func (e *OpenSearchEndpoint) indexShards(index MonitoringIndexConfig) (int, error) {
+	if !index.ShardPerDataNode {
+		return index.Shards, nil
+	}
+	count, err := e.countDataNodes()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no data node found to create index %s with one shard per data node", index.Name)
+	}
+	return count, nil
+}